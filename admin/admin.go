@@ -0,0 +1,228 @@
+// Package admin provides commands for the owners of the bot.
+package admin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
+)
+
+// OwnerFlag is the flag a user must have globally to use owner commands.
+const OwnerFlag = "O"
+
+func init() {
+	ext.RegisterExtension("admin", &Admin{})
+}
+
+// Admin extension
+type Admin struct {
+	b *bot.Bot
+
+	doID     uint64
+	doNetID  uint64
+	extID    uint64
+	rehashID uint64
+}
+
+// Init the extension
+func (a *Admin) Init(b *bot.Bot) error {
+	a.b = b
+
+	var err error
+	a.doID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"admin",
+		"do",
+		"Sends a raw irc line to the current network. Owner only.",
+		a,
+		cmd.Privmsg, cmd.AnyScope, 0, OwnerFlag, "line...",
+	))
+	if err != nil {
+		return err
+	}
+	a.doNetID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"admin",
+		"donet",
+		"Sends a raw irc line to the given network. Owner only.",
+		a,
+		cmd.Privmsg, cmd.AnyScope, 0, OwnerFlag, "network", "line...",
+	))
+	if err != nil {
+		return err
+	}
+	a.extID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"admin",
+		"ext",
+		"Manages extensions, action is one of: list, load, unload, reload. Owner only.",
+		a,
+		cmd.Privmsg, cmd.AnyScope, 0, OwnerFlag, "action", "[name]",
+	))
+	if err != nil {
+		return err
+	}
+	a.rehashID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"admin",
+		"rehash",
+		"Reloads the config file and applies it to the extensions. Owner only.",
+		a,
+		cmd.Privmsg, cmd.AnyScope, 0, OwnerFlag,
+	))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Deinit the extension
+func (a *Admin) Deinit(b *bot.Bot) error {
+	ext.UnregisterCmd(b, a.doID)
+	ext.UnregisterCmd(b, a.doNetID)
+	ext.UnregisterCmd(b, a.extID)
+	ext.UnregisterCmd(b, a.rehashID)
+	return nil
+}
+
+// Cmd lets reflection hook up the commands, instead of doing it here.
+func (a *Admin) Cmd(_ string, _ irc.Writer, _ *cmd.Event) error {
+	return nil
+}
+
+// Do sends a raw line to the network the command was issued on.
+func (a *Admin) Do(w irc.Writer, ev *cmd.Event) error {
+	return a.sendRaw(w, ev, ev.NetworkID)
+}
+
+// Donet sends a raw line to the given network.
+func (a *Admin) Donet(w irc.Writer, ev *cmd.Event) error {
+	return a.sendRaw(w, ev, ev.Args["network"])
+}
+
+func (a *Admin) sendRaw(w irc.Writer, ev *cmd.Event, network string) error {
+	if !IsOwner(ev.StoredUser) {
+		return dispatch.MakeGlobalFlagsError(OwnerFlag)
+	}
+
+	nick := ev.Nick()
+	line := ev.Args["line"]
+	if len(line) == 0 {
+		w.Notice(nick, "\x02Admin:\x02 Nothing to send.")
+		return nil
+	}
+
+	target := a.b.NetworkWriter(network)
+	if target == nil {
+		w.Noticef(nick, "\x02Admin:\x02 No such network: %s", network)
+		return nil
+	}
+
+	a.b.Logger.Info("admin: raw line",
+		"user", ev.StoredUser.Username, "nick", nick,
+		"from", ev.NetworkID, "network", network, "line", line)
+
+	if err := target.Send(line); err != nil {
+		w.Noticef(nick, "\x02Admin:\x02 Failed to send: %v", err)
+	}
+	return nil
+}
+
+// Ext lists, loads, unloads and reloads extensions.
+func (a *Admin) Ext(w irc.Writer, ev *cmd.Event) error {
+	if !IsOwner(ev.StoredUser) {
+		return dispatch.MakeGlobalFlagsError(OwnerFlag)
+	}
+
+	nick := ev.Nick()
+	action := strings.ToLower(ev.Args["action"])
+	name := ev.Args["name"]
+
+	if action == "list" {
+		a.listExts(w, ev)
+		return nil
+	}
+
+	if len(name) == 0 {
+		w.Notice(nick, "\x02Admin:\x02 Usage: ext list|load|unload|reload <name>")
+		return nil
+	}
+
+	var err error
+	switch action {
+	case "load":
+		err = ext.Load(a.b, name)
+	case "unload":
+		if name == "admin" {
+			w.Notice(nick, "\x02Admin:\x02 Unloading admin would remove this command, use reload.")
+			return nil
+		}
+		err = ext.Unload(a.b, name)
+	case "reload":
+		err = ext.Reload(a.b, name)
+	default:
+		w.Notice(nick, "\x02Admin:\x02 Usage: ext list|load|unload|reload <name>")
+		return nil
+	}
+
+	a.b.Logger.Info("admin: ext",
+		"user", ev.StoredUser.Username, "nick", nick,
+		"action", action, "name", name, "err", err)
+
+	if err != nil {
+		w.Noticef(nick, "\x02Admin:\x02 Failed to %s %s: %v", action, name, err)
+		return nil
+	}
+
+	w.Noticef(nick, "\x02Admin:\x02 %sed %s.", action, name)
+	return nil
+}
+
+// Rehash reloads the config file and lets the extensions apply it.
+func (a *Admin) Rehash(w irc.Writer, ev *cmd.Event) error {
+	if !IsOwner(ev.StoredUser) {
+		return dispatch.MakeGlobalFlagsError(OwnerFlag)
+	}
+
+	nick := ev.Nick()
+	err := ext.Rehash(a.b)
+
+	a.b.Logger.Info("admin: rehash",
+		"user", ev.StoredUser.Username, "nick", nick, "err", err)
+
+	if err != nil {
+		w.Noticef(nick, "\x02Admin:\x02 Rehash failed: %v", err)
+		return nil
+	}
+
+	w.Notice(nick, "\x02Admin:\x02 Rehashed.")
+	return nil
+}
+
+func (a *Admin) listExts(w irc.Writer, ev *cmd.Event) {
+	var exts []string
+	for _, info := range ext.List() {
+		switch {
+		case !info.Loaded:
+			exts = append(exts, fmt.Sprintf("%s (unloaded)", info.Name))
+		case len(info.Cmds) == 0 && len(info.Handlers) == 0:
+			exts = append(exts, info.Name)
+		default:
+			exts = append(exts, fmt.Sprintf("%s [%s]",
+				info.Name, strings.Join(append(info.Cmds, info.Handlers...), ", ")))
+		}
+	}
+
+	ircmsg.Notify(a.b, w, ev.Event, ev.Nick(),
+		"\x02Admin:\x02 "+strings.Join(exts, "; "))
+}
+
+// IsOwner checks that the user has the owner flag globally, access given
+// for a single network or channel doesn't count.
+func IsOwner(user *data.StoredUser) bool {
+	return user != nil && user.HasFlags("", "", OwnerFlag)
+}
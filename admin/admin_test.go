@@ -0,0 +1,243 @@
+package admin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/internal/testbot"
+)
+
+const testConfig = `nick = "uq"
+altnick = "uq_"
+username = "uq"
+realname = "uq"
+noreconnect = true
+nostore = true
+[networks.test]
+	servers = ["irc.test.net"]
+`
+
+// counter counts how many times it's been loaded and unloaded.
+type counter struct {
+	inits, deinits int
+}
+
+func (c *counter) Init(*bot.Bot) error   { c.inits++; return nil }
+func (c *counter) Deinit(*bot.Bot) error { c.deinits++; return nil }
+
+var testExt = &counter{}
+
+func init() {
+	ext.RegisterExtension("admintest", testExt)
+}
+
+// newTestAdmin makes a bot from a config file so it can be rehashed and an
+// Admin to run the commands with.
+func newTestAdmin(t *testing.T) (*Admin, string) {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(filename, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := testbot.FromConfig(t, config.New().FromFile(filename))
+	testbot.Welcome(b, "test")
+
+	return &Admin{b: b}, filename
+}
+
+func newUser(t *testing.T, network string, flags ...string) *data.StoredUser {
+	t.Helper()
+
+	user, err := data.NewStoredUser("user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 0 {
+		user.Grant(network, "", 0, flags...)
+	}
+	return user
+}
+
+func newEvent(user *data.StoredUser, args map[string]string) *cmd.Event {
+	ev := irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG, "nick!user@host", "#chan", "")
+	return &cmd.Event{Event: ev, Args: args, StoredUser: user}
+}
+
+func TestIsOwner(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		user *data.StoredUser
+		want bool
+	}{
+		{"nobody", nil, false},
+		{"no flags", newUser(t, ""), false},
+		{"other flags", newUser(t, "", "o", "q"), false},
+		{"network owner", newUser(t, "test", OwnerFlag), false},
+		{"owner", newUser(t, "", OwnerFlag), true},
+	}
+
+	for _, test := range tests {
+		if got := IsOwner(test.user); got != test.want {
+			t.Errorf("%s: want %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestOwnerOnly(t *testing.T) {
+	a, _ := newTestAdmin(t)
+	want := dispatch.MakeGlobalFlagsError(OwnerFlag).Error()
+
+	commands := map[string]func(irc.Writer, *cmd.Event) error{
+		"do":     a.Do,
+		"donet":  a.Donet,
+		"ext":    a.Ext,
+		"rehash": a.Rehash,
+	}
+	args := map[string]string{"network": "test", "line": "QUIT", "action": "unload", "name": "admintest"}
+
+	for _, user := range []*data.StoredUser{nil, newUser(t, "", "o"), newUser(t, "test", OwnerFlag)} {
+		for name, fn := range commands {
+			var lines testbot.Lines
+			err := fn(irc.Helper{Writer: &lines}, newEvent(user, args))
+			if err == nil || err.Error() != want {
+				t.Errorf("%s: want the owner flag error, got %v", name, err)
+			}
+			if len(lines) != 0 {
+				t.Errorf("%s: want nothing sent for a non-owner, got %q", name, lines)
+			}
+		}
+	}
+
+	if !ext.List()[indexOf(t, "admintest")].Loaded {
+		t.Error("a non-owner shouldn't have unloaded admintest")
+	}
+}
+
+func indexOf(t *testing.T, name string) int {
+	t.Helper()
+	for i, info := range ext.List() {
+		if info.Name == name {
+			return i
+		}
+	}
+	t.Fatalf("%s isn't a registered extension", name)
+	return -1
+}
+
+func TestSendRaw(t *testing.T) {
+	a, _ := newTestAdmin(t)
+	owner := newUser(t, "", OwnerFlag)
+
+	tests := []struct {
+		name string
+		fn   func(irc.Writer, *cmd.Event) error
+		args map[string]string
+		want string
+	}{
+		{"do nothing", a.Do, map[string]string{}, "NOTICE nick :\x02Admin:\x02 Nothing to send."},
+		{"donet nothing", a.Donet, map[string]string{"network": "test"}, "NOTICE nick :\x02Admin:\x02 Nothing to send."},
+		{"donet unknown", a.Donet, map[string]string{"network": "nope", "line": "QUIT"},
+			"NOTICE nick :\x02Admin:\x02 No such network: nope"},
+	}
+
+	for _, test := range tests {
+		var lines testbot.Lines
+		if err := test.fn(irc.Helper{Writer: &lines}, newEvent(owner, test.args)); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if len(lines) != 1 || lines[0] != test.want {
+			t.Errorf("%s: want %q, got %q", test.name, test.want, lines)
+		}
+	}
+}
+
+func TestExt(t *testing.T) {
+	a, _ := newTestAdmin(t)
+	owner := newUser(t, "", OwnerFlag)
+
+	const usage = "NOTICE nick :\x02Admin:\x02 Usage: ext list|load|unload|reload <name>"
+	tests := []struct {
+		action, name string
+		want         string
+		loaded       bool
+	}{
+		{"load", "", usage, true},
+		{"bogus", "admintest", usage, true},
+		{"unload", "admin", "NOTICE nick :\x02Admin:\x02 Unloading admin would remove this command, use reload.", true},
+		{"unload", "admintest", "NOTICE nick :\x02Admin:\x02 unloaded admintest.", false},
+		{"unload", "admintest", "NOTICE nick :\x02Admin:\x02 Failed to unload admintest: admintest is not loaded", false},
+		{"LOAD", "admintest", "NOTICE nick :\x02Admin:\x02 loaded admintest.", true},
+		{"load", "admintest", "NOTICE nick :\x02Admin:\x02 Failed to load admintest: admintest is already loaded", true},
+		{"reload", "admintest", "NOTICE nick :\x02Admin:\x02 reloaded admintest.", true},
+		{"load", "nothere", "NOTICE nick :\x02Admin:\x02 Failed to load nothere: no such extension: nothere", true},
+	}
+
+	inits, deinits := testExt.inits, testExt.deinits
+	for _, test := range tests {
+		var lines testbot.Lines
+		args := map[string]string{"action": test.action, "name": test.name}
+		if err := a.Ext(irc.Helper{Writer: &lines}, newEvent(owner, args)); err != nil {
+			t.Errorf("%s %s: unexpected error: %v", test.action, test.name, err)
+		}
+		if len(lines) != 1 || lines[0] != test.want {
+			t.Errorf("%s %s: want %q, got %q", test.action, test.name, test.want, lines)
+		}
+		if loaded := ext.List()[indexOf(t, "admintest")].Loaded; loaded != test.loaded {
+			t.Errorf("%s %s: want loaded %v, got %v", test.action, test.name, test.loaded, loaded)
+		}
+	}
+
+	// unload, load, then reload's deinit and init.
+	if got := testExt.inits - inits; got != 2 {
+		t.Errorf("want 2 inits, got %d", got)
+	}
+	if got := testExt.deinits - deinits; got != 2 {
+		t.Errorf("want 2 deinits, got %d", got)
+	}
+
+	var lines testbot.Lines
+	if err := a.Ext(irc.Helper{Writer: &lines}, newEvent(owner, map[string]string{"action": "list"})); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || !strings.Contains(lines[0], "admin [admin.do, admin.donet, admin.ext, admin.rehash]") ||
+		!strings.Contains(lines[0], "; admintest") {
+		t.Errorf("want admin with its commands and admintest listed, got %q", lines)
+	}
+}
+
+func TestRehash(t *testing.T) {
+	a, filename := newTestAdmin(t)
+	owner := newUser(t, "", OwnerFlag)
+
+	var lines testbot.Lines
+	if err := a.Rehash(irc.Helper{Writer: &lines}, newEvent(owner, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "NOTICE nick :\x02Admin:\x02 Rehashed."; len(lines) != 1 || lines[0] != want {
+		t.Errorf("want %q, got %q", want, lines)
+	}
+
+	if err := os.WriteFile(filename, []byte("nick = "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lines = nil
+	if err := a.Rehash(irc.Helper{Writer: &lines}, newEvent(owner, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "NOTICE nick :\x02Admin:\x02 Rehash failed: ") {
+		t.Errorf("want the rehash to fail, got %q", lines)
+	}
+}
@@ -0,0 +1,226 @@
+package basics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+// batchWindow is how much sooner than it's due a mode can be given so that
+// it goes out on the same line as the one before it.
+const batchWindow = time.Second
+
+// ChanOwnerFlag puts people up as channel owners (+q). The mode's letter
+// can't be the flag since q exempts people from the queryer's limits and Q
+// lets them delete quotes.
+const ChanOwnerFlag = "n"
+
+// upFlags are the flags that put people up and the mode each one gives, in
+// order of rank.
+var upFlags = []struct {
+	flag string
+	mode byte
+}{
+	{ChanOwnerFlag, 'q'},
+	{"a", 'a'},
+	{"o", 'o'},
+	{"h", 'h'},
+	{"v", 'v'},
+}
+
+// upMode is the highest mode a user has a flag for that the network has and
+// the channel allows.
+func upMode(a *data.StoredUser, network, ch, prefix, allowed string) (byte, bool) {
+	if a == nil {
+		return 0, false
+	}
+
+	modes := prefixModes(prefix)
+	for _, up := range upFlags {
+		if strings.IndexByte(modes, up.mode) < 0 || strings.IndexByte(allowed, up.mode) < 0 {
+			continue
+		}
+		if a.HasFlags(network, ch, up.flag) {
+			return up.mode, true
+		}
+	}
+	return 0, false
+}
+
+// prefixModes returns the modes in an ISUPPORT PREFIX like (qaohv)~&@%+.
+func prefixModes(prefix string) string {
+	if !strings.HasPrefix(prefix, "(") {
+		return ""
+	}
+	if end := strings.IndexByte(prefix, ')'); end > 0 {
+		return prefix[1:end]
+	}
+	return ""
+}
+
+// modeChange is a mode and the nick or mask it's for.
+type modeChange struct {
+	mode byte
+	arg  string
+}
+
+// modeLines sets or unsets (sign + or -) the modes with as few MODE lines as
+// the server's MODES limit allows.
+func modeLines(ch string, sign byte, changes []modeChange, max int) []string {
+	if max <= 0 {
+		max = 1
+	}
+
+	var lines []string
+	for len(changes) != 0 {
+		n := max
+		if n > len(changes) {
+			n = len(changes)
+		}
+
+		modes := []byte{sign}
+		args := make([]string, n)
+		for i, c := range changes[:n] {
+			modes = append(modes, c.mode)
+			args[i] = c.arg
+		}
+		lines = append(lines, "MODE "+ch+" "+string(modes)+" "+strings.Join(args, " "))
+		changes = changes[n:]
+	}
+	return lines
+}
+
+type pendingUp struct {
+	nick string
+	mode byte
+	due  time.Time
+}
+
+// upQueue is a channel's people waiting to be put up.
+type upQueue struct {
+	network string
+	channel string
+	// maxModes is the server's MODES limit.
+	maxModes int
+	ups      []pendingUp
+	timer    *time.Timer
+}
+
+// upper puts people up after the channel's delay, batching the modes.
+type upper struct {
+	b *bot.Bot
+
+	mut    sync.Mutex
+	queues map[string]*upQueue
+}
+
+func newUpper(b *bot.Bot) *upper {
+	return &upper{b: b, queues: make(map[string]*upQueue)}
+}
+
+// add queues nick for mode after delay. Joining again while waiting doesn't
+// queue them twice.
+func (u *upper) add(ni *irc.NetworkInfo, network, ch, nick string, mode byte, delay time.Duration) {
+	key := strings.ToLower(network + " " + ch)
+
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	q, ok := u.queues[key]
+	if !ok {
+		q = &upQueue{network: network, channel: ch}
+		u.queues[key] = q
+	}
+	if ni != nil {
+		q.maxModes = ni.Modes()
+	}
+
+	for _, up := range q.ups {
+		if strings.EqualFold(up.nick, nick) {
+			return
+		}
+	}
+	q.ups = append(q.ups, pendingUp{nick: nick, mode: mode, due: time.Now().Add(delay)})
+
+	if q.timer == nil {
+		q.timer = time.AfterFunc(delay, func() { u.flush(key) })
+	}
+}
+
+// flush gives the modes that are due and waits for the rest.
+func (u *upper) flush(key string) {
+	network, ch, due, maxModes, ok := u.take(key, time.Now())
+	if !ok {
+		return
+	}
+
+	w := u.b.NetworkWriter(network)
+	if w == nil {
+		return
+	}
+	give(w, u.b.State(network), ch, due, maxModes)
+}
+
+// take removes the ups that are due by now, or will be within the batch
+// window, and waits for the rest.
+func (u *upper) take(key string, now time.Time) (network, ch string, due []pendingUp, maxModes int, ok bool) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	q, ok := u.queues[key]
+	if !ok {
+		return "", "", nil, 0, false
+	}
+
+	n := 0
+	for n < len(q.ups) && !q.ups[n].due.After(now.Add(batchWindow)) {
+		n++
+	}
+	due = q.ups[:n]
+	q.ups = q.ups[n:]
+
+	if len(q.ups) == 0 {
+		delete(u.queues, key)
+	} else {
+		q.timer = time.AfterFunc(q.ups[0].due.Sub(now), func() { u.flush(key) })
+	}
+	return q.network, q.channel, due, q.maxModes, true
+}
+
+// give the modes to the people who are still there and don't have them.
+// Without state everyone is given their mode.
+func give(w irc.Writer, state *data.State, ch string, ups []pendingUp, maxModes int) {
+	var changes []modeChange
+	for _, up := range ups {
+		if state != nil {
+			if !state.IsOn(up.nick, ch) {
+				continue
+			}
+			if modes, ok := state.UserModes(up.nick, ch); ok && modes.HasMode(rune(up.mode)) {
+				continue
+			}
+		}
+		changes = append(changes, modeChange{mode: up.mode, arg: up.nick})
+	}
+
+	for _, line := range modeLines(ch, '+', changes, maxModes) {
+		w.Send(line)
+	}
+}
+
+// stop forgets everyone waiting.
+func (u *upper) stop() {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	for key, q := range u.queues {
+		if q.timer != nil {
+			q.timer.Stop()
+		}
+		delete(u.queues, key)
+	}
+}
@@ -0,0 +1,218 @@
+package basics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/internal/testbot"
+)
+
+func TestModeLines(t *testing.T) {
+	t.Parallel()
+
+	changes := []modeChange{{'o', "a"}, {'v', "b"}, {'o', "c"}}
+
+	tests := []struct {
+		max  int
+		want []string
+	}{
+		{3, []string{"MODE #chan +ovo a b c"}},
+		{4, []string{"MODE #chan +ovo a b c"}},
+		{2, []string{"MODE #chan +ov a b", "MODE #chan +o c"}},
+		{0, []string{"MODE #chan +o a", "MODE #chan +v b", "MODE #chan +o c"}},
+	}
+
+	for _, test := range tests {
+		if got := modeLines("#chan", '+', changes, test.max); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d: want %q, got %q", test.max, test.want, got)
+		}
+	}
+
+	if got := modeLines("#chan", '-', nil, 3); len(got) != 0 {
+		t.Errorf("want no lines without changes, got %q", got)
+	}
+}
+
+func TestPrefixModes(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"(qaohv)~&@%+": "qaohv",
+		"(ov)@+":       "ov",
+		"":             "",
+		"ov@+":         "",
+		"(ov@+":        "",
+	}
+
+	for prefix, want := range tests {
+		if got := prefixModes(prefix); got != want {
+			t.Errorf("%s: want %q, got %q", prefix, want, got)
+		}
+	}
+}
+
+func TestUpMode(t *testing.T) {
+	t.Parallel()
+
+	user, err := data.NewStoredUser("user", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Grant("net", "#chan", 0, ChanOwnerFlag, "o", "v")
+	user.Grant("net", "#other", 0, "h")
+
+	const prefix = "(qaohv)~&@%+"
+	tests := []struct {
+		ch      string
+		prefix  string
+		allowed string
+		mode    byte
+		ok      bool
+	}{
+		{"#chan", prefix, "qaohv", 'q', true},
+		{"#chan", prefix, "aohv", 'o', true},
+		{"#chan", "(ohv)@%+", "qaohv", 'o', true},
+		{"#chan", prefix, "v", 'v', true},
+		{"#chan", prefix, "ah", 0, false},
+		{"#chan", "", "qaohv", 0, false},
+		{"#other", prefix, "qaohv", 'h', true},
+		{"#none", prefix, "qaohv", 0, false},
+	}
+
+	for _, test := range tests {
+		mode, ok := upMode(user, "net", test.ch, test.prefix, test.allowed)
+		if mode != test.mode || ok != test.ok {
+			t.Errorf("%s %s %s: want %c %v, got %c %v", test.ch, test.prefix, test.allowed,
+				test.mode, test.ok, mode, ok)
+		}
+	}
+
+	if _, ok := upMode(nil, "net", "#chan", prefix, "qaohv"); ok {
+		t.Error("want no mode for a user who isn't logged in")
+	}
+
+	quoter, err := data.NewStoredUser("quoter", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quoter.Grant("", "", 0, "Q", "q")
+	if mode, ok := upMode(quoter, "net", "#chan", prefix, "qaohv"); ok {
+		t.Errorf("the quoter's and queryer's flags shouldn't give modes, got %c", mode)
+	}
+}
+
+func TestUpperAdd(t *testing.T) {
+	t.Parallel()
+
+	u := newUpper(nil)
+	defer u.stop()
+
+	ni := irc.NewNetworkInfo()
+	u.add(ni, "net", "#Chan", "nick", 'o', time.Hour)
+	u.add(ni, "net", "#chan", "NICK", 'v', time.Hour)
+	u.add(nil, "net", "#chan", "other", 'v', time.Hour)
+
+	q, ok := u.queues["net #chan"]
+	if !ok {
+		t.Fatal("want a queue for the channel")
+	}
+	if len(q.ups) != 2 || q.ups[0].nick != "nick" || q.ups[0].mode != 'o' || q.ups[1].nick != "other" {
+		t.Errorf("want nick queued once and then other, got %v", q.ups)
+	}
+	if q.maxModes != ni.Modes() {
+		t.Errorf("want the network's MODES limit %d, got %d", ni.Modes(), q.maxModes)
+	}
+	if q.timer == nil {
+		t.Error("want a timer for the first up")
+	}
+
+	u.stop()
+	if len(u.queues) != 0 {
+		t.Errorf("want stop to forget everyone, got %v", u.queues)
+	}
+}
+
+func TestUpperTake(t *testing.T) {
+	t.Parallel()
+
+	u := newUpper(nil)
+	defer u.stop()
+
+	now := time.Now()
+	u.queues["net #chan"] = &upQueue{
+		network:  "net",
+		channel:  "#chan",
+		maxModes: 4,
+		ups: []pendingUp{
+			{nick: "a", mode: 'o', due: now.Add(-time.Second)},
+			{nick: "b", mode: 'v', due: now.Add(batchWindow / 2)},
+			{nick: "c", mode: 'v', due: now.Add(time.Hour)},
+		},
+	}
+
+	network, ch, due, maxModes, ok := u.take("net #chan", now)
+	if !ok || network != "net" || ch != "#chan" || maxModes != 4 {
+		t.Fatalf("want the queue's network, channel and limit, got %s %s %d %v", network, ch, maxModes, ok)
+	}
+	if len(due) != 2 || due[0].nick != "a" || due[1].nick != "b" {
+		t.Errorf("want the ups due within the batch window, got %v", due)
+	}
+
+	q, ok := u.queues["net #chan"]
+	if !ok || len(q.ups) != 1 || q.ups[0].nick != "c" || q.timer == nil {
+		t.Fatalf("want c left waiting on a timer, got %v", q)
+	}
+
+	_, _, due, _, ok = u.take("net #chan", now.Add(time.Hour))
+	if !ok || len(due) != 1 || due[0].nick != "c" {
+		t.Errorf("want c once due, got %v", due)
+	}
+	if _, ok := u.queues["net #chan"]; ok {
+		t.Error("want the queue gone once empty")
+	}
+	if _, _, _, _, ok := u.take("net #chan", now); ok {
+		t.Error("want nothing from a missing queue")
+	}
+}
+
+func TestGive(t *testing.T) {
+	t.Parallel()
+
+	ni := irc.NewNetworkInfo()
+	state, err := data.NewState(ni)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range []*irc.Event{
+		irc.NewEvent("net", ni, irc.RPL_WELCOME, "server", "bot", "Welcome bot!bot@bot.host"),
+		irc.NewEvent("net", ni, irc.JOIN, "bot!bot@bot.host", "#chan"),
+		irc.NewEvent("net", ni, irc.JOIN, "a!a@a.host", "#chan"),
+		irc.NewEvent("net", ni, irc.JOIN, "b!b@b.host", "#chan"),
+		irc.NewEvent("net", ni, irc.JOIN, "c!c@c.host", "#chan"),
+		irc.NewEvent("net", ni, irc.MODE, "bot!bot@bot.host", "#chan", "+o", "b"),
+	} {
+		state.Update(ev)
+	}
+
+	ups := []pendingUp{
+		{nick: "a", mode: 'o'},
+		{nick: "b", mode: 'o'},
+		{nick: "c", mode: 'v'},
+		{nick: "gone", mode: 'v'},
+	}
+
+	var lines testbot.Lines
+	give(irc.Helper{Writer: &lines}, state, "#chan", ups, 3)
+	if want := []string{"MODE #chan +ov a c"}; !reflect.DeepEqual([]string(lines), want) {
+		t.Errorf("want modes only for people there without them %q, got %q", want, lines)
+	}
+
+	lines = nil
+	give(irc.Helper{Writer: &lines}, nil, "#chan", ups, 2)
+	if want := []string{"MODE #chan +oo a b", "MODE #chan +vv c gone"}; !reflect.DeepEqual([]string(lines), want) {
+		t.Errorf("want everyone given their mode without state %q, got %q", want, lines)
+	}
+}
@@ -0,0 +1,258 @@
+package basics
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/uq/ext"
+)
+
+const (
+	// bansKey is where a channel's timed bans are kept in the store.
+	bansKey = "timedbans"
+	// banCheck is how often expired bans are looked for.
+	banCheck = 30 * time.Second
+	// defaultModes is the MODES limit used until the network's is known,
+	// it's what the rfc says servers must allow.
+	defaultModes = 3
+)
+
+// timedBan is a ban the bot lifts when it expires. Quiets are timed bans
+// with another mode.
+type timedBan struct {
+	Mask string `json:"mask"`
+	Mode string `json:"mode,omitempty"`
+	// Nick is who was banned if it was by nick, so they can be unbanned by
+	// nick after they've left.
+	Nick    string    `json:"nick,omitempty"`
+	Expires time.Time `json:"expires"`
+	By      string    `json:"by"`
+}
+
+// mode is b unless it's a quiet.
+func (t timedBan) mode() byte {
+	if len(t.Mode) == 0 {
+		return 'b'
+	}
+	return t.Mode[0]
+}
+
+type banChannel struct {
+	network string
+	channel string
+}
+
+// banTimer lifts timed bans. They're saved on the stored channel so a
+// restart doesn't leave them in place forever.
+type banTimer struct {
+	b *bot.Bot
+
+	mut  sync.Mutex
+	bans map[banChannel][]timedBan
+	// modes is each network's MODES limit, from the last command used on it.
+	modes map[string]int
+	done  chan struct{}
+}
+
+func newBanTimer(b *bot.Bot) *banTimer {
+	return &banTimer{
+		b:     b,
+		bans:  make(map[banChannel][]timedBan),
+		modes: make(map[string]int),
+		done:  make(chan struct{}),
+	}
+}
+
+// load the timed bans from the store and start lifting them.
+func (t *banTimer) load() error {
+	if store := t.b.Store(); store != nil {
+		channels, err := store.Channels()
+		if err != nil {
+			return err
+		}
+
+		t.mut.Lock()
+		for _, ch := range channels {
+			var bans []timedBan
+			if ok, err := ch.GetJSON(bansKey, &bans); ok && err == nil && len(bans) != 0 {
+				t.bans[banChannel{ch.NetID, strings.ToLower(ch.Name)}] = bans
+			}
+		}
+		t.mut.Unlock()
+	}
+
+	go t.run()
+	return nil
+}
+
+func (t *banTimer) run() {
+	ticker := time.NewTicker(banCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.lift()
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *banTimer) stop() {
+	close(t.done)
+}
+
+// setModes remembers a network's MODES limit for lifting bans on it.
+func (t *banTimer) setModes(network string, modes int) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.modes[network] = modes
+}
+
+// add timed bans, banning the same mask again replaces it.
+func (t *banTimer) add(network, channel string, bans []timedBan) error {
+	key := banChannel{network, strings.ToLower(channel)}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	list := t.bans[key]
+	for _, ban := range bans {
+		list = append(without(list, ban.mode(), ban.Mask), ban)
+	}
+	t.bans[key] = list
+	return t.save(key, channel)
+}
+
+// remove the timers of the masks' bans, when they're unbanned by hand.
+func (t *banTimer) remove(network, channel string, mode byte, masks []string) error {
+	key := banChannel{network, strings.ToLower(channel)}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	list, ok := t.bans[key]
+	if !ok {
+		return nil
+	}
+	for _, mask := range masks {
+		list = without(list, mode, mask)
+	}
+	t.bans[key] = list
+	return t.save(key, channel)
+}
+
+// masksFor returns the masks of the nick's timed bans in the channel.
+func (t *banTimer) masksFor(network, channel string, mode byte, nick string) []string {
+	key := banChannel{network, strings.ToLower(channel)}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	var masks []string
+	for _, ban := range t.bans[key] {
+		if ban.mode() == mode && strings.EqualFold(ban.Nick, nick) {
+			masks = append(masks, ban.Mask)
+		}
+	}
+	return masks
+}
+
+// lift the expired bans on the channels the bot is on.
+func (t *banTimer) lift() {
+	now := time.Now()
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	for key, list := range t.bans {
+		w := t.b.NetworkWriter(key.network)
+		if w == nil {
+			continue
+		}
+		if state := t.b.State(key.network); state != nil && !state.IsOn(state.Self().Nick(), key.channel) {
+			continue
+		}
+
+		var expired []modeChange
+		var left []timedBan
+		for _, ban := range list {
+			if now.Before(ban.Expires) {
+				left = append(left, ban)
+			} else {
+				expired = append(expired, modeChange{mode: ban.mode(), arg: ban.Mask})
+			}
+		}
+		if len(expired) == 0 {
+			continue
+		}
+
+		for _, line := range modeLines(key.channel, '-', expired, t.maxModes(key.network)) {
+			w.Send(line)
+		}
+		t.bans[key] = left
+		if err := t.save(key, key.channel); err != nil {
+			t.b.Logger.Error("failed to save timed bans", "network", key.network,
+				"channel", key.channel, "err", err)
+		}
+	}
+}
+
+// maxModes must be called with mut held.
+func (t *banTimer) maxModes(network string) int {
+	if n, ok := t.modes[network]; ok && n > 0 {
+		return n
+	}
+	return defaultModes
+}
+
+// save must be called with mut held.
+func (t *banTimer) save(key banChannel, channel string) error {
+	list := t.bans[key]
+	if len(list) == 0 {
+		delete(t.bans, key)
+	}
+
+	return ext.UpdateChannel(t.b, key.network, channel, func(ch *data.StoredChannel) error {
+		if len(list) == 0 {
+			delete(ch.JSONStorer, bansKey)
+			return nil
+		}
+		return ch.PutJSON(bansKey, list)
+	})
+}
+
+func without(bans []timedBan, mode byte, mask string) []timedBan {
+	var kept []timedBan
+	for _, ban := range bans {
+		if ban.mode() != mode || !strings.EqualFold(ban.Mask, mask) {
+			kept = append(kept, ban)
+		}
+	}
+	return kept
+}
+
+// parseBanDuration parses a duration that can also be in days or weeks, like
+// 2d or 1w.
+func parseBanDuration(s string) (time.Duration, bool) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+
+	if unit != 0 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		return time.Duration(n) * unit, err == nil && n > 0
+	}
+
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
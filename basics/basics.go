@@ -2,45 +2,134 @@ package basics
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/aarondl/ultimateq/bot"
-	"github.com/aarondl/ultimateq/data"
 	"github.com/aarondl/ultimateq/dispatch"
 	"github.com/aarondl/ultimateq/dispatch/cmd"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/settings"
 )
 
 func init() {
-	bot.RegisterExtension("basics", &Handler{})
+	ext.RegisterExtension("basics", &Handler{})
+	settings.Define("basics", settings.Option{
+		Name:    "autoop",
+		Type:    settings.BoolType,
+		Default: "true",
+		Desc:    "Put users with the Q, a, o, h or v flag up when they join.",
+	}, settings.Option{
+		Name:    "autoop_delay",
+		Type:    settings.DurationType,
+		Default: "0s",
+		Desc:    "How long to wait before putting people up, anyone who leaves or gets the mode in that time is skipped. Helps with netsplits.",
+	}, settings.Option{
+		Name:    "autoop_modes",
+		Default: "qaohv",
+		Desc:    "The modes auto-up may give in the channel, from owner q and admin a to o, h and v.",
+	}, settings.Option{
+		Name:    "ban_mask",
+		Default: "host",
+		Desc:    "How nicks are banned: host bans *!*@host, user bans *!*user@host and nick bans nick!*@*.",
+	}, settings.Option{
+		Name:    "ban_duration",
+		Type:    settings.DurationType,
+		Default: "0s",
+		Desc:    "How long bans last when no time is given, 0s is until they're lifted by hand.",
+	}, settings.Option{
+		Name:    "flood",
+		Type:    settings.BoolType,
+		Default: "false",
+		Desc:    "Protect the channel from floods. Users with any flag or a mode like voice are exempt.",
+	}, settings.Option{
+		Name:    "flood_lines",
+		Default: "5/10s",
+		Desc:    "How many lines someone can say in a time, like 5/10s. 0/10s turns it off.",
+	}, settings.Option{
+		Name:    "flood_repeats",
+		Type:    settings.IntType,
+		Default: "3",
+		Desc:    "How many times in a row someone can say the same line in a minute, 0 turns it off.",
+	}, settings.Option{
+		Name:    "flood_highlights",
+		Type:    settings.IntType,
+		Default: "6",
+		Desc:    "How many people one line can mention, 0 turns it off.",
+	}, settings.Option{
+		Name:    "flood_joins",
+		Default: "4/60s",
+		Desc:    "How many times someone can join or part in a time, like 4/60s. 0/60s turns it off.",
+	}, settings.Option{
+		Name:    "flood_actions",
+		Default: "warn,quiet,kick,ban",
+		Desc:    "What's done to flooders, a step further each time: warn, quiet, kick or ban. The last step repeats.",
+	}, settings.Option{
+		Name:    "flood_ban",
+		Type:    settings.DurationType,
+		Default: "10m",
+		Desc:    "How long flood quiets and bans last, 0s is until they're lifted by hand.",
+	}, settings.Option{
+		Name:    "flood_reset",
+		Type:    settings.DurationType,
+		Default: "30m",
+		Desc:    "How long someone has to behave before their next flood starts back at the first action.",
+	}, settings.Option{
+		Name: "flood_log",
+		Desc: "A channel to report flood actions to, like #ops.",
+	}, settings.Option{
+		Name: "flood_quiet",
+		Desc: `The mode a quiet sets and a prefix for its mask if it needs one, like "q" or "b ~q:". ` +
+			"Unset works it out from what the network supports.",
+	})
 }
 
 // Handler extension
 type Handler struct {
 	b                *bot.Bot
+	up               *upper
+	bans             *banTimer
+	flood            *flooder
 	privmsgHandlerID uint64
 	joinHandlerID    uint64
+	partHandlerID    uint64
 	opID             uint64
 	pingID           uint64
+	modIDs           []uint64
 }
 
 // Init the extension
 func (h *Handler) Init(b *bot.Bot) error {
 	h.b = b
+	h.up = newUpper(b)
+	h.bans = newBanTimer(b)
+	h.flood = newFlooder(b, h.bans)
+
+	h.privmsgHandlerID = ext.Register(b, "", "", irc.PRIVMSG, h)
+	h.joinHandlerID = ext.Register(b, "", "", irc.JOIN, h)
+	h.partHandlerID = ext.Register(b, "", "", irc.PART, h)
+
+	// fail stops the timers the handlers may have started already when the
+	// rest can't be set up.
+	fail := func(err error) error {
+		h.up.stop()
+		h.bans.stop()
+		return err
+	}
 
-	h.privmsgHandlerID = b.Register("", "", irc.PRIVMSG, h)
-	h.joinHandlerID = b.Register("", "", irc.JOIN, h)
 	var err error
-	h.opID, err = b.RegisterCmd("", "", cmd.NewAuthed(
+	h.opID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
 		"basics",
 		"upme",
-		"Ops or voices a user if they have o or v flags respectively.",
+		"Gives a user the highest of the q, a, o, h or v modes they have a "+
+			"flag for. Owners need the "+ChanOwnerFlag+" flag.",
 		h,
 		cmd.Privmsg, cmd.AnyScope, 0, "", "#chan",
 	))
 	if err != nil {
-		return err
+		return fail(err)
 	}
-	h.pingID, err = b.RegisterCmd("", "", cmd.New(
+	h.pingID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"basics",
 		"ping",
 		"Responds to ping commands",
@@ -48,18 +137,30 @@ func (h *Handler) Init(b *bot.Bot) error {
 		cmd.Privmsg, cmd.AnyScope,
 	))
 	if err != nil {
-		return err
+		return fail(err)
+	}
+	if err = h.registerModeration(b); err != nil {
+		return fail(err)
 	}
 
+	if err = h.bans.load(); err != nil {
+		return fail(err)
+	}
 	return nil
 }
 
 // Deinit the extension
 func (h *Handler) Deinit(b *bot.Bot) error {
-	b.Unregister(h.joinHandlerID)
-	b.Unregister(h.privmsgHandlerID)
-	b.UnregisterCmd(h.opID)
-	b.UnregisterCmd(h.pingID)
+	ext.Unregister(b, h.joinHandlerID)
+	ext.Unregister(b, h.partHandlerID)
+	ext.Unregister(b, h.privmsgHandlerID)
+	ext.UnregisterCmd(b, h.opID)
+	ext.UnregisterCmd(b, h.pingID)
+	for _, id := range h.modIDs {
+		ext.UnregisterCmd(b, id)
+	}
+	h.up.stop()
+	h.bans.stop()
 	return nil
 }
 
@@ -75,45 +176,56 @@ func (h *Handler) Ping(w irc.Writer, ev *cmd.Event) error {
 	return nil
 }
 
-// Up lets a user with proper access voice/op themselves.
-func (h *Handler) Up(w irc.Writer, ev *cmd.Event) error {
-	user := ev.StoredUser
+// Upme lets a user with proper access put themselves up straight away.
+func (h *Handler) Upme(w irc.Writer, ev *cmd.Event) error {
 	ch := ev.TargetChannel
 	if ch == nil {
 		return errors.New("Must be a channel that the bot is on")
 	}
-	chname := ch.Name
 
-	if !putPeopleUp(ev.Event, chname, user, w) {
-		return dispatch.MakeFlagsError("ov")
+	mode, ok := upMode(ev.StoredUser, ev.NetworkID, ch.Name,
+		ev.NetworkInfo.Prefix(), prefixModes(ev.NetworkInfo.Prefix()))
+	if !ok {
+		return dispatch.MakeFlagsError(upFlagList())
 	}
+	w.Sendf("MODE %s +%c :%s", ch.Name, mode, ev.Nick())
 	return nil
 }
 
-// Handle to check for join messages to auto-op auto-voice people on
+// Handle watches for floods and auto-ops and auto-voices people on join
 func (h *Handler) Handle(w irc.Writer, ev *irc.Event) {
-	if ev.Name == irc.JOIN {
-		store := h.b.Store()
-		a := store.AuthedUser(ev.NetworkID, ev.Sender)
-		ch := ev.Target()
-		putPeopleUp(ev, ch, a, w)
+	switch ev.Name {
+	case irc.PRIVMSG:
+		h.flood.message(w, ev)
+	case irc.JOIN:
+		h.flood.join(w, ev)
+		h.autoUp(ev)
+	case irc.PART:
+		h.flood.join(w, ev)
 	}
 }
 
-func putPeopleUp(ev *irc.Event, ch string,
-	a *data.StoredUser, w irc.Writer) (did bool) {
-	if a == nil {
-		return false
+func (h *Handler) autoUp(ev *irc.Event) {
+	network, ch := ev.NetworkID, ev.Target()
+	if !settings.Bool(h.b, network, ch, "basics", "autoop") {
+		return
 	}
 
-	nick := ev.Nick()
-	if a.HasFlags(ev.NetworkID, ch, "o") {
-		w.Sendf("MODE %s +o :%s", ch, nick)
-		return true
-	} else if a.HasFlags(ev.NetworkID, ch, "v") {
-		w.Sendf("MODE %s +v :%s", ch, nick)
-		return true
+	a := h.b.Store().AuthedUser(network, ev.Sender)
+	allowed := settings.String(h.b, network, ch, "basics", "autoop_modes")
+	mode, ok := upMode(a, network, ch, ev.NetworkInfo.Prefix(), allowed)
+	if !ok {
+		return
 	}
 
-	return false
+	delay := settings.Duration(h.b, network, ch, "basics", "autoop_delay")
+	h.up.add(ev.NetworkInfo, network, ch, ev.Nick(), mode, delay)
+}
+
+func upFlagList() string {
+	var flags strings.Builder
+	for _, up := range upFlags {
+		flags.WriteString(up.flag)
+	}
+	return flags.String()
 }
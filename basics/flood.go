@@ -0,0 +1,373 @@
+package basics
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/settings"
+)
+
+const (
+	// repeatWindow is how long a line counts towards repeats.
+	repeatWindow = time.Minute
+	// floodPrune is how often people who've gone quiet are forgotten.
+	floodPrune = 5 * time.Minute
+	// anyFlag is every flag, for finding users with any access at all.
+	anyFlag = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+// floodUser is what's known about a host in a channel.
+type floodUser struct {
+	lines   []time.Time
+	joins   []time.Time
+	last    string
+	lastAt  time.Time
+	repeats int
+
+	offenses  int
+	offenseAt time.Time
+	seen      time.Time
+}
+
+// flooder watches channels for floods and punishes them with the channel's
+// flood_actions, one step further each time within flood_reset.
+type flooder struct {
+	b    *bot.Bot
+	bans *banTimer
+
+	mut    sync.Mutex
+	users  map[string]*floodUser
+	pruned time.Time
+}
+
+func newFlooder(b *bot.Bot, bans *banTimer) *flooder {
+	return &flooder{b: b, bans: bans, users: make(map[string]*floodUser)}
+}
+
+// message checks a channel message for line floods, repeats and mass
+// highlights.
+func (f *flooder) message(w irc.Writer, ev *irc.Event) {
+	network, ch := ev.NetworkID, ev.Target()
+	if !ev.IsTargetChan() || !f.watching(ev, ch) {
+		return
+	}
+
+	count, period := f.rate(network, ch, "flood_lines")
+	maxRepeats := settings.Int(f.b, network, ch, "basics", "flood_repeats")
+	maxHighlights := settings.Int(f.b, network, ch, "basics", "flood_highlights")
+	highlights := f.highlights(network, ch, ev.Message())
+
+	now := time.Now()
+	line := strings.ToLower(strings.Join(strings.Fields(ev.Message()), " "))
+
+	reason := ""
+	offense := f.track(network, ch, ev.Hostname(), now, func(u *floodUser) bool {
+		u.lines = append(within(u.lines, now, period), now)
+
+		if line == u.last && now.Sub(u.lastAt) < repeatWindow {
+			u.repeats++
+		} else {
+			u.last, u.repeats = line, 1
+		}
+		u.lastAt = now
+
+		switch {
+		case count > 0 && len(u.lines) > count:
+			reason = "flooding"
+		case maxRepeats > 0 && u.repeats >= maxRepeats:
+			reason = "repeating yourself"
+		case maxHighlights > 0 && highlights >= maxHighlights:
+			reason = "mass highlighting"
+		}
+		return len(reason) != 0
+	})
+
+	if offense > 0 {
+		f.punish(w, ev, ch, reason, offense)
+	}
+}
+
+// join checks joins and parts for join floods.
+func (f *flooder) join(w irc.Writer, ev *irc.Event) {
+	network, ch := ev.NetworkID, ev.Target()
+	if !f.watching(ev, ch) {
+		return
+	}
+
+	count, period := f.rate(network, ch, "flood_joins")
+	if count <= 0 {
+		return
+	}
+
+	now := time.Now()
+	offense := f.track(network, ch, ev.Hostname(), now, func(u *floodUser) bool {
+		u.joins = append(within(u.joins, now, period), now)
+		return len(u.joins) > count
+	})
+	if offense > 0 {
+		f.punish(w, ev, ch, "join flooding", offense)
+	}
+}
+
+// track updates a host's counts with fn and, if fn says they've offended,
+// returns which offense it is. Their counts start over after each offense so
+// one flood isn't punished for every line in it.
+func (f *flooder) track(network, ch, host string, now time.Time, fn func(*floodUser) bool) int {
+	key := strings.ToLower(network + " " + ch + " " + host)
+
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	if now.Sub(f.pruned) > floodPrune {
+		f.prune(now)
+	}
+
+	u, ok := f.users[key]
+	if !ok {
+		u = &floodUser{}
+		f.users[key] = u
+	}
+	u.seen = now
+	if !fn(u) {
+		return 0
+	}
+
+	reset := settings.Duration(f.b, network, ch, "basics", "flood_reset")
+	if reset > 0 && now.Sub(u.offenseAt) > reset {
+		u.offenses = 0
+	}
+	u.offenses++
+	u.offenseAt = now
+	u.lines, u.joins, u.last, u.repeats = nil, nil, "", 0
+	return u.offenses
+}
+
+// prune must be called with mut held.
+func (f *flooder) prune(now time.Time) {
+	f.pruned = now
+	for key, u := range f.users {
+		if now.Sub(u.seen) > floodPrune && now.Sub(u.offenseAt) > floodPrune {
+			delete(f.users, key)
+		}
+	}
+}
+
+// punish takes the step of the channel's actions for the offense, the last
+// step is repeated once they run out.
+func (f *flooder) punish(w irc.Writer, ev *irc.Event, ch, reason string, offense int) {
+	var actions []string
+	for _, a := range strings.Split(settings.String(f.b, ev.NetworkID, ch, "basics", "flood_actions"), ",") {
+		if a = strings.ToLower(strings.TrimSpace(a)); len(a) != 0 {
+			actions = append(actions, a)
+		}
+	}
+	if len(actions) == 0 {
+		return
+	}
+	if offense > len(actions) {
+		offense = len(actions)
+	}
+	f.act(w, ev, ch, reason, actions[offense-1])
+}
+
+func (f *flooder) act(w irc.Writer, ev *irc.Event, ch, reason, action string) {
+	network, nick := ev.NetworkID, ev.Nick()
+	mask := banMask(irc.Host(ev.Sender), settings.String(f.b, network, ch, "basics", "ban_mask"))
+	duration := settings.Duration(f.b, network, ch, "basics", "flood_ban")
+	maxModes := 0
+	if ev.NetworkInfo != nil {
+		maxModes = ev.NetworkInfo.Modes()
+	}
+
+	switch action {
+	case "warn":
+		w.Noticef(nick, "\x02Flood:\x02 Please stop %s in %s.", reason, ch)
+	case "quiet":
+		mode, prefix, err := quietMode(settings.String(f.b, network, ch, "basics", "flood_quiet"), ev.NetworkInfo)
+		if err != nil {
+			f.b.Logger.Error("can't quiet flooder", "network", network, "channel", ch, "err", err)
+			return
+		}
+		f.timedMode(w, network, ch, mode, prefix+mask, duration, maxModes)
+	case "kick":
+		kick(w, ev, ch, reason)
+	case "ban":
+		f.timedMode(w, network, ch, 'b', mask, duration, maxModes)
+		kick(w, ev, ch, reason)
+	default:
+		f.b.Logger.Error("unknown flood action", "network", network, "channel", ch, "action", action)
+		return
+	}
+
+	f.b.Logger.Info("flood action", "network", network, "channel", ch,
+		"action", action, "user", ev.Sender, "reason", reason)
+	if ops := settings.String(f.b, network, ch, "basics", "flood_log"); len(ops) != 0 {
+		w.Privmsgf(ops, "\x02Flood:\x02 %s %s (%s) in %s for %s.", action, nick, mask, ch, reason)
+	}
+}
+
+// kick the sender unless they parted already.
+func kick(w irc.Writer, ev *irc.Event, ch, reason string) {
+	if ev.Name != irc.PART {
+		w.Sendf("KICK %s %s :Stop %s", ch, ev.Nick(), reason)
+	}
+}
+
+// timedMode sets mode on mask and lifts it after duration.
+func (f *flooder) timedMode(w irc.Writer, network, ch string, mode byte, mask string, duration time.Duration, maxModes int) {
+	for _, line := range modeLines(ch, '+', []modeChange{{mode: mode, arg: mask}}, maxModes) {
+		w.Send(line)
+	}
+	if duration <= 0 {
+		return
+	}
+
+	if maxModes > 0 {
+		f.bans.setModes(network, maxModes)
+	}
+	ban := timedBan{Mask: mask, Expires: time.Now().Add(duration), By: "flood protection"}
+	if mode != 'b' {
+		ban.Mode = string(mode)
+	}
+	if err := f.bans.add(network, ch, []timedBan{ban}); err != nil {
+		f.b.Logger.Error("failed to save timed ban", "network", network, "channel", ch, "err", err)
+	}
+}
+
+// watching is true if flood protection is on in the channel and the sender
+// isn't exempt: the bot, users with any flag and anyone with a prefix mode
+// are left alone.
+func (f *flooder) watching(ev *irc.Event, ch string) bool {
+	network := ev.NetworkID
+	if !settings.Bool(f.b, network, ch, "basics", "flood") {
+		return false
+	}
+
+	if store := f.b.Store(); store != nil {
+		if a := store.AuthedUser(network, ev.Sender); a != nil && a.Has(network, ch, 0, anyFlag) {
+			return false
+		}
+	}
+
+	state := f.b.State(network)
+	if state == nil {
+		return true
+	}
+	if strings.EqualFold(ev.Nick(), state.Self().Nick()) {
+		return false
+	}
+	if ev.NetworkInfo != nil {
+		if modes, ok := state.UserModes(ev.Nick(), ch); ok {
+			for _, m := range prefixModes(ev.NetworkInfo.Prefix()) {
+				if modes.HasMode(m) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// highlights counts the different nicks in the channel a message mentions.
+func (f *flooder) highlights(network, ch, msg string) int {
+	state := f.b.State(network)
+	if state == nil {
+		return 0
+	}
+
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(msg) {
+		word = strings.Trim(word, ",:;.!?@+")
+		lower := strings.ToLower(word)
+		if len(word) == 0 || seen[lower] {
+			continue
+		}
+		if state.IsOn(word, ch) {
+			seen[lower] = true
+		}
+	}
+	return len(seen)
+}
+
+// rate reads a setting like 5/10s, 0 lines turns the check off.
+func (f *flooder) rate(network, ch, name string) (int, time.Duration) {
+	count, period, ok := parseRate(settings.String(f.b, network, ch, "basics", name))
+	if !ok {
+		f.b.Logger.Error("bad flood rate setting", "network", network, "channel", ch, "setting", name)
+		return 0, 0
+	}
+	return count, period
+}
+
+// parseRate parses count/period, like 5/10s.
+func parseRate(s string) (int, time.Duration, bool) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || count < 0 {
+		return 0, 0, false
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return 0, 0, false
+	}
+	return count, period, true
+}
+
+// quietMode parses flood_quiet, a mode with an optional mask prefix like
+// "q" or "b ~q:". When it's empty the quiet is worked out from the network:
+// q if it's a list mode, since on some networks it's the owner prefix, or
+// else a ban with the network's q extban.
+func quietMode(s string, info *irc.NetworkInfo) (byte, string, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return networkQuiet(info)
+	}
+	if len(fields) > 2 || len(fields[0]) != 1 {
+		return 0, "", fmt.Errorf("bad flood_quiet setting: %q", s)
+	}
+
+	mode := fields[0][0]
+	if info != nil && strings.IndexByte(prefixModes(info.Prefix()), mode) >= 0 {
+		return 0, "", fmt.Errorf("flood_quiet mode %c is a prefix mode on this network", mode)
+	}
+	prefix := ""
+	if len(fields) == 2 {
+		prefix = fields[1]
+	}
+	return mode, prefix, nil
+}
+
+func networkQuiet(info *irc.NetworkInfo) (byte, string, error) {
+	if info == nil {
+		return 0, "", errors.New("the network's modes aren't known yet")
+	}
+
+	listModes := strings.SplitN(info.Chanmodes(), ",", 2)[0]
+	if strings.IndexByte(listModes, 'q') >= 0 && strings.IndexByte(prefixModes(info.Prefix()), 'q') < 0 {
+		return 'q', "", nil
+	}
+
+	// EXTBAN is the extban prefix and the types, like ~,qjncrRa.
+	if ext := strings.SplitN(info.Extra("EXTBAN"), ",", 2); len(ext) == 2 && strings.IndexByte(ext[1], 'q') >= 0 {
+		return 'b', ext[0] + "q:", nil
+	}
+	return 0, "", errors.New("the network has no quiet mode, set flood_quiet")
+}
+
+// within drops the times older than period.
+func within(times []time.Time, now time.Time, period time.Duration) []time.Time {
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= period {
+		i++
+	}
+	return times[i:]
+}
@@ -0,0 +1,54 @@
+package basics
+
+import (
+	"testing"
+
+	"github.com/aarondl/ultimateq/irc"
+)
+
+func networkInfo(isupport ...string) *irc.NetworkInfo {
+	info := irc.NewNetworkInfo()
+	args := append([]string{"uq"}, isupport...)
+	info.ParseISupport(irc.NewEvent("net", info, irc.RPL_ISUPPORT, "irc.test.net", args...))
+	return info
+}
+
+func TestQuietMode(t *testing.T) {
+	t.Parallel()
+
+	charybdis := networkInfo("PREFIX=(ov)@+", "CHANMODES=eIbq,k,flj,CFLMPQScgimnprstz")
+	unreal := networkInfo("PREFIX=(qaohv)~&@%+", "CHANMODES=beI,kLf,l,psmntirzMQNRTOVKDdGPZSCc", "EXTBAN=~,qjncrRa")
+	inspircd := networkInfo("PREFIX=(qaohv)~&@%+", "CHANMODES=IXbeg,k,FHJLfjl,ACKMNOPQRSTUcimnprstz", "EXTBAN=,ACNOQRSTUacjmprsz")
+
+	tests := []struct {
+		setting string
+		info    *irc.NetworkInfo
+		mode    byte
+		prefix  string
+		err     bool
+	}{
+		{"", charybdis, 'q', "", false},
+		{"", unreal, 'b', "~q:", false},
+		{"", inspircd, 0, "", true},
+		{"", nil, 0, "", true},
+		{"q", charybdis, 'q', "", false},
+		{"q", unreal, 0, "", true},
+		{"b m:", inspircd, 'b', "m:", false},
+		{"bq", charybdis, 0, "", true},
+	}
+
+	for i, test := range tests {
+		mode, prefix, err := quietMode(test.setting, test.info)
+		if test.err {
+			if err == nil {
+				t.Errorf("%d: want an error, got %c %q", i, mode, prefix)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+		} else if mode != test.mode || prefix != test.prefix {
+			t.Errorf("%d: want %c %q, got %c %q", i, test.mode, test.prefix, mode, prefix)
+		}
+	}
+}
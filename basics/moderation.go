@@ -0,0 +1,385 @@
+package basics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/dispatch"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/settings"
+)
+
+// ModFlag is the channel flag needed for the moderation commands.
+const ModFlag = "o"
+
+var modCommands = []struct {
+	name string
+	desc string
+	args []string
+}{
+	{"op", "Ops the nicks given, or you.", []string{"#chan", "nicks..."}},
+	{"deop", "Deops the nicks given, or you.", []string{"#chan", "nicks..."}},
+	{"voice", "Voices the nicks given, or you.", []string{"#chan", "nicks..."}},
+	{"devoice", "Devoices the nicks given, or you.", []string{"#chan", "nicks..."}},
+	{"kick", "Kicks nicks, separated by commas.", []string{"#chan", "nicks", "reason..."}},
+	{"ban", "Bans nicks or masks, separated by commas, for a time like 30m or 2d " +
+		"if one's given. Nicks are banned by host.", []string{"#chan", "targets", "[duration]"}},
+	{"kickban", "Bans and kicks nicks, separated by commas. The reason can start " +
+		"with a time like 30m or 2d to lift the ban after.", []string{"#chan", "nicks", "reason..."}},
+	{"unban", "Unbans nicks or masks, separated by commas.", []string{"#chan", "targets"}},
+	{"topic", "Sets the topic, or shows it if there's no new one.", []string{"#chan", "topic..."}},
+	{"mode", "Sets channel modes.", []string{"#chan", "modes..."}},
+}
+
+// registerModeration adds the moderation commands.
+func (h *Handler) registerModeration(b *bot.Bot) error {
+	for _, c := range modCommands {
+		id, err := ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+			"basics",
+			c.name,
+			c.desc,
+			h,
+			cmd.Privmsg, cmd.AnyScope, 0, ModFlag, c.args...,
+		))
+		if err != nil {
+			return err
+		}
+		h.modIDs = append(h.modIDs, id)
+	}
+	return nil
+}
+
+// Op nicks
+func (h *Handler) Op(w irc.Writer, ev *cmd.Event) error {
+	return h.setModes(w, ev, '+', 'o')
+}
+
+// Deop nicks
+func (h *Handler) Deop(w irc.Writer, ev *cmd.Event) error {
+	return h.setModes(w, ev, '-', 'o')
+}
+
+// Voice nicks
+func (h *Handler) Voice(w irc.Writer, ev *cmd.Event) error {
+	return h.setModes(w, ev, '+', 'v')
+}
+
+// Devoice nicks
+func (h *Handler) Devoice(w irc.Writer, ev *cmd.Event) error {
+	return h.setModes(w, ev, '-', 'v')
+}
+
+func (h *Handler) setModes(w irc.Writer, ev *cmd.Event, sign, mode byte) error {
+	ch, err := targetChannel(ev)
+	if err != nil {
+		return err
+	}
+
+	nicks := ev.SplitArg("nicks")
+	if len(nicks) == 0 {
+		nicks = []string{ev.Nick()}
+	}
+
+	changes := make([]modeChange, len(nicks))
+	for i, nick := range nicks {
+		changes[i] = modeChange{mode: mode, arg: nick}
+	}
+	for _, line := range modeLines(ch, sign, changes, ev.NetworkInfo.Modes()) {
+		w.Send(line)
+	}
+	return nil
+}
+
+// Kick nicks
+func (h *Handler) Kick(w irc.Writer, ev *cmd.Event) error {
+	ch, err := targetChannel(ev)
+	if err != nil {
+		return err
+	}
+
+	nicks := splitTargets(ev.Args["nicks"])
+	if nick, ok := h.findSelf(ev.NetworkID, nicks); ok {
+		w.Noticef(ev.Nick(), "\x02Moderation:\x02 I won't kick myself (%s).", nick)
+		return nil
+	}
+
+	h.kick(w, ch, nicks, ev.Args["reason"], ev.Nick())
+	return nil
+}
+
+// Ban nicks or masks
+func (h *Handler) Ban(w irc.Writer, ev *cmd.Event) error {
+	ch, err := targetChannel(ev)
+	if err != nil {
+		return err
+	}
+
+	duration := h.defaultBanDuration(ev.NetworkID, ch)
+	if arg := ev.Args["duration"]; len(arg) != 0 {
+		var ok bool
+		if duration, ok = parseBanDuration(arg); !ok {
+			w.Noticef(ev.Nick(), "\x02Moderation:\x02 Bad duration %q, use something like 30m, 12h or 2d.", arg)
+			return nil
+		}
+	}
+
+	targets, err := h.masks(ev, ch, splitTargets(ev.Args["targets"]))
+	if err != nil {
+		w.Notice(ev.Nick(), "\x02Moderation:\x02 "+err.Error())
+		return nil
+	}
+	return h.ban(w, ev, ch, targets, duration)
+}
+
+// Kickban bans then kicks nicks
+func (h *Handler) Kickban(w irc.Writer, ev *cmd.Event) error {
+	ch, err := targetChannel(ev)
+	if err != nil {
+		return err
+	}
+
+	duration := h.defaultBanDuration(ev.NetworkID, ch)
+	reason := ev.Args["reason"]
+	if fields := strings.SplitN(reason, " ", 2); len(fields[0]) != 0 {
+		if d, ok := parseBanDuration(fields[0]); ok {
+			duration, reason = d, ""
+			if len(fields) == 2 {
+				reason = fields[1]
+			}
+		}
+	}
+
+	nicks := splitTargets(ev.Args["nicks"])
+	targets, err := h.masks(ev, ch, nicks)
+	if err != nil {
+		w.Notice(ev.Nick(), "\x02Moderation:\x02 "+err.Error())
+		return nil
+	}
+	if err = h.ban(w, ev, ch, targets, duration); err != nil {
+		return err
+	}
+	h.kick(w, ch, nicks, reason, ev.Nick())
+	return nil
+}
+
+// Unban nicks or masks. Nicks are looked up in the timed bans first since
+// whoever was banned has usually left and the bot no longer knows their host.
+func (h *Handler) Unban(w irc.Writer, ev *cmd.Event) error {
+	ch, err := targetChannel(ev)
+	if err != nil {
+		return err
+	}
+
+	var masks, rest []string
+	for _, target := range splitTargets(ev.Args["targets"]) {
+		if isMask(target) {
+			rest = append(rest, target)
+		} else if timed := h.bans.masksFor(ev.NetworkID, ch, 'b', target); len(timed) != 0 {
+			masks = append(masks, timed...)
+		} else {
+			rest = append(rest, target)
+		}
+	}
+
+	targets, err := h.masks(ev, ch, rest)
+	if err != nil {
+		w.Notice(ev.Nick(), "\x02Moderation:\x02 "+err.Error())
+		return nil
+	}
+	for _, t := range targets {
+		masks = append(masks, t.mask)
+	}
+
+	changes := make([]modeChange, len(masks))
+	for i, mask := range masks {
+		changes[i] = modeChange{mode: 'b', arg: mask}
+	}
+	for _, line := range modeLines(ch, '-', changes, ev.NetworkInfo.Modes()) {
+		w.Send(line)
+	}
+	return h.bans.remove(ev.NetworkID, ch, 'b', masks)
+}
+
+// Topic sets or shows the topic
+func (h *Handler) Topic(w irc.Writer, ev *cmd.Event) error {
+	ch, err := targetChannel(ev)
+	if err != nil {
+		return err
+	}
+
+	topic := ev.Args["topic"]
+	if len(topic) != 0 {
+		w.Sendf("TOPIC %s :%s", ch, topic)
+		return nil
+	}
+
+	if len(ev.TargetChannel.Topic) == 0 {
+		w.Noticef(ev.Nick(), "\x02Topic:\x02 %s has no topic.", ch)
+	} else {
+		w.Noticef(ev.Nick(), "\x02Topic:\x02 %s", ev.TargetChannel.Topic)
+	}
+	return nil
+}
+
+// Mode sets channel modes
+func (h *Handler) Mode(w irc.Writer, ev *cmd.Event) error {
+	ch, err := targetChannel(ev)
+	if err != nil {
+		return err
+	}
+
+	w.Sendf("MODE %s %s", ch, ev.Args["modes"])
+	return nil
+}
+
+func (h *Handler) kick(w irc.Writer, ch string, nicks []string, reason, by string) {
+	if len(reason) == 0 {
+		reason = "Requested by " + by
+	}
+	for _, nick := range nicks {
+		w.Sendf("KICK %s %s :%s", ch, nick, reason)
+	}
+}
+
+// ban the targets' masks, lifting them after duration if it's not 0.
+func (h *Handler) ban(w irc.Writer, ev *cmd.Event, ch string, targets []banTarget, duration time.Duration) error {
+	masks := make([]string, len(targets))
+	changes := make([]modeChange, len(targets))
+	for i, t := range targets {
+		masks[i] = t.mask
+		changes[i] = modeChange{mode: 'b', arg: t.mask}
+	}
+	for _, line := range modeLines(ch, '+', changes, ev.NetworkInfo.Modes()) {
+		w.Send(line)
+	}
+
+	if duration <= 0 {
+		return h.bans.remove(ev.NetworkID, ch, 'b', masks)
+	}
+
+	h.bans.setModes(ev.NetworkID, ev.NetworkInfo.Modes())
+	expires := time.Now().Add(duration)
+	bans := make([]timedBan, len(targets))
+	for i, t := range targets {
+		bans[i] = timedBan{Mask: t.mask, Nick: t.nick, Expires: expires, By: ev.Sender}
+	}
+	return h.bans.add(ev.NetworkID, ch, bans)
+}
+
+func (h *Handler) defaultBanDuration(network, ch string) time.Duration {
+	return settings.Duration(h.b, network, ch, "basics", "ban_duration")
+}
+
+// banTarget is a ban mask and the nick it was made from, if it was.
+type banTarget struct {
+	nick string
+	mask string
+}
+
+// masks turns nicks into ban masks, anything that looks like a mask already
+// is left alone. Masks that match everyone are refused.
+func (h *Handler) masks(ev *cmd.Event, ch string, targets []string) ([]banTarget, error) {
+	if nick, ok := h.findSelf(ev.NetworkID, targets); ok {
+		return nil, fmt.Errorf("I won't ban myself (%s).", nick)
+	}
+
+	kind := settings.String(h.b, ev.NetworkID, ch, "basics", "ban_mask")
+	state := h.b.State(ev.NetworkID)
+
+	masks := make([]banTarget, 0, len(targets))
+	for _, target := range targets {
+		if isMask(target) {
+			mask := target
+			if !strings.Contains(mask, "!") {
+				mask = "*!" + mask
+			}
+			if matchesEveryone(mask) {
+				return nil, fmt.Errorf("%s matches everyone.", target)
+			}
+			masks = append(masks, banTarget{mask: mask})
+			continue
+		}
+
+		var host irc.Host
+		if state != nil {
+			if user, ok := state.User(target); ok {
+				host = user.Host
+			}
+		}
+		if len(host.Hostname()) == 0 {
+			return nil, fmt.Errorf("I don't know %s's host, ban a mask like *!*@host instead.", target)
+		}
+		masks = append(masks, banTarget{nick: target, mask: banMask(host, kind)})
+	}
+	return masks, nil
+}
+
+// isMask is true if target is a mask and not a nick.
+func isMask(target string) bool {
+	return strings.ContainsAny(target, "!@*")
+}
+
+// matchesEveryone is true for masks made of nothing but wildcards, like *!*@*.
+func matchesEveryone(mask string) bool {
+	return len(strings.Trim(mask, "*?!@")) == 0
+}
+
+// findSelf returns the bot's nick if it's one of the targets.
+func (h *Handler) findSelf(network string, targets []string) (string, bool) {
+	state := h.b.State(network)
+	if state == nil {
+		return "", false
+	}
+
+	self := state.Self().Nick()
+	for _, target := range targets {
+		if strings.EqualFold(target, self) {
+			return self, true
+		}
+	}
+	return "", false
+}
+
+// banMask makes a mask for host: host bans *!*@host, user bans *!*user@host
+// and nick bans nick!*@*.
+func banMask(host irc.Host, kind string) string {
+	nick, user, hostname := host.Split()
+	switch kind {
+	case "nick":
+		return nick + "!*@*"
+	case "user":
+		return "*!*" + strings.TrimPrefix(user, "~") + "@" + hostname
+	default:
+		return "*!*@" + hostname
+	}
+}
+
+func splitTargets(arg string) []string {
+	var targets []string
+	for _, t := range strings.Split(arg, ",") {
+		if t = strings.TrimSpace(t); len(t) != 0 {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// targetChannel is the channel a command acts on. The bot only checks ModFlag
+// in the channel the command was typed in so it's checked again here for the
+// channel that was given, ops in one channel can't act on another.
+func targetChannel(ev *cmd.Event) (string, error) {
+	if ev.TargetChannel == nil {
+		return "", errors.New("Must be a channel that the bot is on")
+	}
+
+	ch := ev.TargetChannel.Name
+	if ev.StoredUser == nil || !ev.StoredUser.HasFlags(ev.NetworkID, ch, ModFlag) {
+		return "", dispatch.MakeChannelFlagsError(ModFlag)
+	}
+	return ch, nil
+}
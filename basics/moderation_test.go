@@ -0,0 +1,97 @@
+package basics
+
+import (
+	"testing"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/internal/testbot"
+)
+
+func TestMatchesEveryone(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mask string
+		want bool
+	}{
+		{"*!*@*", true},
+		{"*!*", true},
+		{"*!?*@*", true},
+		{"*!*@*.example.com", false},
+		{"nick!*@*", false},
+		{"*!*ident@*", false},
+	}
+
+	for _, test := range tests {
+		if got := matchesEveryone(test.mask); got != test.want {
+			t.Errorf("%s: want %v, got %v", test.mask, test.want, got)
+		}
+	}
+}
+
+func TestMasksFor(t *testing.T) {
+	t.Parallel()
+
+	timer := newBanTimer(nil)
+	timer.bans[banChannel{"net", "#chan"}] = []timedBan{
+		{Mask: "*!*@one.example.com", Nick: "Bad"},
+		{Mask: "*!*@two.example.com", Nick: "bad", Mode: "q"},
+		{Mask: "*!*@three.example.com"},
+	}
+
+	got := timer.masksFor("net", "#Chan", 'b', "BAD")
+	if len(got) != 1 || got[0] != "*!*@one.example.com" {
+		t.Errorf("want only the ban for bad, got %v", got)
+	}
+	if got := timer.masksFor("net", "#chan", 'b', "other"); len(got) != 0 {
+		t.Errorf("want no bans for other, got %v", got)
+	}
+}
+
+func TestModerationChecksTargetChannel(t *testing.T) {
+	h := &Handler{b: testbot.NewStoreless(t, "")}
+
+	user, err := data.NewStoredUser("op", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Grant("test", "#a", 0, ModFlag)
+
+	commands := map[string]func(irc.Writer, *cmd.Event) error{
+		"op":      h.Op,
+		"kick":    h.Kick,
+		"ban":     h.Ban,
+		"kickban": h.Kickban,
+		"unban":   h.Unban,
+		"topic":   h.Topic,
+		"mode":    h.Mode,
+	}
+
+	run := func(name, channel string) ([]string, error) {
+		var lines testbot.Lines
+		ev := &cmd.Event{
+			Event: irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG,
+				"op!o@o.host", "#a", "!"+name),
+			StoredUser:    user,
+			TargetChannel: data.NewChannel(channel, nil),
+			Args: map[string]string{
+				"nicks": "victim", "targets": "*!*@victim.host",
+				"modes": "+k key", "topic": "new topic",
+			},
+		}
+		err := commands[name](irc.Helper{Writer: &lines}, ev)
+		return lines, err
+	}
+
+	for name := range commands {
+		if lines, err := run(name, "#b"); err == nil || len(lines) != 0 {
+			t.Errorf("%s: want an op in #a refused in #b, got %q %v", name, lines, err)
+		}
+	}
+
+	if lines, err := run("mode", "#a"); err != nil || len(lines) != 1 || lines[0] != "MODE #a +k key" {
+		t.Errorf("want the mode set in the op's own channel, got %q %v", lines, err)
+	}
+}
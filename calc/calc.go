@@ -0,0 +1,604 @@
+// Package calc evaluates arithmetic without asking anyone. Whole numbers are
+// exact however big they get, hex, octal and binary can be written with 0x,
+// 0o and 0b, and "expr in unit" converts between units and bases.
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxBits is the biggest a whole number can get, about 300k digits.
+	maxBits = 1 << 20
+	// maxDigits is how many digits of a whole number are shown before it's
+	// shown in scientific notation instead.
+	maxDigits = 300
+	// maxFactorial is the biggest factorial that's worked out.
+	maxFactorial = 20000
+)
+
+// ErrUnsupported is returned for expressions calc doesn't understand, like
+// questions in english. Other errors are mistakes in the maths.
+var ErrUnsupported = errors.New("calc: unsupported expression")
+
+// Eval evaluates expr and returns the answer.
+func Eval(expr string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	if len(expr) == 0 {
+		return "", ErrUnsupported
+	}
+
+	if left, right, ok := splitConversion(expr); ok {
+		if out, err := convert(left, right); err != ErrUnsupported {
+			return out, err
+		}
+	}
+
+	v, err := evaluate(expr)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+func evaluate(expr string) (value, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return value{}, err
+	}
+
+	p := parser{toks: toks}
+	v, err := p.expr()
+	if err != nil {
+		return value{}, err
+	}
+	if p.pos != len(p.toks) {
+		return value{}, ErrUnsupported
+	}
+	return v, nil
+}
+
+// value is an exact whole number when i is set, otherwise a float.
+type value struct {
+	i *big.Int
+	f float64
+}
+
+func intVal(i *big.Int) (value, error) {
+	if i.BitLen() > maxBits {
+		return value{}, errors.New("that number is too big")
+	}
+	return value{i: i}, nil
+}
+
+func floatVal(f float64) (value, error) {
+	if math.IsNaN(f) {
+		return value{}, errors.New("the answer isn't a number")
+	}
+	return value{f: f}, nil
+}
+
+func (v value) isInt() bool {
+	return v.i != nil
+}
+
+func (v value) float() float64 {
+	if v.i == nil {
+		return v.f
+	}
+	f, _ := new(big.Float).SetInt(v.i).Float64()
+	return f
+}
+
+// whole returns v as a whole number if it is one.
+func (v value) whole() (*big.Int, bool) {
+	if v.i != nil {
+		return v.i, true
+	}
+	if math.IsInf(v.f, 0) || v.f != math.Trunc(v.f) {
+		return nil, false
+	}
+	i, _ := new(big.Float).SetFloat64(v.f).Int(nil)
+	return i, true
+}
+
+func (v value) String() string {
+	if v.i == nil {
+		return formatFloat(v.f)
+	}
+
+	s := v.i.String()
+	digits := len(strings.TrimPrefix(s, "-"))
+	if digits <= maxDigits {
+		return s
+	}
+	return fmt.Sprintf("%s (%d digits)", new(big.Float).SetInt(v.i).Text('g', 12), digits)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', 12, 64)
+}
+
+type tokenKind int
+
+const (
+	tokNum tokenKind = iota
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	val  value
+}
+
+// lex splits expr into numbers, names and operators.
+func lex(expr string) ([]token, error) {
+	var toks []token
+	rs := []rune(expr)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			n, v, err := lexNumber(rs[i:])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tokNum, text: string(rs[i : i+n]), val: v})
+			i += n
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: strings.ToLower(string(rs[i:j]))})
+			i = j
+		default:
+			op := string(r)
+			if i+1 < len(rs) {
+				if two := string(rs[i : i+2]); two == "**" || two == "<<" || two == ">>" {
+					op = two
+				}
+			}
+			i += len([]rune(op))
+
+			switch op {
+			case "**":
+				op = "^"
+			case "×":
+				op = "*"
+			case "÷":
+				op = "/"
+			case "+", "-", "*", "/", "%", "^", "!", "(", ")", ",", "&", "|", "<<", ">>":
+			default:
+				return nil, ErrUnsupported
+			}
+			toks = append(toks, token{kind: tokOp, text: op})
+		}
+	}
+
+	return toks, nil
+}
+
+// lexNumber reads a number from the start of rs, returning how many runes it
+// used.
+func lexNumber(rs []rune) (int, value, error) {
+	if len(rs) > 2 && rs[0] == '0' && strings.ContainsRune("xXbBoO", rs[1]) {
+		n := 2
+		for n < len(rs) && (unicode.IsDigit(rs[n]) || unicode.IsLetter(rs[n]) || rs[n] == '_') {
+			n++
+		}
+		i, ok := new(big.Int).SetString(string(rs[:n]), 0)
+		if !ok {
+			return 0, value{}, ErrUnsupported
+		}
+		return n, value{i: i}, nil
+	}
+
+	n, isFloat := 0, false
+	for n < len(rs) && (unicode.IsDigit(rs[n]) || rs[n] == '_' || rs[n] == '.') {
+		isFloat = isFloat || rs[n] == '.'
+		n++
+	}
+	if n < len(rs) && (rs[n] == 'e' || rs[n] == 'E') {
+		m := n + 1
+		if m < len(rs) && (rs[m] == '+' || rs[m] == '-') {
+			m++
+		}
+		if m < len(rs) && unicode.IsDigit(rs[m]) {
+			for m < len(rs) && unicode.IsDigit(rs[m]) {
+				m++
+			}
+			n, isFloat = m, true
+		}
+	}
+
+	text := strings.Replace(string(rs[:n]), "_", "", -1)
+	if !isFloat {
+		i, ok := new(big.Int).SetString(text, 10)
+		if !ok {
+			return 0, value{}, ErrUnsupported
+		}
+		return n, value{i: i}, nil
+	}
+
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, value{}, ErrUnsupported
+	}
+	return n, value{f: f}, nil
+}
+
+// parser is a recursive descent parser, from lowest precedence to highest:
+// | & << >> + - * / % unary - ^ !
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.toks) {
+		return token{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+// accept moves past the next token if it's one of the ops.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t, ok := p.peek()
+	if !ok || t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expr() (value, error) {
+	return p.binary(0)
+}
+
+var levels = [][]string{
+	{"|"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (value, error) {
+	if level == len(levels) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return value{}, err
+	}
+	for {
+		op, ok := p.accept(levels[level]...)
+		if !ok {
+			return left, nil
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return value{}, err
+		}
+		if left, err = apply(op, left, right); err != nil {
+			return value{}, err
+		}
+	}
+}
+
+func (p *parser) unary() (value, error) {
+	if op, ok := p.accept("-", "+"); ok {
+		v, err := p.unary()
+		if err != nil || op == "+" {
+			return v, err
+		}
+		return negate(v), nil
+	}
+	return p.power()
+}
+
+func (p *parser) power() (value, error) {
+	base, err := p.postfix()
+	if err != nil {
+		return value{}, err
+	}
+	if _, ok := p.accept("^"); !ok {
+		return base, nil
+	}
+	// Right associative, and 2^-1 works.
+	exp, err := p.unary()
+	if err != nil {
+		return value{}, err
+	}
+	return pow(base, exp)
+}
+
+func (p *parser) postfix() (value, error) {
+	v, err := p.primary()
+	if err != nil {
+		return value{}, err
+	}
+	for {
+		if _, ok := p.accept("!"); !ok {
+			return v, nil
+		}
+		if v, err = factorial(v); err != nil {
+			return value{}, err
+		}
+	}
+}
+
+func (p *parser) primary() (value, error) {
+	t, ok := p.peek()
+	if !ok {
+		return value{}, ErrUnsupported
+	}
+	p.pos++
+
+	switch t.kind {
+	case tokNum:
+		return t.val, nil
+	case tokIdent:
+		if _, ok := p.accept("("); ok {
+			return p.call(t.text)
+		}
+		if c, ok := constants[t.text]; ok {
+			return value{f: c}, nil
+		}
+		return value{}, ErrUnsupported
+	}
+
+	if t.text != "(" {
+		return value{}, ErrUnsupported
+	}
+	v, err := p.expr()
+	if err != nil {
+		return value{}, err
+	}
+	if _, ok := p.accept(")"); !ok {
+		return value{}, ErrUnsupported
+	}
+	return v, nil
+}
+
+// call a function, the ( has been read.
+func (p *parser) call(name string) (value, error) {
+	fn, ok := functions[name]
+	if !ok {
+		return value{}, ErrUnsupported
+	}
+
+	var args []value
+	if _, ok := p.accept(")"); !ok {
+		for {
+			v, err := p.expr()
+			if err != nil {
+				return value{}, err
+			}
+			args = append(args, v)
+			if _, ok := p.accept(","); ok {
+				continue
+			}
+			if _, ok := p.accept(")"); ok {
+				break
+			}
+			return value{}, ErrUnsupported
+		}
+	}
+
+	if fn.args >= 0 && len(args) != fn.args {
+		return value{}, fmt.Errorf("%s takes %d arguments", name, fn.args)
+	}
+	if fn.args < 0 && len(args) == 0 {
+		return value{}, fmt.Errorf("%s needs at least one argument", name)
+	}
+	return fn.fn(args)
+}
+
+func negate(v value) value {
+	if v.isInt() {
+		return value{i: new(big.Int).Neg(v.i)}
+	}
+	return value{f: -v.f}
+}
+
+func apply(op string, a, b value) (value, error) {
+	if a.isInt() && b.isInt() {
+		return applyInt(op, a.i, b.i)
+	}
+
+	x, y := a.float(), b.float()
+	switch op {
+	case "+":
+		return floatVal(x + y)
+	case "-":
+		return floatVal(x - y)
+	case "*":
+		return floatVal(x * y)
+	case "/":
+		if y == 0 {
+			return value{}, errors.New("division by zero")
+		}
+		return floatVal(x / y)
+	case "%":
+		if y == 0 {
+			return value{}, errors.New("division by zero")
+		}
+		return floatVal(math.Mod(x, y))
+	}
+
+	// The bitwise operators work on floats that are whole numbers.
+	i, ok1 := a.whole()
+	j, ok2 := b.whole()
+	if !ok1 || !ok2 {
+		return value{}, fmt.Errorf("%s only works on whole numbers", op)
+	}
+	return applyInt(op, i, j)
+}
+
+func applyInt(op string, a, b *big.Int) (value, error) {
+	z := new(big.Int)
+	switch op {
+	case "+":
+		z.Add(a, b)
+	case "-":
+		z.Sub(a, b)
+	case "*":
+		z.Mul(a, b)
+	case "/", "%":
+		if b.Sign() == 0 {
+			return value{}, errors.New("division by zero")
+		}
+		m := new(big.Int)
+		z.QuoRem(a, b, m)
+		if op == "%" {
+			return value{i: m}, nil
+		}
+		if m.Sign() != 0 {
+			f, _ := new(big.Rat).SetFrac(a, b).Float64()
+			return floatVal(f)
+		}
+	case "&":
+		z.And(a, b)
+	case "|":
+		z.Or(a, b)
+	case "<<", ">>":
+		if !b.IsInt64() || b.Int64() < 0 || b.Int64() > maxBits {
+			return value{}, errors.New("that shift is too big")
+		}
+		if op == "<<" {
+			z.Lsh(a, uint(b.Int64()))
+		} else {
+			z.Rsh(a, uint(b.Int64()))
+		}
+	}
+	return intVal(z)
+}
+
+func pow(base, exp value) (value, error) {
+	if base.isInt() && exp.isInt() && exp.i.Sign() >= 0 {
+		if bits := base.i.BitLen(); bits > 1 && (!exp.i.IsInt64() || exp.i.Int64() > maxBits/int64(bits-1)) {
+			return value{}, errors.New("that number is too big")
+		}
+		return intVal(new(big.Int).Exp(base.i, exp.i, nil))
+	}
+	return floatVal(math.Pow(base.float(), exp.float()))
+}
+
+func factorial(v value) (value, error) {
+	n, ok := v.whole()
+	if !ok || n.Sign() < 0 {
+		return value{}, errors.New("factorials need a whole number that isn't negative")
+	}
+	if !n.IsInt64() || n.Int64() > maxFactorial {
+		return value{}, errors.New("that number is too big")
+	}
+	return intVal(new(big.Int).MulRange(1, n.Int64()))
+}
+
+var constants = map[string]float64{
+	"pi":  math.Pi,
+	"π":   math.Pi,
+	"tau": 2 * math.Pi,
+	"e":   math.E,
+	"phi": math.Phi,
+}
+
+type function struct {
+	// args is how many arguments it takes, -1 is one or more.
+	args int
+	fn   func(args []value) (value, error)
+}
+
+// float1 makes a function of one float.
+func float1(fn func(float64) float64) function {
+	return function{args: 1, fn: func(args []value) (value, error) {
+		return floatVal(fn(args[0].float()))
+	}}
+}
+
+// round makes a function that leaves whole numbers alone.
+func round(fn func(float64) float64) function {
+	return function{args: 1, fn: func(args []value) (value, error) {
+		if args[0].isInt() {
+			return args[0], nil
+		}
+		f := fn(args[0].f)
+		if i, ok := (value{f: f}).whole(); ok {
+			return intVal(i)
+		}
+		return floatVal(f)
+	}}
+}
+
+// pick makes a function that picks one of its arguments.
+func pick(better func(a, b float64) bool) function {
+	return function{args: -1, fn: func(args []value) (value, error) {
+		best := args[0]
+		for _, v := range args[1:] {
+			if better(v.float(), best.float()) {
+				best = v
+			}
+		}
+		return best, nil
+	}}
+}
+
+var functions = map[string]function{
+	"sqrt":  float1(math.Sqrt),
+	"cbrt":  float1(math.Cbrt),
+	"sin":   float1(math.Sin),
+	"cos":   float1(math.Cos),
+	"tan":   float1(math.Tan),
+	"asin":  float1(math.Asin),
+	"acos":  float1(math.Acos),
+	"atan":  float1(math.Atan),
+	"sinh":  float1(math.Sinh),
+	"cosh":  float1(math.Cosh),
+	"tanh":  float1(math.Tanh),
+	"ln":    float1(math.Log),
+	"log":   float1(math.Log10),
+	"log2":  float1(math.Log2),
+	"exp":   float1(math.Exp),
+	"floor": round(math.Floor),
+	"ceil":  round(math.Ceil),
+	"round": round(math.Round),
+	"trunc": round(math.Trunc),
+	"abs": {args: 1, fn: func(args []value) (value, error) {
+		if args[0].isInt() {
+			return value{i: new(big.Int).Abs(args[0].i)}, nil
+		}
+		return floatVal(math.Abs(args[0].f))
+	}},
+	"min": pick(func(a, b float64) bool { return a < b }),
+	"max": pick(func(a, b float64) bool { return a > b }),
+	"atan2": {args: 2, fn: func(args []value) (value, error) {
+		return floatVal(math.Atan2(args[0].float(), args[1].float()))
+	}},
+	"gcd": {args: 2, fn: func(args []value) (value, error) {
+		a, ok1 := args[0].whole()
+		b, ok2 := args[1].whole()
+		if !ok1 || !ok2 {
+			return value{}, errors.New("gcd only works on whole numbers")
+		}
+		return value{i: new(big.Int).GCD(nil, nil, new(big.Int).Abs(a), new(big.Int).Abs(b))}, nil
+	}},
+}
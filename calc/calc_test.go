@@ -0,0 +1,160 @@
+package calc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalPrecedence(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"10 - 4 - 3", "3"},
+		{"2 ^ 3 ^ 2", "512"},
+		{"2 ** 10", "1024"},
+		{"-2 ^ 2", "-4"},
+		{"2 ^ -1", "0.5"},
+		{"3!", "6"},
+		{"3!!", "720"},
+		{"2 * 3!", "12"},
+		{"7 / 2", "3.5"},
+		{"8 / 2", "4"},
+		{"7 % 3", "1"},
+		{"1 << 4 + 1", "32"},
+		{"6 & 3 | 8", "10"},
+		{"1 | 2 & 3", "3"},
+		{"2 × 3 ÷ 4", "1.5"},
+		{"- - 3", "3"},
+		{"+3", "3"},
+		{"1_000 * 2", "2000"},
+		{"1.5e3 + 1", "1501"},
+		{".5 * 4", "2"},
+		{"max(1, 5, 3) - min(4, 2)", "3"},
+		{"abs(-7) + gcd(12, 18)", "13"},
+		{"floor(2.7) + ceil(2.1)", "5"},
+		{"sqrt(16)", "4"},
+		{"round(pi * 100)", "314"},
+		{"PI", "3.14159265359"},
+	}
+
+	for _, test := range tests {
+		got, err := Eval(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.expr, err)
+		} else if got != test.want {
+			t.Errorf("%s: want %s, got %s", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestEvalBigInts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"2^64", "18446744073709551616"},
+		{"2^64 - 1 + 1", "18446744073709551616"},
+		{"99999999999999999999 * 99999999999999999999", "9999999999999999999800000000000000000001"},
+		{"25!", "15511210043330985984000000"},
+		{"2^1000", "1.07150860719e+301 (302 digits)"},
+		{"-(2^1000)", "-1.07150860719e+301 (302 digits)"},
+		{"1 << 100 >> 99", "2"},
+		{"(2^64) / (2^32)", "4294967296"},
+	}
+
+	for _, test := range tests {
+		got, err := Eval(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.expr, err)
+		} else if got != test.want {
+			t.Errorf("%s: want %s, got %s", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestEvalLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"2^(2^21)", "too big"},
+		{"10^1000000", "too big"},
+		{"(2^1000000) * (2^1000000)", "too big"},
+		{"1 << 2000000", "shift is too big"},
+		{"1 << -1", "shift is too big"},
+		{"20001!", "too big"},
+		{"(-1)!", "whole number"},
+		{"2.5!", "whole number"},
+		{"1 / 0", "division by zero"},
+		{"1.5 % 0", "division by zero"},
+		{"1.5 & 1", "whole numbers"},
+		{"sqrt(-1)", "isn't a number"},
+		{"atan2(1)", "takes 2 arguments"},
+		{"max()", "at least one argument"},
+	}
+
+	for _, test := range tests {
+		_, err := Eval(test.expr)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: want an error saying %q, got %v", test.expr, test.want, err)
+		}
+	}
+}
+
+func TestEvalBases(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"0xff", "255"},
+		{"0XFF + 0b11 + 0o17", "273"},
+		{"0x_ff_ff", "65535"},
+		{"255 in hex", "0xff"},
+		{"255 to binary", "0b11111111"},
+		{"8 as oct", "0o10"},
+		{"0xff in dec", "255"},
+		{"-10 in hex", "-0xa"},
+		{"2^64 in hex", "0x10000000000000000"},
+		{"4.0 in bin", "0b100"},
+	}
+
+	for _, test := range tests {
+		got, err := Eval(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.expr, err)
+		} else if got != test.want {
+			t.Errorf("%s: want %s, got %s", test.expr, test.want, got)
+		}
+	}
+
+	if _, err := Eval("1.5 in hex"); err == nil {
+		t.Error("want an error for a fraction in hex")
+	}
+	if _, err := Eval("2^4000 in bin"); err == nil {
+		t.Error("want an error for a number too long to show")
+	}
+}
+
+func TestEvalUnsupported(t *testing.T) {
+	t.Parallel()
+
+	for _, expr := range []string{
+		"", "   ", "what is the weather", "1 +", "(1 + 2", "1 2", "foo(1)",
+		"0xzz", "1 $ 2", "sqrt(1, 2", "1 in parsecs per fortnight",
+	} {
+		if _, err := Eval(expr); err != ErrUnsupported {
+			t.Errorf("%q: want ErrUnsupported, got %v", expr, err)
+		}
+	}
+}
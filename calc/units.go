@@ -0,0 +1,222 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// unit is converted to its dimension's base unit with (v + offset) * factor,
+// only temperatures have an offset.
+type unit struct {
+	dim    string
+	factor float64
+	offset float64
+}
+
+// units are looked up in lower case.
+var units = map[string]unit{}
+
+// symbols are looked up as they're written since case changes their meaning,
+// Mb is megabits and MB is megabytes.
+var symbols = map[string]unit{}
+
+// addUnit adds a unit under all of its names.
+func addUnit(dim string, factor, offset float64, names ...string) {
+	for _, name := range names {
+		units[name] = unit{dim: dim, factor: factor, offset: offset}
+	}
+}
+
+// addSymbol adds a case sensitive unit under all of its symbols.
+func addSymbol(dim string, factor float64, names ...string) {
+	for _, name := range names {
+		symbols[name] = unit{dim: dim, factor: factor}
+	}
+}
+
+func init() {
+	addUnit("length", 1, 0, "m", "meter", "meters", "metre", "metres")
+	addUnit("length", 1e3, 0, "km", "kilometer", "kilometers", "kilometre", "kilometres")
+	addUnit("length", 1e-2, 0, "cm", "centimeter", "centimeters", "centimetre", "centimetres")
+	addUnit("length", 1e-3, 0, "mm", "millimeter", "millimeters", "millimetre", "millimetres")
+	addUnit("length", 1e-6, 0, "um", "µm", "micrometer", "micrometers")
+	addUnit("length", 1e-9, 0, "nm", "nanometer", "nanometers")
+	addUnit("length", 0.0254, 0, "in", "inch", "inches", `"`)
+	addUnit("length", 0.3048, 0, "ft", "foot", "feet", "'")
+	addUnit("length", 0.9144, 0, "yd", "yard", "yards")
+	addUnit("length", 1609.344, 0, "mi", "mile", "miles")
+	addUnit("length", 1852, 0, "nmi", "nautical mile", "nautical miles")
+	addUnit("length", 9.4607304725808e15, 0, "ly", "lightyear", "lightyears", "light year", "light years")
+	addUnit("length", 1.495978707e11, 0, "au")
+
+	addUnit("mass", 1, 0, "kg", "kilogram", "kilograms", "kilo", "kilos")
+	addUnit("mass", 1e-3, 0, "g", "gram", "grams")
+	addUnit("mass", 1e-6, 0, "mg", "milligram", "milligrams")
+	addUnit("mass", 1e3, 0, "t", "tonne", "tonnes")
+	addUnit("mass", 0.45359237, 0, "lb", "lbs", "pound", "pounds")
+	addUnit("mass", 0.028349523125, 0, "oz", "ounce", "ounces")
+	addUnit("mass", 6.35029318, 0, "st", "stone", "stones")
+
+	addUnit("time", 1, 0, "s", "sec", "secs", "second", "seconds")
+	addUnit("time", 1e-3, 0, "ms", "millisecond", "milliseconds")
+	addUnit("time", 60, 0, "min", "mins", "minute", "minutes")
+	addUnit("time", 3600, 0, "h", "hr", "hrs", "hour", "hours")
+	addUnit("time", 86400, 0, "d", "day", "days")
+	addUnit("time", 604800, 0, "wk", "week", "weeks")
+	addUnit("time", 31557600, 0, "yr", "year", "years")
+
+	addUnit("volume", 1, 0, "l", "liter", "liters", "litre", "litres")
+	addUnit("volume", 1e-3, 0, "ml", "milliliter", "milliliters", "millilitre", "millilitres")
+	addUnit("volume", 1e3, 0, "m3", "m^3", "cubic meter", "cubic meters")
+	addUnit("volume", 3.785411784, 0, "gal", "gallon", "gallons")
+	addUnit("volume", 0.946352946, 0, "qt", "quart", "quarts")
+	addUnit("volume", 0.473176473, 0, "pt", "pint", "pints")
+	addUnit("volume", 0.2365882365, 0, "cup", "cups")
+	addUnit("volume", 0.0295735295625, 0, "floz", "fl oz")
+	addUnit("volume", 0.01478676478125, 0, "tbsp", "tablespoon", "tablespoons")
+	addUnit("volume", 0.00492892159375, 0, "tsp", "teaspoon", "teaspoons")
+
+	addUnit("speed", 1, 0, "m/s", "mps")
+	addUnit("speed", 1/3.6, 0, "km/h", "kmh", "kph")
+	addUnit("speed", 0.44704, 0, "mph", "mi/h")
+	addUnit("speed", 0.514444444444, 0, "kn", "knot", "knots")
+	addUnit("speed", 0.3048, 0, "ft/s", "fps")
+
+	addUnit("temperature", 1, 0, "k", "kelvin")
+	addUnit("temperature", 1, 273.15, "c", "°c", "celsius")
+	addUnit("temperature", 5.0/9, 459.67, "f", "°f", "fahrenheit")
+
+	addUnit("area", 1, 0, "m2", "m^2", "sqm")
+	addUnit("area", 1e6, 0, "km2", "km^2")
+	addUnit("area", 0.09290304, 0, "ft2", "ft^2", "sqft")
+	addUnit("area", 1e4, 0, "ha", "hectare", "hectares")
+	addUnit("area", 4046.8564224, 0, "acre", "acres")
+
+	// Data is in bytes, b is a bit and B is a byte. Lower case mb and the like
+	// could be either so they aren't units.
+	addUnit("data", 1, 0, "byte", "bytes")
+	addUnit("data", 1.0/8, 0, "bit", "bits")
+	addSymbol("data", 1, "B")
+	addSymbol("data", 1.0/8, "b")
+	for i, prefix := range []string{"K", "M", "G", "T", "P"} {
+		si, binary := 1.0, 1.0
+		for j := 0; j <= i; j++ {
+			si, binary = si*1e3, binary*1024
+		}
+		addUnit("data", si/8, 0, strings.ToLower(prefix)+"bit")
+		addSymbol("data", si, prefix+"B")
+		addSymbol("data", si/8, prefix+"b")
+		addSymbol("data", binary, prefix+"iB")
+		addSymbol("data", binary/8, prefix+"ib")
+		if prefix == "K" {
+			// SI's kilo is a lower case k.
+			addSymbol("data", si, "kB")
+			addSymbol("data", si/8, "kb")
+		}
+	}
+}
+
+// bases are what "expr in hex" can convert to.
+var bases = map[string]int{
+	"hex": 16, "hexadecimal": 16,
+	"oct": 8, "octal": 8,
+	"bin": 2, "binary": 2,
+	"dec": 10, "decimal": 10,
+}
+
+var rgxUnitSuffix = regexp.MustCompile(`^(.*?[\d.)])\s*([^\d\s()].*)$`)
+
+// splitConversion splits "expr to unit" or "expr in unit".
+func splitConversion(expr string) (string, string, bool) {
+	lower := strings.ToLower(expr)
+	for _, sep := range []string{" to ", " in ", " as ", " -> ", " => "} {
+		if i := strings.LastIndex(lower, sep); i > 0 {
+			return strings.TrimSpace(expr[:i]), strings.TrimSpace(expr[i+len(sep):]), true
+		}
+	}
+	return "", "", false
+}
+
+// convert left, a number with a unit or an expression, to the unit or base
+// right.
+func convert(left, right string) (string, error) {
+	to := strings.ToLower(right)
+	if base, ok := bases[to]; ok {
+		v, err := evaluate(left)
+		if err != nil {
+			return "", err
+		}
+		return inBase(v, base)
+	}
+
+	toUnit, ok := lookupUnit(right)
+	if !ok {
+		return "", ErrUnsupported
+	}
+
+	m := rgxUnitSuffix.FindStringSubmatch(left)
+	if m == nil {
+		return "", ErrUnsupported
+	}
+	fromUnit, ok := lookupUnit(m[2])
+	if !ok {
+		return "", ErrUnsupported
+	}
+	v, err := evaluate(m[1])
+	if err != nil {
+		return "", err
+	}
+
+	if fromUnit.dim != toUnit.dim {
+		return "", fmt.Errorf("can't convert %s, which is %s, to %s, which is %s",
+			m[2], fromUnit.dim, right, toUnit.dim)
+	}
+
+	base := (v.float() + fromUnit.offset) * fromUnit.factor
+	out := base/toUnit.factor - toUnit.offset
+	// Taking the offset back off leaves rounding errors where it should
+	// cancel out, like 32 °F to °C.
+	if math.Abs(out) < 1e-12*toUnit.offset {
+		out = 0
+	}
+	return fmt.Sprintf("%s %s", formatFloat(out), right), nil
+}
+
+// lookupUnit finds a unit by its symbol, or by its name ignoring case and a
+// leading "degrees" for temperatures.
+func lookupUnit(name string) (unit, bool) {
+	name = strings.Join(strings.Fields(name), " ")
+	if u, ok := symbols[name]; ok {
+		return u, true
+	}
+
+	name = strings.ToLower(name)
+	if u, ok := units[name]; ok {
+		return u, true
+	}
+	if u, ok := units[strings.TrimPrefix(name, "degrees ")]; ok && u.dim == "temperature" {
+		return u, true
+	}
+	return unit{}, false
+}
+
+func inBase(v value, base int) (string, error) {
+	i, ok := v.whole()
+	if !ok {
+		return "", fmt.Errorf("only whole numbers can be shown in base %d", base)
+	}
+
+	prefix := map[int]string{16: "0x", 8: "0o", 2: "0b", 10: ""}[base]
+	abs := new(big.Int).Abs(i)
+	s := prefix + abs.Text(base)
+	if i.Sign() < 0 {
+		s = "-" + s
+	}
+	if len(s) > maxDigits*4 {
+		return "", fmt.Errorf("that number is too long to show in base %d", base)
+	}
+	return s, nil
+}
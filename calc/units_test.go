@@ -0,0 +1,72 @@
+package calc
+
+import "testing"
+
+func TestEvalDataUnits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"100 Mb to MB", "12.5 MB"},
+		{"1 MB to Mb", "8 Mb"},
+		{"1 B to b", "8 b"},
+		{"1 KiB to B", "1024 B"},
+		{"1 kB to B", "1000 B"},
+		{"1 KB in bits", "8000 bits"},
+		{"1 GiB to MiB", "1024 MiB"},
+		{"8 Mbit to MB", "1 MB"},
+		{"2 bytes to bits", "16 bits"},
+	}
+
+	for _, test := range tests {
+		got, err := Eval(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.expr, err)
+		} else if got != test.want {
+			t.Errorf("%s: want %s, got %s", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestEvalAmbiguousDataUnits(t *testing.T) {
+	t.Parallel()
+
+	for _, expr := range []string{"100 mb to MB", "1 MB to mb"} {
+		if _, err := Eval(expr); err != ErrUnsupported {
+			t.Errorf("%s: want ErrUnsupported, got %v", expr, err)
+		}
+	}
+}
+
+func TestEvalUnits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1 mile in km", "1.609344 km"},
+		{"5 ft to cm", "152.4 cm"},
+		{"6 kg to lb", "13.2277357311 lb"},
+		{"1 Kilometer to meters", "1000 meters"},
+		{"100 c to f", "212 f"},
+		{"32 degrees fahrenheit to celsius", "0 celsius"},
+		{"0 c to k", "273.15 k"},
+		{"90 minutes to hours", "1.5 hours"},
+	}
+
+	for _, test := range tests {
+		got, err := Eval(test.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.expr, err)
+		} else if got != test.want {
+			t.Errorf("%s: want %s, got %s", test.expr, test.want, got)
+		}
+	}
+
+	if _, err := Eval("1 kg to km"); err == nil || err == ErrUnsupported {
+		t.Errorf("want an error converting mass to length, got %v", err)
+	}
+}
@@ -0,0 +1,381 @@
+// Package chanlog writes channel logs to disk, one file per channel per day,
+// and lets owners search them.
+package chanlog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/admin"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
+	"github.com/aarondl/uq/settings"
+)
+
+const (
+	defaultDir = "logs"
+	// pruneEvery is how often old logs are looked for.
+	pruneEvery = time.Hour
+	// grepDays is how many days of logs grep searches.
+	grepDays   = 7
+	maxMatches = 10
+)
+
+// events are the ones that are logged, end of names is for learning who's
+// in a channel when the bot joins.
+var events = []string{
+	irc.PRIVMSG, irc.NOTICE, irc.JOIN, irc.PART, irc.QUIT,
+	irc.KICK, irc.NICK, irc.TOPIC, irc.MODE, irc.RPL_ENDOFNAMES,
+}
+
+func init() {
+	ext.RegisterExtension("chanlog", &Chanlog{})
+	settings.Define("chanlog", settings.Option{
+		Name:    "log",
+		Type:    settings.BoolType,
+		Default: "true",
+		Desc:    "Log the channel to disk, turn it off to opt out.",
+	}, settings.Option{
+		Name:    "format",
+		Default: "text",
+		Desc:    "How the channel's logs are written: text like irssi's or json for json lines.",
+	}, settings.Option{
+		Name:    "keep_days",
+		Type:    settings.IntType,
+		Default: "30",
+		Desc:    "How many days of the channel's logs are kept, 0 keeps them forever.",
+	})
+}
+
+// Chanlog extension
+type Chanlog struct {
+	b       *bot.Bot
+	files   *files
+	members *members
+	// done stops the prune loop, which closes pruned once it has.
+	done   chan struct{}
+	pruned chan struct{}
+
+	handlerIDs []uint64
+	grepID     uint64
+}
+
+// Init the extension
+func (c *Chanlog) Init(b *bot.Bot) error {
+	c.b = b
+
+	dir := defaultDir
+	var networks []string
+	b.ReadConfig(func(cfg *config.Config) {
+		if val, ok := cfg.ExtGlobal().ConfigVal("", "", "chanlog_dir"); ok {
+			dir = val
+		}
+		networks = cfg.Networks()
+	})
+	c.files = newFiles(dir)
+	c.members = newMembers()
+	c.done, c.pruned = make(chan struct{}), make(chan struct{})
+	c.handlerIDs = nil
+
+	// Learn who's where now, when loaded after the bot joined its channels
+	// the first event could be a quit that the state has already forgotten.
+	for _, network := range networks {
+		c.members.seed(b.State(network), network)
+	}
+
+	var err error
+	c.grepID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"chanlog",
+		"grep",
+		fmt.Sprintf("Searches the last %d days of a channel's logs. Wrap the "+
+			"pattern in slashes for a regexp. Owner only.", grepDays),
+		c,
+		cmd.Privmsg, cmd.AnyScope, 0, admin.OwnerFlag, "#chan", "pattern...",
+	))
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		c.handlerIDs = append(c.handlerIDs, ext.Register(b, "", "", event, c))
+	}
+
+	go func(fs *files, done, pruned chan struct{}) {
+		defer close(pruned)
+		pruneLoop(b, fs, done)
+	}(c.files, c.done, c.pruned)
+	return nil
+}
+
+// Deinit the extension
+func (c *Chanlog) Deinit(b *bot.Bot) error {
+	for _, id := range c.handlerIDs {
+		ext.Unregister(b, id)
+	}
+	ext.UnregisterCmd(b, c.grepID)
+
+	close(c.done)
+	<-c.pruned
+	c.files.close()
+	return nil
+}
+
+// Cmd lets reflection hook up the commands, instead of doing it here.
+func (c *Chanlog) Cmd(_ string, _ irc.Writer, _ *cmd.Event) error {
+	return nil
+}
+
+// Handle logs what happens in channels.
+func (c *Chanlog) Handle(w irc.Writer, ev *irc.Event) {
+	network := ev.NetworkID
+	state := c.b.State(network)
+	e := entry{Time: time.Now(), Nick: ev.Nick(), Host: ircmsg.UserHost(ev.Sender)}
+	c.members.seed(state, network)
+
+	// Quits and nick changes don't say which channels they're for.
+	switch ev.Name {
+	case irc.RPL_ENDOFNAMES:
+		if state != nil && len(ev.Args) > 1 {
+			for _, host := range state.UsersByChannel(ev.Args[1]) {
+				c.members.set(network, irc.Nick(host), state.ChannelsByUser(host))
+			}
+		}
+		return
+	case irc.QUIT:
+		e.Kind, e.Message = kindQuit, arg(ev, 0)
+		c.log(network, onChannels(state, c.members.take(network, ev.Nick())), e)
+		return
+	case irc.NICK:
+		e.Kind, e.Target = kindNick, arg(ev, 0)
+		channels := c.members.take(network, ev.Nick())
+		c.refresh(state, network, e.Target)
+		c.log(network, onChannels(state, channels), e)
+		return
+	}
+
+	if len(ev.Args) == 0 || !ev.IsTargetChan() {
+		return
+	}
+	ch := ev.Target()
+
+	switch ev.Name {
+	case irc.PRIVMSG:
+		e.Kind, e.Message = kindMessage, arg(ev, 1)
+		if ev.IsCTCP() {
+			tag, data := ev.UnpackCTCP()
+			if tag != "ACTION" {
+				return
+			}
+			e.Kind, e.Message = kindAction, data
+		}
+	case irc.NOTICE:
+		e.Kind, e.Message = kindNotice, arg(ev, 1)
+	case irc.JOIN:
+		e.Kind = kindJoin
+	case irc.PART:
+		e.Kind, e.Message = kindPart, arg(ev, 1)
+	case irc.KICK:
+		e.Kind, e.Target, e.Message = kindKick, arg(ev, 1), arg(ev, 2)
+		c.refresh(state, network, e.Target)
+	case irc.TOPIC:
+		e.Kind, e.Message = kindTopic, arg(ev, 1)
+	case irc.MODE:
+		e.Kind, e.Message = kindMode, strings.Join(ev.Args[1:], " ")
+	default:
+		return
+	}
+
+	c.refresh(state, network, ev.Nick())
+	c.log(network, []string{ch}, e)
+}
+
+// log an entry to the channels that haven't opted out.
+func (c *Chanlog) log(network string, channels []string, e entry) {
+	for _, ch := range channels {
+		if !settings.Bool(c.b, network, ch, "chanlog", "log") {
+			continue
+		}
+
+		format := settings.String(c.b, network, ch, "chanlog", "format")
+		if err := c.files.write(network, ch, format, e); err != nil {
+			c.b.Logger.Error("failed to write channel log", "network", network,
+				"channel", ch, "err", err)
+		}
+	}
+}
+
+// refresh what channels a nick is on from the bot's state.
+func (c *Chanlog) refresh(state *data.State, network, nick string) {
+	if state != nil {
+		c.members.set(network, nick, state.ChannelsByUser(nick))
+	}
+}
+
+// Grep searches a channel's recent logs.
+func (c *Chanlog) Grep(w irc.Writer, ev *cmd.Event) error {
+	if !admin.IsOwner(ev.StoredUser) {
+		return dispatch.MakeGlobalFlagsError(admin.OwnerFlag)
+	}
+	if ev.TargetChannel == nil {
+		return errors.New("Must be a channel that the bot is on")
+	}
+	network, nick, ch := ev.NetworkID, ev.Nick(), ev.TargetChannel.Name
+
+	matches, err := matcher(ev.Args["pattern"])
+	if err != nil {
+		w.Noticef(nick, "\x02Grep:\x02 Bad regexp: %v", err)
+		return nil
+	}
+
+	found, err := c.files.search(network, ch, grepDays, maxMatches, matches)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		w.Noticef(nick, "\x02Grep:\x02 Nothing in the last %d days of %s matches.", grepDays, ch)
+		return nil
+	}
+
+	w.Noticef(nick, "\x02Grep:\x02 The last %d matches in %s:", len(found), ch)
+	for _, m := range found {
+		ircmsg.Notice(c.b, w, network, nick, m.day+" "+m.line)
+	}
+	return nil
+}
+
+// pruneLoop deletes old logs now and then until done is closed. It's given
+// what it uses instead of reading it from the extension, which a reload
+// replaces while an old loop may still be running.
+func pruneLoop(b *bot.Bot, fs *files, done chan struct{}) {
+	ticker := time.NewTicker(pruneEvery)
+	defer ticker.Stop()
+
+	for {
+		prune(b, fs)
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+func prune(b *bot.Bot, fs *files) {
+	n, err := fs.prune(time.Now(), func(network, channel string) int {
+		return settings.Int(b, network, channel, "chanlog", "keep_days")
+	})
+	if err != nil {
+		b.Logger.Error("failed to prune channel logs", "err", err)
+	} else if n != 0 {
+		b.Logger.Info("pruned channel logs", "count", n)
+	}
+}
+
+// members remembers which channels people are on. The bot's state forgets
+// people who quit before the quit is handled, so it can't say where to log
+// the quit.
+type members struct {
+	mut      sync.Mutex
+	channels map[string][]string
+	// seeded networks have had everyone in the bot's state added, in case
+	// the extension was loaded after the bot joined its channels.
+	seeded map[string]bool
+}
+
+func newMembers() *members {
+	return &members{channels: make(map[string][]string), seeded: make(map[string]bool)}
+}
+
+func (m *members) seed(state *data.State, network string) {
+	if state == nil {
+		return
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.seeded[network] {
+		return
+	}
+	m.seeded[network] = true
+	for _, ch := range state.Channels() {
+		for _, host := range state.UsersByChannel(ch) {
+			m.channels[network+" "+strings.ToLower(irc.Nick(host))] = state.ChannelsByUser(host)
+		}
+	}
+}
+
+func (m *members) set(network, nick string, channels []string) {
+	key := network + " " + strings.ToLower(nick)
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if len(channels) == 0 {
+		delete(m.channels, key)
+	} else {
+		m.channels[key] = channels
+	}
+}
+
+// take the channels a nick is on and forget them.
+func (m *members) take(network, nick string) []string {
+	key := network + " " + strings.ToLower(nick)
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	channels := m.channels[key]
+	delete(m.channels, key)
+	return channels
+}
+
+// onChannels keeps the channels the bot is still on.
+func onChannels(state *data.State, channels []string) []string {
+	if state == nil {
+		return channels
+	}
+
+	self := state.Self().Nick()
+	var on []string
+	for _, ch := range channels {
+		if state.IsOn(self, ch) {
+			on = append(on, ch)
+		}
+	}
+	return on
+}
+
+// matcher matches lines containing pattern, ignoring case, or the regexp in
+// it if it's wrapped in slashes.
+func matcher(pattern string) (func(string) bool, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		rgx, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+		if err != nil {
+			return nil, err
+		}
+		return rgx.MatchString, nil
+	}
+
+	lower := strings.ToLower(pattern)
+	return func(line string) bool {
+		return strings.Contains(strings.ToLower(line), lower)
+	}, nil
+}
+
+func arg(ev *irc.Event, i int) string {
+	if i < len(ev.Args) {
+		return ev.Args[i]
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package chanlog
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/internal/testbot"
+	"github.com/aarondl/uq/settings"
+)
+
+// newTestChanlog makes a Chanlog writing to a temporary directory on a bot
+// with a store for settings.
+func newTestChanlog(t *testing.T) *Chanlog {
+	t.Helper()
+
+	dir := t.TempDir()
+	b := testbot.New(t, fmt.Sprintf(`chanlog_dir = %q`, filepath.Join(dir, "botlogs")))
+	// bot.New loaded chanlog too, it's stopped before the bot is closed
+	// like the bot does when it shuts down.
+	t.Cleanup(func() { ext.Unload(b, "chanlog") })
+
+	c := &Chanlog{b: b, files: newFiles(filepath.Join(dir, "logs")), members: newMembers()}
+	t.Cleanup(c.files.close)
+	return c
+}
+
+// feed updates the bot's state with each event and then handles it, the
+// order the bot does it in.
+func feed(c *Chanlog, events ...*irc.Event) {
+	state := c.b.State("test")
+	for _, ev := range events {
+		state.Update(ev)
+		c.Handle(nil, ev)
+	}
+}
+
+// logged is every line in a channel's logs without its time, the lines
+// the text format starts each day with are left out.
+func logged(t *testing.T, c *Chanlog, ch string) []string {
+	t.Helper()
+
+	found, err := c.files.search("test", ch, 2, 100, func(string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, m := range found {
+		if strings.HasPrefix(m.line, "--- ") {
+			continue
+		}
+		lines = append(lines, m.line[len(timeFormat)+1:])
+	}
+	return lines
+}
+
+func TestHandleQuitAndNick(t *testing.T) {
+	c := newTestChanlog(t)
+	ni := irc.NewNetworkInfo()
+
+	if err := settings.Set(c.b, "test", "#quiet", "chanlog", "log", "false"); err != nil {
+		t.Fatal(err)
+	}
+
+	feed(c,
+		irc.NewEvent("test", ni, irc.RPL_WELCOME, "irc.test.net", "uq", "Welcome uq!uq@uq.host"),
+		irc.NewEvent("test", ni, irc.JOIN, "uq!uq@uq.host", "#a"),
+		irc.NewEvent("test", ni, irc.JOIN, "uq!uq@uq.host", "#b"),
+		irc.NewEvent("test", ni, irc.JOIN, "uq!uq@uq.host", "#quiet"),
+		irc.NewEvent("test", ni, irc.JOIN, "nick!n@n.host", "#a"),
+		irc.NewEvent("test", ni, irc.JOIN, "nick!n@n.host", "#b"),
+		irc.NewEvent("test", ni, irc.JOIN, "nick!n@n.host", "#quiet"),
+		irc.NewEvent("test", ni, irc.JOIN, "other!o@o.host", "#b"),
+		irc.NewEvent("test", ni, irc.PRIVMSG, "nick!n@n.host", "#quiet", "secret"),
+		irc.NewEvent("test", ni, irc.NICK, "nick!n@n.host", "renamed"),
+		irc.NewEvent("test", ni, irc.PART, "uq!uq@uq.host", "#b", "bye"),
+		irc.NewEvent("test", ni, irc.QUIT, "renamed!n@n.host", "gone"),
+		irc.NewEvent("test", ni, irc.QUIT, "other!o@o.host", "gone too"),
+	)
+
+	wantA := []string{
+		"-!- uq [uq@uq.host] has joined #a",
+		"-!- nick [n@n.host] has joined #a",
+		"-!- nick is now known as renamed",
+		"-!- renamed [n@n.host] has quit [gone]",
+	}
+	if got := logged(t, c, "#a"); !reflect.DeepEqual(got, wantA) {
+		t.Errorf("#a: want %q, got %q", wantA, got)
+	}
+
+	// The bot left #b before they quit, so their quits aren't logged there.
+	wantB := []string{
+		"-!- uq [uq@uq.host] has joined #b",
+		"-!- nick [n@n.host] has joined #b",
+		"-!- other [o@o.host] has joined #b",
+		"-!- nick is now known as renamed",
+		"-!- uq [uq@uq.host] has left #b [bye]",
+	}
+	if got := logged(t, c, "#b"); !reflect.DeepEqual(got, wantB) {
+		t.Errorf("#b: want %q, got %q", wantB, got)
+	}
+
+	if got := logged(t, c, "#quiet"); len(got) != 0 {
+		t.Errorf("#quiet opted out, got %q", got)
+	}
+
+	if channels := c.members.take("test", "renamed"); len(channels) != 0 {
+		t.Errorf("want someone who quit forgotten, got %v", channels)
+	}
+}
+
+func TestInitSeedsMembers(t *testing.T) {
+	c := newTestChanlog(t)
+	ni := irc.NewNetworkInfo()
+
+	// The bot was on the channels before the extension was loaded.
+	feed(c,
+		irc.NewEvent("test", ni, irc.RPL_WELCOME, "irc.test.net", "uq", "Welcome uq!uq@uq.host"),
+		irc.NewEvent("test", ni, irc.JOIN, "uq!uq@uq.host", "#a"),
+		irc.NewEvent("test", ni, irc.JOIN, "nick!n@n.host", "#a"),
+	)
+
+	if err := ext.Unload(c.b, "chanlog"); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &Chanlog{}
+	if err := loaded.Init(c.b); err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Deinit(c.b)
+
+	feed(loaded, irc.NewEvent("test", ni, irc.QUIT, "nick!n@n.host", "gone"))
+
+	want := []string{"-!- nick [n@n.host] has quit [gone]"}
+	if got := logged(t, loaded, "#a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("want the quit logged for someone there before the load, got %q", got)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		line    string
+		want    bool
+	}{
+		{"Hello", "<a> hello there", true},
+		{"bye", "<a> hello there", false},
+		{"/^<a> h.llo/", "<A> HELLO there", true},
+		{"/^there/", "<a> hello there", false},
+		{"/", "a / b", true},
+	}
+
+	for _, test := range tests {
+		matches, err := matcher(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := matches(test.line); got != test.want {
+			t.Errorf("%s on %q: want %v, got %v", test.pattern, test.line, test.want, got)
+		}
+	}
+
+	if _, err := matcher("/(/"); err == nil {
+		t.Errorf("want a bad regexp refused, got %v", err)
+	}
+}
@@ -0,0 +1,352 @@
+package chanlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dayFormat  = "2006-01-02"
+	timeFormat = "15:04:05"
+	// maxLine is the longest log line searched, irc lines are far shorter.
+	maxLine = 64 * 1024
+	// nameFile holds the channel's name in its directory, the directory's
+	// name is lower cased and has slashes swapped out.
+	nameFile = ".channel"
+)
+
+// The kinds of entry.
+const (
+	kindMessage = "message"
+	kindAction  = "action"
+	kindNotice  = "notice"
+	kindJoin    = "join"
+	kindPart    = "part"
+	kindQuit    = "quit"
+	kindKick    = "kick"
+	kindNick    = "nick"
+	kindTopic   = "topic"
+	kindMode    = "mode"
+)
+
+// entry is one thing that happened in a channel, it's what the json format
+// writes.
+type entry struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+	Nick string    `json:"nick,omitempty"`
+	// Host is user@host.
+	Host string `json:"host,omitempty"`
+	// Target is who was kicked or the new nick.
+	Target  string `json:"target,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// text formats an entry like irssi does.
+func (e entry) text(channel string) string {
+	var line string
+	switch e.Kind {
+	case kindMessage:
+		line = fmt.Sprintf("<%s> %s", e.Nick, e.Message)
+	case kindAction:
+		line = fmt.Sprintf(" * %s %s", e.Nick, e.Message)
+	case kindNotice:
+		line = fmt.Sprintf("-%s:%s- %s", e.Nick, channel, e.Message)
+	case kindJoin:
+		line = fmt.Sprintf("-!- %s [%s] has joined %s", e.Nick, e.Host, channel)
+	case kindPart:
+		line = fmt.Sprintf("-!- %s [%s] has left %s [%s]", e.Nick, e.Host, channel, e.Message)
+	case kindQuit:
+		line = fmt.Sprintf("-!- %s [%s] has quit [%s]", e.Nick, e.Host, e.Message)
+	case kindKick:
+		line = fmt.Sprintf("-!- %s was kicked from %s by %s [%s]", e.Target, channel, e.Nick, e.Message)
+	case kindNick:
+		line = fmt.Sprintf("-!- %s is now known as %s", e.Nick, e.Target)
+	case kindTopic:
+		line = fmt.Sprintf("-!- %s changed the topic of %s to: %s", e.Nick, channel, e.Message)
+	case kindMode:
+		line = fmt.Sprintf("-!- mode/%s [%s] by %s", channel, e.Message, e.Nick)
+	default:
+		line = fmt.Sprintf("-!- %s %s %s", e.Kind, e.Nick, e.Message)
+	}
+	return e.Time.Format(timeFormat) + " " + line
+}
+
+// logFile is a channel's open log for a day.
+type logFile struct {
+	day    string
+	format string
+	f      *os.File
+}
+
+// files writes each channel's log to dir/network/channel/day.log, or .jsonl
+// for json, starting a new file every day.
+type files struct {
+	dir string
+
+	mut  sync.Mutex
+	open map[string]*logFile
+}
+
+func newFiles(dir string) *files {
+	return &files{dir: dir, open: make(map[string]*logFile)}
+}
+
+// write an entry to a channel's log in format, text or json.
+func (fs *files) write(network, channel, format string, e entry) error {
+	var line []byte
+	if format == "json" {
+		var err error
+		if line, err = json.Marshal(e); err != nil {
+			return err
+		}
+	} else {
+		format = "text"
+		line = []byte(e.text(channel))
+	}
+	line = append(line, '\n')
+
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	lf, err := fs.file(network, channel, format, e.Time)
+	if err != nil {
+		return err
+	}
+	_, err = lf.f.Write(line)
+	return err
+}
+
+// file returns the log to write to, rotating it if the day or format has
+// changed. It must be called with mut held.
+func (fs *files) file(network, channel, format string, now time.Time) (*logFile, error) {
+	key := network + " " + strings.ToLower(channel)
+	day := now.Format(dayFormat)
+
+	if lf, ok := fs.open[key]; ok {
+		if lf.day == day && lf.format == format {
+			return lf, nil
+		}
+		lf.f.Close()
+		delete(fs.open, key)
+	}
+
+	dir := fs.channelDir(network, channel)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, nameFile), []byte(channel), 0644); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, day+extension(format))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "text" {
+		if info, err := f.Stat(); err == nil && info.Size() == 0 {
+			fmt.Fprintf(f, "--- Log opened %s\n", now.Format("Mon Jan 02 15:04:05 2006"))
+		}
+	}
+
+	lf := &logFile{day: day, format: format, f: f}
+	fs.open[key] = lf
+	return lf, nil
+}
+
+// close every open log.
+func (fs *files) close() {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	for key, lf := range fs.open {
+		lf.f.Close()
+		delete(fs.open, key)
+	}
+}
+
+// prune deletes the logs older than keep days, keep is asked for each
+// channel and 0 keeps everything.
+func (fs *files) prune(now time.Time, keep func(network, channel string) int) (int, error) {
+	networks, err := os.ReadDir(fs.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	today, _ := time.ParseInLocation(dayFormat, now.Format(dayFormat), now.Location())
+
+	removed := 0
+	for _, network := range networks {
+		if !network.IsDir() {
+			continue
+		}
+		channels, err := os.ReadDir(filepath.Join(fs.dir, network.Name()))
+		if err != nil {
+			return removed, err
+		}
+
+		for _, channel := range channels {
+			if !channel.IsDir() {
+				continue
+			}
+			dir := filepath.Join(fs.dir, network.Name(), channel.Name())
+			days := keep(network.Name(), channelName(dir))
+			if days <= 0 {
+				continue
+			}
+			cutoff := today.AddDate(0, 0, -days)
+
+			for _, name := range logNames(dir) {
+				day, err := time.ParseInLocation(dayFormat, logDay(name), now.Location())
+				if err != nil || !day.Before(cutoff) {
+					continue
+				}
+				if err = os.Remove(filepath.Join(dir, name)); err != nil {
+					return removed, err
+				}
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
+// match is a log line that matched a search.
+type match struct {
+	day  string
+	line string
+}
+
+// search a channel's last days of logs for lines that match, returning the
+// newest max of them oldest first.
+func (fs *files) search(network, channel string, days, max int, matches func(string) bool) ([]match, error) {
+	dir := fs.channelDir(network, channel)
+	names := logNames(dir)
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	// A day can have a text and a json log if the format was changed.
+	seen := make(map[string]bool)
+	for i, name := range names {
+		day := logDay(name)
+		if !seen[day] && len(seen) == days {
+			names = names[:i]
+			break
+		}
+		seen[day] = true
+	}
+
+	var found []match
+	for _, name := range names {
+		day := logDay(name)
+		lines, err := searchFile(filepath.Join(dir, name), channel, matches)
+		if err != nil {
+			return nil, err
+		}
+
+		dayMatches := make([]match, len(lines))
+		for i, line := range lines {
+			dayMatches[i] = match{day: day, line: line}
+		}
+		found = append(dayMatches, found...)
+		if len(found) >= max {
+			break
+		}
+	}
+
+	if len(found) > max {
+		found = found[len(found)-max:]
+	}
+	return found, nil
+}
+
+// searchFile returns the lines of a log that match, json lines are shown as
+// text.
+func searchFile(path, channel string, matches func(string) bool) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	isJSON := strings.HasSuffix(path, extension("json"))
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 4096), maxLine)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if isJSON {
+			if line = decode(line, channel); len(line) == 0 {
+				continue
+			}
+		}
+		if matches(line) {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func decode(line, channel string) string {
+	var e entry
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		return ""
+	}
+	return e.text(channel)
+}
+
+// channelDir is where a channel's logs go, channels can have slashes in them
+// so they're swapped out.
+func (fs *files) channelDir(network, channel string) string {
+	clean := strings.NewReplacer("/", "_", "\\", "_").Replace(strings.ToLower(channel))
+	return filepath.Join(fs.dir, network, clean)
+}
+
+// channelName reads the channel's name from its directory, falling back to
+// the directory's name for logs written before it was kept.
+func channelName(dir string) string {
+	name, err := os.ReadFile(filepath.Join(dir, nameFile))
+	if err != nil || len(name) == 0 {
+		return filepath.Base(dir)
+	}
+	return string(name)
+}
+
+// logNames lists the logs in a channel's directory.
+func logNames(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && (strings.HasSuffix(name, extension("text")) || strings.HasSuffix(name, extension("json"))) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func logDay(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func extension(format string) string {
+	if format == "json" {
+		return ".jsonl"
+	}
+	return ".log"
+}
@@ -0,0 +1,76 @@
+package chanlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPruneUsesChannelName(t *testing.T) {
+	t.Parallel()
+
+	fs := newFiles(t.TempDir())
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		e := entry{Time: now.AddDate(0, 0, -i), Kind: kindMessage, Nick: "nick", Message: "hi"}
+		if err := fs.write("net", "#Foo/Bar", "text", e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs.close()
+
+	var asked []string
+	n, err := fs.prune(now, func(network, channel string) int {
+		asked = append(asked, network+" "+channel)
+		return 2
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 1 || asked[0] != "net #Foo/Bar" {
+		t.Errorf("want keep asked about net #Foo/Bar, got %v", asked)
+	}
+	if n != 2 {
+		t.Errorf("want the 2 logs older than 2 days removed, got %d", n)
+	}
+}
+
+func TestSearchCountsDays(t *testing.T) {
+	t.Parallel()
+
+	fs := newFiles(t.TempDir())
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	write := func(day int, format, msg string) {
+		e := entry{Time: now.AddDate(0, 0, -day), Kind: kindMessage, Nick: "nick", Message: msg}
+		if err := fs.write("net", "#chan", format, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Today has both a text and a json log since the format was changed.
+	write(0, "text", "needle today text")
+	write(0, "json", "needle today json")
+	write(1, "text", "needle yesterday")
+	write(2, "text", "needle two days ago")
+	fs.close()
+
+	found, err := fs.search("net", "#chan", 2, 10, func(line string) bool {
+		return strings.Contains(line, "needle")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, m := range found {
+		got = append(got, m.line[strings.Index(m.line, "needle"):])
+	}
+	if len(got) != 3 {
+		t.Fatalf("want the matches from 2 days, got %v", got)
+	}
+	for _, line := range got {
+		if line == "needle two days ago" {
+			t.Errorf("the third day shouldn't be searched, got %v", got)
+		}
+	}
+}
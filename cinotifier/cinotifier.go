@@ -0,0 +1,140 @@
+// Package cinotifier relays notifications from CI services to an irc
+// channel using cinotify.
+package cinotifier
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/aarondl/cinotify"
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/uq/ext"
+)
+
+var (
+	mut     sync.RWMutex
+	current *Notifier
+
+	// cinotify has no way to remove notifiers or stop its server so both
+	// only ever happen once. To only reaches the services registered so far
+	// which is why it waits for Init instead of happening in init().
+	addNotifier sync.Once
+	startServer sync.Once
+	serverBind  string
+)
+
+func init() {
+	ext.RegisterExtension("cinotify", &Notifier{})
+}
+
+type ciLogger struct {
+	b *bot.Bot
+}
+
+func (c ciLogger) Write(msg []byte) (int, error) {
+	c.b.Logger.Error(string(msg))
+	return len(msg), nil
+}
+
+// Notifier extension
+type Notifier struct {
+	b *bot.Bot
+
+	mut     sync.RWMutex
+	network string
+	channel string
+}
+
+// Init the extension
+func (n *Notifier) Init(b *bot.Bot) error {
+	n.b = b
+	cinotify.Logger = log.New(ciLogger{b: b}, "", 0)
+	addNotifier.Do(func() {
+		cinotify.To(cinotify.NotifyFunc(notify))
+	})
+
+	n.loadConfig(b)
+
+	mut.Lock()
+	current = n
+	mut.Unlock()
+
+	return nil
+}
+
+// Deinit the extension
+func (n *Notifier) Deinit(b *bot.Bot) error {
+	mut.Lock()
+	if current == n {
+		current = nil
+	}
+	mut.Unlock()
+
+	return nil
+}
+
+// Rehash switches to the newly configured network and channel.
+func (n *Notifier) Rehash(b *bot.Bot) error {
+	n.loadConfig(b)
+	return nil
+}
+
+func (n *Notifier) loadConfig(b *bot.Bot) {
+	var network, channel, bind string
+	b.ReadConfig(func(cfg *config.Config) {
+		network, _ = cfg.ExtGlobal().ConfigVal("", "", "cinotify_network")
+		channel, _ = cfg.ExtGlobal().ConfigVal("", "", "cinotify_channel")
+		bind, _ = cfg.ExtGlobal().ConfigVal("", "", "cinotify_bind")
+	})
+
+	n.mut.Lock()
+	n.network, n.channel = network, channel
+	n.mut.Unlock()
+
+	if len(network) == 0 || len(channel) == 0 {
+		return
+	}
+
+	b.Logger.Info("cinotify", "net", network, "chan", channel)
+	started := false
+	startServer.Do(func() {
+		started, serverBind = true, bind
+		go func() {
+			if err := cinotify.StartServer(bind); err != nil {
+				b.Logger.Error("cinotify", "err", err)
+			}
+		}()
+	})
+
+	if !started && bind != serverBind {
+		b.Logger.Info("cinotify: cinotify_bind changes need a restart",
+			"bind", serverBind)
+	}
+}
+
+func notify(name string, notification fmt.Stringer) {
+	mut.RLock()
+	n := current
+	mut.RUnlock()
+
+	if n == nil {
+		return
+	}
+
+	n.mut.RLock()
+	network, channel := n.network, n.channel
+	n.mut.RUnlock()
+
+	if len(network) == 0 || len(channel) == 0 {
+		return
+	}
+
+	writer := n.b.NetworkWriter(network)
+	if writer == nil {
+		return
+	}
+
+	writer.Privmsgln(channel, notification)
+}
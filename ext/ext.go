@@ -0,0 +1,375 @@
+// Package ext keeps track of uq's extensions and what they register with
+// the bot so that they can be unloaded, loaded and reloaded at runtime.
+//
+// Extensions register themselves with RegisterExtension instead of
+// bot.RegisterExtension and use this package's Register and RegisterCmd
+// wrappers so that their handlers and commands can be listed and cleaned up.
+package ext
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/dispatch"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+)
+
+var (
+	// loadMut serializes Init and Deinit calls so that registrations can be
+	// attributed to the extension being initialized.
+	loadMut sync.Mutex
+
+	mut          sync.Mutex
+	extensions   = make(map[string]*entry)
+	initializing *entry
+)
+
+// Rehasher is implemented by extensions that can apply config changes
+// without being reloaded.
+type Rehasher interface {
+	Rehash(b *bot.Bot) error
+}
+
+// Info describes an extension.
+type Info struct {
+	Name   string
+	Loaded bool
+	// Cmds is the commands the extension has registered, in ext.cmd form.
+	Cmds []string
+	// Handlers is the named event handlers the extension has registered.
+	Handlers []string
+}
+
+// entry wraps an extension so that its state can be tracked, it's what is
+// actually registered with the bot.
+type entry struct {
+	name string
+	ext  bot.Extension
+	// loaded is written with both loadMut and mut held so it can be read
+	// with either.
+	loaded bool
+
+	// handlers maps ids to the name given to RegisterNamed
+	handlers map[uint64]string
+	cmds     map[uint64]*cmd.Command
+}
+
+// RegisterExtension with the bot. Like bot.RegisterExtension this should be
+// called in init() and panics if the name is registered twice.
+func RegisterExtension(name string, e bot.Extension) {
+	en := &entry{
+		name:     name,
+		ext:      e,
+		handlers: make(map[uint64]string),
+		cmds:     make(map[uint64]*cmd.Command),
+	}
+
+	bot.RegisterExtension(name, en)
+
+	mut.Lock()
+	extensions[name] = en
+	mut.Unlock()
+}
+
+// Register an event handler with the bot, see bot.Register. The handler
+// is skipped in channels the extension is disabled in.
+func Register(b *bot.Bot, network, channel, event string, handler dispatch.Handler) uint64 {
+	return RegisterNamed(b, "", network, channel, event, handler)
+}
+
+// RegisterNamed is like Register but the handler can also be disabled on
+// its own using ext.name.
+func RegisterNamed(b *bot.Bot, name, network, channel, event string, handler dispatch.Handler) uint64 {
+	mut.Lock()
+	en := initializing
+	mut.Unlock()
+
+	guard := handlerGuard{b: b, handler: handler}
+	if en != nil {
+		guard.keys = []string{en.name}
+		if len(name) != 0 {
+			guard.keys = append(guard.keys, en.name+"."+name)
+		}
+	}
+
+	id := b.Register(network, channel, event, guard)
+
+	if en != nil {
+		mut.Lock()
+		en.handlers[id] = name
+		mut.Unlock()
+	}
+
+	return id
+}
+
+// Unregister an event handler from the bot, see bot.Unregister.
+func Unregister(b *bot.Bot, id uint64) bool {
+	mut.Lock()
+	for _, en := range extensions {
+		delete(en.handlers, id)
+	}
+	mut.Unlock()
+
+	return b.Unregister(id)
+}
+
+// RegisterCmd registers a command with the bot, see bot.RegisterCmd. The
+// command's handler is wrapped so that it's ignored in channels that the
+// extension or the command is disabled in.
+func RegisterCmd(b *bot.Bot, network, channel string, command *cmd.Command) (uint64, error) {
+	mut.Lock()
+	en := initializing
+	mut.Unlock()
+
+	guard := cmdGuard{b: b, handler: command.Handler}
+	cmdExt := strings.ToLower(command.Extension)
+	guard.keys = []string{cmdExt, cmdExt + "." + command.Name}
+	if en != nil && en.name != cmdExt {
+		guard.keys = append(guard.keys, en.name, en.name+"."+command.Name)
+	}
+	command.Handler = guard
+
+	id, err := b.RegisterCmd(network, channel, command)
+	if err != nil {
+		return id, err
+	}
+
+	if en != nil {
+		mut.Lock()
+		en.cmds[id] = command
+		mut.Unlock()
+	}
+
+	return id, nil
+}
+
+// UnregisterCmd unregisters a command from the bot, see bot.UnregisterCmd.
+func UnregisterCmd(b *bot.Bot, id uint64) bool {
+	mut.Lock()
+	for _, en := range extensions {
+		delete(en.cmds, id)
+	}
+	mut.Unlock()
+
+	return b.UnregisterCmd(id)
+}
+
+// Load initializes an unloaded extension.
+func Load(b *bot.Bot, name string) error {
+	en, err := find(name)
+	if err != nil {
+		return err
+	}
+
+	loadMut.Lock()
+	defer loadMut.Unlock()
+
+	if en.loaded {
+		return fmt.Errorf("%s is already loaded", name)
+	}
+	return en.init(b)
+}
+
+// Unload deinitializes a loaded extension.
+func Unload(b *bot.Bot, name string) error {
+	en, err := find(name)
+	if err != nil {
+		return err
+	}
+
+	loadMut.Lock()
+	defer loadMut.Unlock()
+
+	if !en.loaded {
+		return fmt.Errorf("%s is not loaded", name)
+	}
+	return en.deinit(b)
+}
+
+// Reload deinitializes an extension if it's loaded and then initializes it.
+func Reload(b *bot.Bot, name string) error {
+	en, err := find(name)
+	if err != nil {
+		return err
+	}
+
+	loadMut.Lock()
+	defer loadMut.Unlock()
+
+	if en.loaded {
+		if err := en.deinit(b); err != nil {
+			return err
+		}
+	}
+	return en.init(b)
+}
+
+// List all the extensions sorted by name.
+func List() []Info {
+	mut.Lock()
+	defer mut.Unlock()
+
+	infos := make([]Info, 0, len(extensions))
+	for _, en := range extensions {
+		info := Info{Name: en.name, Loaded: en.loaded}
+		for _, c := range en.cmds {
+			info.Cmds = append(info.Cmds, c.Extension+"."+c.Name)
+		}
+		for _, name := range en.handlers {
+			if len(name) != 0 {
+				info.Handlers = append(info.Handlers, en.name+"."+name)
+			}
+		}
+		sort.Strings(info.Cmds)
+		sort.Strings(info.Handlers)
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Each calls fn for every loaded extension with the extension itself.
+// Useful for finding extensions that implement optional interfaces.
+func Each(fn func(name string, e bot.Extension)) {
+	mut.Lock()
+	var loaded []*entry
+	for _, en := range extensions {
+		if en.loaded {
+			loaded = append(loaded, en)
+		}
+	}
+	mut.Unlock()
+
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].name < loaded[j].name })
+	for _, en := range loaded {
+		fn(en.name, en.ext)
+	}
+}
+
+// Rehash reloads the bot's config file and then lets every loaded extension
+// that implements Rehasher apply the new values. Errors from extensions are
+// collected so that one bad extension doesn't stop the others from updating.
+//
+// bot.Rehash isn't used since it reads the store file instead of the config.
+func Rehash(b *bot.Bot) error {
+	var filename string
+	b.ReadConfig(func(cfg *config.Config) {
+		filename = cfg.Filename()
+	})
+
+	conf := config.New().FromFile(filename)
+	if !bot.CheckConfig(conf) {
+		return fmt.Errorf("%s is not a valid config, see the log", filename)
+	}
+	if !b.ReplaceConfig(conf) {
+		return fmt.Errorf("failed to replace the config with %s", filename)
+	}
+
+	loadMut.Lock()
+	defer loadMut.Unlock()
+
+	var errs []string
+	Each(func(name string, e bot.Extension) {
+		r, ok := e.(Rehasher)
+		if !ok {
+			return
+		}
+		if err := r.Rehash(b); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	})
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func find(name string) (*entry, error) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	en, ok := extensions[name]
+	if !ok {
+		return nil, errors.New("no such extension: " + name)
+	}
+	return en, nil
+}
+
+// Init is called by the bot on startup.
+func (en *entry) Init(b *bot.Bot) error {
+	loadMut.Lock()
+	defer loadMut.Unlock()
+
+	return en.init(b)
+}
+
+// Deinit is called by the bot on shutdown, it's a no-op if the extension
+// was unloaded already.
+func (en *entry) Deinit(b *bot.Bot) error {
+	loadMut.Lock()
+	defer loadMut.Unlock()
+
+	if !en.loaded {
+		return nil
+	}
+	return en.deinit(b)
+}
+
+// init must be called with loadMut held.
+func (en *entry) init(b *bot.Bot) error {
+	mut.Lock()
+	initializing = en
+	mut.Unlock()
+
+	err := en.ext.Init(b)
+
+	mut.Lock()
+	initializing = nil
+	mut.Unlock()
+
+	if err != nil {
+		// Don't leave half an extension registered.
+		en.cleanup(b)
+		return err
+	}
+
+	mut.Lock()
+	en.loaded = true
+	mut.Unlock()
+	return nil
+}
+
+// deinit must be called with loadMut held.
+func (en *entry) deinit(b *bot.Bot) error {
+	err := en.ext.Deinit(b)
+	en.cleanup(b)
+
+	mut.Lock()
+	en.loaded = false
+	mut.Unlock()
+	return err
+}
+
+// cleanup unregisters anything the extension left registered.
+func (en *entry) cleanup(b *bot.Bot) {
+	mut.Lock()
+	handlers, cmds := en.handlers, en.cmds
+	en.handlers = make(map[uint64]string)
+	en.cmds = make(map[uint64]*cmd.Command)
+	mut.Unlock()
+
+	for id := range handlers {
+		b.Unregister(id)
+	}
+	for id := range cmds {
+		b.UnregisterCmd(id)
+	}
+}
@@ -0,0 +1,123 @@
+package ext
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+)
+
+const testConfig = `nick = "uq"
+altnick = "uq_"
+username = "uq"
+realname = "uq"
+noreconnect = true
+nostore = true
+[networks.test]
+	servers = ["irc.test.net"]
+[ext.config]
+	rehash_test = "%s"
+`
+
+// rehasher remembers the value of rehash_test each time it's rehashed.
+type rehasher struct {
+	got []string
+}
+
+func (r *rehasher) Init(*bot.Bot) error   { return nil }
+func (r *rehasher) Deinit(*bot.Bot) error { return nil }
+
+var testRehasher = &rehasher{}
+
+func init() {
+	RegisterExtension("rehashtest", testRehasher)
+}
+
+func (r *rehasher) Rehash(b *bot.Bot) error {
+	b.ReadConfig(func(cfg *config.Config) {
+		val, _ := cfg.ExtGlobal().ConfigVal("", "", "rehash_test")
+		r.got = append(r.got, val)
+	})
+	return nil
+}
+
+func writeConfig(t *testing.T, filename, val string) {
+	t.Helper()
+	contents := []byte(fmt.Sprintf(testConfig, val))
+	if err := os.WriteFile(filename, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRehash(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, filename, "before")
+
+	b, err := bot.New(config.New().FromFile(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// bot.New loaded it along with every other registered extension.
+	r := testRehasher
+	r.got = nil
+
+	writeConfig(t, filename, "after")
+	if err = Rehash(b); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.got) != 1 || r.got[0] != "after" {
+		t.Errorf("want the rehasher to see [after], got %v", r.got)
+	}
+
+	if err = os.WriteFile(filename, []byte("nick = "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = Rehash(b); err == nil {
+		t.Error("want an error for a broken config")
+	}
+	if len(r.got) != 1 {
+		t.Errorf("the rehasher shouldn't run for a broken config, got %v", r.got)
+	}
+	b.ReadConfig(func(cfg *config.Config) {
+		if val, _ := cfg.ExtGlobal().ConfigVal("", "", "rehash_test"); val != "after" {
+			t.Errorf("a broken config shouldn't replace the old one, got %q", val)
+		}
+	})
+}
+
+func TestListWhileReloading(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, filename, "list")
+
+	b, err := bot.New(config.New().FromFile(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if err := Reload(b, "rehashtest"); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			List()
+			Each(func(string, bot.Extension) {})
+		}
+	}
+}
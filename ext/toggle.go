@@ -0,0 +1,257 @@
+package ext
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+// toggleKey is the key in a StoredChannel's JSONStorer the disabled
+// extensions and commands are kept in.
+const toggleKey = "disabled"
+
+var (
+	// storeMut serializes read-modify-write cycles on stored channels and users.
+	storeMut sync.Mutex
+
+	toggleMut sync.RWMutex
+	// toggles caches each channel's disabled keys by network and channel.
+	toggles = make(map[string]map[string]bool)
+)
+
+// handlerGuard skips an event handler in channels it's disabled in.
+type handlerGuard struct {
+	b       *bot.Bot
+	keys    []string
+	handler dispatch.Handler
+}
+
+// Handle the event if it's not disabled.
+func (g handlerGuard) Handle(w irc.Writer, ev *irc.Event) {
+	if len(ev.Args) != 0 && ev.IsTargetChan() &&
+		anyDisabled(g.b, ev.NetworkID, ev.Target(), g.keys) {
+		return
+	}
+	g.handler.Handle(w, ev)
+}
+
+// cmdGuard skips a command in channels it's disabled in. Since the
+// dispatcher can only see the guard it does the lookup of the method named
+// after the command itself.
+type cmdGuard struct {
+	b       *bot.Bot
+	keys    []string
+	handler cmd.Handler
+}
+
+// Cmd calls the command's method or the handler's Cmd if it's not disabled.
+func (g cmdGuard) Cmd(name string, w irc.Writer, ev *cmd.Event) error {
+	if ev.IsTargetChan() && anyDisabled(g.b, ev.NetworkID, ev.Target(), g.keys) {
+		return nil
+	}
+
+	if len(name) != 0 {
+		method := reflect.ValueOf(g.handler).MethodByName(strings.ToUpper(name[:1]) + name[1:])
+		if method.IsValid() {
+			if fn, ok := method.Interface().(func(irc.Writer, *cmd.Event) error); ok {
+				return fn(w, ev)
+			}
+		}
+	}
+
+	return g.handler.Cmd(name, w, ev)
+}
+
+// Disable an extension or a single command or handler, given in ext.name
+// form, in a channel.
+func Disable(b *bot.Bot, network, channel, key string) error {
+	return toggle(b, network, channel, strings.ToLower(key), true)
+}
+
+// Enable something that was disabled in a channel.
+func Enable(b *bot.Bot, network, channel, key string) error {
+	return toggle(b, network, channel, strings.ToLower(key), false)
+}
+
+// Disabled returns the sorted keys disabled in a channel.
+func Disabled(b *bot.Bot, network, channel string) []string {
+	var keys []string
+	for key := range disabledIn(b, network, channel) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Known checks that key names an extension, a command or a named handler
+// so that typos don't get stored.
+func Known(key string) bool {
+	key = strings.ToLower(key)
+
+	mut.Lock()
+	defer mut.Unlock()
+
+	for _, en := range extensions {
+		if key == en.name {
+			return true
+		}
+		for _, name := range en.handlers {
+			if len(name) != 0 && key == en.name+"."+name {
+				return true
+			}
+		}
+		for _, c := range en.cmds {
+			if key == c.Extension || key == c.Extension+"."+c.Name || key == en.name+"."+c.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UpdateChannel loads (or creates) a stored channel, lets fn change it and
+// saves it. The store doesn't lock around changes so everything in uq that
+// saves channels should go through here.
+func UpdateChannel(b *bot.Bot, network, channel string, fn func(*data.StoredChannel) error) error {
+	store := b.Store()
+	if store == nil {
+		return errors.New("the bot has no store to save to")
+	}
+
+	storeMut.Lock()
+	defer storeMut.Unlock()
+
+	ch, err := store.FindChannel(network, channel)
+	if err != nil {
+		return err
+	}
+	if ch == nil {
+		ch = data.NewStoredChannel(network, channel)
+	}
+
+	if err := fn(ch); err != nil {
+		return err
+	}
+	return store.SaveChannel(ch)
+}
+
+// UpdateUser lets fn change a copy of a stored user and saves it, the same
+// way as UpdateChannel.
+func UpdateUser(b *bot.Bot, username string, fn func(*data.StoredUser) error) error {
+	store := b.Store()
+	if store == nil {
+		return errors.New("the bot has no store to save to")
+	}
+
+	storeMut.Lock()
+	defer storeMut.Unlock()
+
+	user, err := store.FindUser(username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("no such user: %s", username)
+	}
+
+	// The store hands out its cached copy, which others may be reading.
+	user = user.Clone()
+	if err := fn(user); err != nil {
+		return err
+	}
+	return store.SaveUser(user)
+}
+
+func toggle(b *bot.Bot, network, channel, key string, disable bool) error {
+	var keys []string
+	err := UpdateChannel(b, network, channel, func(ch *data.StoredChannel) error {
+		if _, err := ch.GetJSON(toggleKey, &keys); err != nil {
+			return err
+		}
+
+		set := make(map[string]bool)
+		for _, k := range keys {
+			set[k] = true
+		}
+		if disable {
+			set[key] = true
+		} else {
+			delete(set, key)
+		}
+
+		keys = keys[:0]
+		for k := range set {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return ch.PutJSON(toggleKey, keys)
+	})
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	for _, k := range keys {
+		set[k] = true
+	}
+
+	toggleMut.Lock()
+	toggles[toggleID(network, channel)] = set
+	toggleMut.Unlock()
+
+	return nil
+}
+
+func anyDisabled(b *bot.Bot, network, channel string, keys []string) bool {
+	disabled := disabledIn(b, network, channel)
+	for _, key := range keys {
+		if disabled[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// disabledIn returns the cached set of disabled keys for a channel, loading
+// it from the store the first time.
+func disabledIn(b *bot.Bot, network, channel string) map[string]bool {
+	id := toggleID(network, channel)
+
+	toggleMut.RLock()
+	set, ok := toggles[id]
+	toggleMut.RUnlock()
+	if ok {
+		return set
+	}
+
+	set = make(map[string]bool)
+	if store := b.Store(); store != nil {
+		if ch, err := store.FindChannel(network, channel); err == nil && ch != nil {
+			var keys []string
+			if _, err := ch.GetJSON(toggleKey, &keys); err == nil {
+				for _, k := range keys {
+					set[k] = true
+				}
+			}
+		}
+	}
+
+	toggleMut.Lock()
+	toggles[id] = set
+	toggleMut.Unlock()
+
+	return set
+}
+
+func toggleID(network, channel string) string {
+	return strings.ToLower(network + " " + channel)
+}
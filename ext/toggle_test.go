@@ -0,0 +1,169 @@
+package ext
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/internal/testbot"
+)
+
+// counter counts the events and commands it's given.
+type counter struct {
+	handled int
+	greeted int
+	cmds    []string
+}
+
+func (c *counter) Handle(irc.Writer, *irc.Event) { c.handled++ }
+
+func (c *counter) Cmd(name string, _ irc.Writer, _ *cmd.Event) error {
+	c.cmds = append(c.cmds, name)
+	return nil
+}
+
+func (c *counter) Greet(irc.Writer, *cmd.Event) error {
+	c.greeted++
+	return nil
+}
+
+func privmsg(network, target string) *irc.Event {
+	return irc.NewEvent(network, irc.NewNetworkInfo(), irc.PRIVMSG, "nick!user@host", target, "hello")
+}
+
+// The toggles are cached by network and channel for every bot so each test
+// uses channels of its own.
+
+func TestHandlerGuard(t *testing.T) {
+	b := testbot.New(t, "")
+	c := &counter{}
+	g := handlerGuard{b: b, keys: []string{"tx", "tx.named"}, handler: c}
+
+	handled := func(network, target string) bool {
+		before := c.handled
+		g.Handle(nil, privmsg(network, target))
+		return c.handled != before
+	}
+
+	if !handled("test", "#hguard") {
+		t.Fatal("want events handled before anything is disabled")
+	}
+
+	for _, key := range []string{"TX", "tx.named"} {
+		if err := Disable(b, "test", "#HGuard", key); err != nil {
+			t.Fatal(err)
+		}
+		if handled("test", "#hguard") {
+			t.Errorf("%s: want nothing handled in the disabled channel", key)
+		}
+		if !handled("test", "#other") || !handled("other", "#hguard") || !handled("test", "uq") {
+			t.Errorf("%s: want events handled everywhere else", key)
+		}
+		if err := Enable(b, "test", "#hguard", key); err != nil {
+			t.Fatal(err)
+		}
+		if !handled("test", "#hguard") {
+			t.Errorf("%s: want events handled once enabled again", key)
+		}
+	}
+
+	if err := Disable(b, "test", "#hguard", "tx.othername"); err != nil {
+		t.Fatal(err)
+	}
+	if !handled("test", "#hguard") {
+		t.Error("want events handled when another handler is disabled")
+	}
+}
+
+func TestCmdGuard(t *testing.T) {
+	b := testbot.New(t, "")
+	c := &counter{}
+	greet := cmdGuard{b: b, keys: []string{"tx", "tx.greet"}, handler: c}
+	other := cmdGuard{b: b, keys: []string{"tx", "tx.other"}, handler: c}
+
+	cmdEv := func(network, target string) *cmd.Event {
+		return &cmd.Event{Event: privmsg(network, target)}
+	}
+
+	if err := greet.Cmd("greet", nil, cmdEv("test", "#cguard")); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Cmd("other", nil, cmdEv("test", "#cguard")); err != nil {
+		t.Fatal(err)
+	}
+	if c.greeted != 1 || !reflect.DeepEqual(c.cmds, []string{"other"}) {
+		t.Fatalf("want greet called by method and other through Cmd, got %d %v", c.greeted, c.cmds)
+	}
+
+	if err := Disable(b, "test", "#cguard", "tx.greet"); err != nil {
+		t.Fatal(err)
+	}
+	greet.Cmd("greet", nil, cmdEv("test", "#cguard"))
+	other.Cmd("other", nil, cmdEv("test", "#cguard"))
+	if c.greeted != 1 || len(c.cmds) != 2 {
+		t.Errorf("want only greet skipped, got %d %v", c.greeted, c.cmds)
+	}
+
+	greet.Cmd("greet", nil, cmdEv("test", "#other"))
+	greet.Cmd("greet", nil, cmdEv("test", "nick"))
+	if c.greeted != 3 {
+		t.Errorf("want greet run in other channels and in private, got %d", c.greeted)
+	}
+
+	if err := Disable(b, "test", "#cguard", "tx"); err != nil {
+		t.Fatal(err)
+	}
+	other.Cmd("other", nil, cmdEv("test", "#cguard"))
+	if len(c.cmds) != 2 {
+		t.Errorf("want every command skipped with the extension disabled, got %v", c.cmds)
+	}
+
+	if got := Disabled(b, "test", "#cguard"); !reflect.DeepEqual(got, []string{"tx", "tx.greet"}) {
+		t.Errorf("want tx and tx.greet disabled, got %v", got)
+	}
+
+	for _, key := range []string{"tx", "tx.greet"} {
+		if err := Enable(b, "test", "#cguard", key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	greet.Cmd("greet", nil, cmdEv("test", "#cguard"))
+	other.Cmd("other", nil, cmdEv("test", "#cguard"))
+	if c.greeted != 4 || len(c.cmds) != 3 {
+		t.Errorf("want both run once enabled, got %d %v", c.greeted, c.cmds)
+	}
+}
+
+func TestToggleCache(t *testing.T) {
+	b := testbot.New(t, "")
+
+	if err := Disable(b, "test", "#cache", "tx"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cold cache loads the channel from the store.
+	toggleMut.Lock()
+	delete(toggles, toggleID("test", "#cache"))
+	toggleMut.Unlock()
+	if !anyDisabled(b, "test", "#cache", []string{"tx"}) {
+		t.Fatal("want tx loaded from the store as disabled")
+	}
+
+	if err := Enable(b, "test", "#cache", "tx"); err != nil {
+		t.Fatal(err)
+	}
+	if anyDisabled(b, "test", "#cache", []string{"tx"}) {
+		t.Error("want the cache updated on enable")
+	}
+	if got := Disabled(b, "test", "#cache"); len(got) != 0 {
+		t.Errorf("want nothing disabled, got %v", got)
+	}
+
+	toggleMut.Lock()
+	delete(toggles, toggleID("test", "#cache"))
+	toggleMut.Unlock()
+	if anyDisabled(b, "test", "#cache", []string{"tx"}) {
+		t.Error("want the enable saved to the store")
+	}
+}
@@ -3,16 +3,18 @@ module github.com/aarondl/uq
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/aarondl/cinotify v0.0.0-20190916083921-ecf31a35e707
 	github.com/aarondl/query v0.0.0-20190718223540-4829429e162f
 	github.com/aarondl/quotes v0.0.0-20200513161851-60831de929e1
 	github.com/aarondl/ultimateq v0.0.0-20190910020858-27f5e6591bb4
 	github.com/bradj/remindme v0.1.1
 	github.com/knivey/gitbot v0.0.0-20190916135406-365affbcbf5c
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/net v0.8.0
 )
 
 require (
-	github.com/BurntSushi/toml v1.2.1 // indirect
 	github.com/Islandstone/yr v0.0.0-20140612205943-1c29d5159423 // indirect
 	github.com/aarondl/gitio v0.0.0-20190619182233-9427fbcd5b47 // indirect
 	github.com/cznic/fileutil v0.0.0-20181122101858-4d67cfea8c87 // indirect
@@ -32,12 +34,10 @@ require (
 	github.com/gorilla/mux v1.7.3 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.17 // indirect
-	github.com/mattn/go-sqlite3 v1.14.16 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	github.com/stretchr/testify v1.4.0 // indirect
 	golang.org/x/crypto v0.7.0 // indirect
-	golang.org/x/net v0.8.0 // indirect
 	golang.org/x/oauth2 v0.6.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
 	golang.org/x/term v0.6.0 // indirect
@@ -0,0 +1,26 @@
+// Package randid makes the short random ids that pastes and short links are
+// served under.
+package randid
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// Alphabet leaves out the letters and digits that are easily mistaken for
+// each other, like l, 1, O and 0.
+const Alphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// New makes an id of length random letters from Alphabet.
+func New(length int) (string, error) {
+	max := big.NewInt(int64(len(Alphabet)))
+	id := make([]byte, length)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id[i] = Alphabet[n.Int64()]
+	}
+	return string(id), nil
+}
@@ -0,0 +1,31 @@
+package randid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := New(6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(id) != 6 {
+			t.Errorf("want 6 letters, got %q", id)
+		}
+		for _, r := range id {
+			if !strings.ContainsRune(Alphabet, r) {
+				t.Errorf("want only letters from the alphabet, got %q", id)
+			}
+		}
+		seen[id] = true
+	}
+
+	if len(seen) < 99 {
+		t.Errorf("want random ids, got %d different ones out of 100", len(seen))
+	}
+}
@@ -0,0 +1,78 @@
+// Package testbot makes the bots and writers the extensions' tests share.
+// The bots are on the test and other networks but never connect, and are
+// closed when the test ends.
+package testbot
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+// Config is a bot's config with ext as its [ext.config] section. The bot
+// keeps its store in storefile, or has none if it's empty.
+func Config(storefile, ext string) *config.Config {
+	store := "nostore = true"
+	if len(storefile) != 0 {
+		store = fmt.Sprintf("storefile = %q", storefile)
+	}
+
+	return config.New().FromString(fmt.Sprintf(`nick = "uq"
+altnick = "uq_"
+username = "uq"
+realname = "uq"
+noreconnect = true
+%s
+[networks.test]
+	servers = ["irc.test.net"]
+[networks.other]
+	servers = ["irc.other.net"]
+[ext.config]
+%s
+`, store, ext))
+}
+
+// New makes a bot with a store in a temporary directory.
+func New(t testing.TB, ext string) *bot.Bot {
+	t.Helper()
+	return FromConfig(t, Config(filepath.Join(t.TempDir(), "store.db"), ext))
+}
+
+// NewStoreless makes a bot like New but without a store.
+func NewStoreless(t testing.TB, ext string) *bot.Bot {
+	t.Helper()
+	return FromConfig(t, Config("", ext))
+}
+
+// FromConfig makes a bot from conf.
+func FromConfig(t testing.TB, conf *config.Config) *bot.Bot {
+	t.Helper()
+
+	b, err := bot.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// Welcome tells the bot it's connected to the network as uq!uq@uq.host,
+// sending needs to know its hostmask to split lines.
+func Welcome(b *bot.Bot, network string) {
+	b.State(network).Update(irc.NewEvent(network, irc.NewNetworkInfo(), irc.RPL_WELCOME,
+		"irc."+network+".net", "uq", "Welcome uq!uq@uq.host"))
+}
+
+// Lines keeps each line sent through an irc.Helper.
+type Lines []string
+
+// Write adds b as a line.
+func (l *Lines) Write(b []byte) (int, error) {
+	*l = append(*l, strings.TrimRight(string(b), "\r\n"))
+	return len(b), nil
+}
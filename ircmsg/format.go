@@ -0,0 +1,43 @@
+package ircmsg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ago shows a duration with its two largest units, like 3d 4h or 5m 10s.
+func Ago(d time.Duration) string {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+
+	for i, u := range units {
+		if d < u.size {
+			continue
+		}
+		out := fmt.Sprintf("%d%s", d/u.size, u.name)
+		if i+1 < len(units) {
+			next := units[i+1]
+			if n := d % u.size / next.size; n > 0 {
+				out += fmt.Sprintf(" %d%s", n, next.name)
+			}
+		}
+		return out
+	}
+	return "0s"
+}
+
+// UserHost strips the nick from a nick!user@host, leaving user@host.
+func UserHost(host string) string {
+	if i := strings.IndexByte(host, '!'); i >= 0 {
+		return host[i+1:]
+	}
+	return host
+}
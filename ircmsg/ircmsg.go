@@ -0,0 +1,333 @@
+// Package ircmsg splits and truncates messages so they fit into irc lines.
+//
+// Lines are measured in bytes against what the server will actually relay:
+// the bot's own hostmask, the command and the target all eat into the 512
+// byte limit. Splitting happens on word boundaries where possible, never
+// inside a UTF-8 sequence or a formatting code, and formatting that is open
+// at the end of a line is re-opened at the start of the next one.
+//
+// It also has the small formatting helpers extensions share, like Ago.
+package ircmsg
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+const (
+	// maxLine is the longest line a server accepts without the trailing crlf.
+	maxLine = 510
+	// maxHostLen is assumed for our hostmask when we don't know it.
+	maxHostLen = 62
+
+	bold      = '\x02'
+	color     = '\x03'
+	reset     = '\x0f'
+	reverse   = '\x16'
+	italic    = '\x1d'
+	underline = '\x1f'
+)
+
+// MaxLen returns the number of message bytes that fit on a single line
+// sent by self (nick!user@host) with command (PRIVMSG, NOTICE) to target.
+// If self is empty the longest hostmask allowed is assumed.
+func MaxLen(self, command, target string) int {
+	header := len(command) + 1 + len(target) + 2
+	hostLen := len(self)
+	if hostLen == 0 {
+		hostLen = maxHostLen
+	}
+
+	// The server prefixes what we send with :self and a space.
+	n := maxLine - (hostLen + 2) - header
+
+	// The writer splits anything longer than this on its own, with no
+	// regard for UTF-8 or formatting, so never go past it.
+	if writerMax := irc.IRC_MAX_LENGTH - header; writerMax < n {
+		n = writerMax
+	}
+	return n
+}
+
+// Budget returns MaxLen for the bot's current hostmask on network.
+func Budget(b *bot.Bot, network, command, target string) int {
+	var self string
+	if state := b.State(network); state != nil {
+		self = state.Self().Host.String()
+	}
+
+	return MaxLen(self, command, target)
+}
+
+// Overflow is called with the full message whenever NotifyN has to drop
+// lines. If it returns true the link it returns is shown after the "..."
+// marking the cut. The paste extension sets this when it's running.
+var Overflow func(full string) (link string, ok bool)
+
+// Notify sends msg like irc.Writer's Notify does: to the channel if ev was
+// sent to one, otherwise as a notice to nick. The message is split to fit
+// the bot's actual line budget.
+func Notify(b *bot.Bot, w irc.Writer, ev *irc.Event, nick, msg string) error {
+	return NotifyN(b, w, ev, nick, msg, 0)
+}
+
+// NotifyN is like Notify but sends at most nlines lines, zero is no limit.
+func NotifyN(b *bot.Bot, w irc.Writer, ev *irc.Event, nick, msg string, nlines int) error {
+	command, target := irc.NOTICE, nick
+	if ev.IsTargetChan() {
+		command, target = irc.PRIVMSG, ev.Target()
+	}
+
+	return send(w, command, target, fit(Budget(b, ev.NetworkID, command, target), msg, nlines))
+}
+
+// Privmsg sends msg to target on network split to fit.
+func Privmsg(b *bot.Bot, w irc.Writer, network, target, msg string) error {
+	return send(w, irc.PRIVMSG, target, Split(msg, Budget(b, network, irc.PRIVMSG, target)))
+}
+
+// Notice sends msg to target on network split to fit.
+func Notice(b *bot.Bot, w irc.Writer, network, target, msg string) error {
+	return send(w, irc.NOTICE, target, Split(msg, Budget(b, network, irc.NOTICE, target)))
+}
+
+// fit splits msg into at most nlines lines, handing the full message to
+// Overflow if anything was cut.
+func fit(maxlen int, msg string, nlines int) []string {
+	if nlines <= 0 {
+		return Split(msg, maxlen)
+	}
+
+	lines, truncated := Truncate(msg, maxlen, nlines, "...")
+	if truncated && Overflow != nil {
+		if link, ok := Overflow(msg); ok {
+			lines, _ = Truncate(msg, maxlen, nlines, "... "+link)
+		}
+	}
+	return lines
+}
+
+func send(w irc.Writer, command, target string, lines []string) error {
+	for _, line := range lines {
+		if _, err := w.Write([]byte(command + " " + target + " :" + line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Split msg into lines of at most maxlen bytes.
+func Split(msg string, maxlen int) []string {
+	var lines []string
+	var f format
+
+	msg = strings.TrimSpace(msg)
+	for len(msg) > 0 {
+		prefix := f.String()
+		room := maxlen - len(prefix)
+		if room <= 0 {
+			// Not even the formatting fits, give up on carrying it over.
+			prefix, room = "", maxlen
+		}
+
+		cut, next := cutPoint(msg, room)
+		line := msg[:cut]
+		if len(f.color) != 0 && len(prefix) != 0 && startsColorArg(line) &&
+			len(prefix)+len(line)+2 <= maxlen {
+			// Keep the re-opened colour from swallowing the line's own
+			// leading digits or comma.
+			prefix += string(bold) + string(bold)
+		}
+		lines = append(lines, prefix+line)
+		f.apply(line)
+		msg = msg[next:]
+	}
+
+	return lines
+}
+
+// Truncate splits msg like Split but keeps at most nlines lines. When lines
+// are dropped the last line kept is shortened to make room for marker, and
+// truncated is true.
+func Truncate(msg string, maxlen, nlines int, marker string) (lines []string, truncated bool) {
+	lines = Split(msg, maxlen)
+	if len(lines) <= nlines {
+		return lines, false
+	}
+
+	lines = lines[:nlines]
+	if nlines == 0 {
+		return lines, true
+	}
+
+	// Reset formatting so the marker isn't coloured by whatever was open.
+	marker = string(reset) + marker
+	last := lines[nlines-1]
+	if room := maxlen - len(marker); room > 0 {
+		cut, _ := cutPoint(last, room)
+		last = strings.TrimRight(last[:cut], " ")
+	} else {
+		last = ""
+	}
+	lines[nlines-1] = last + marker
+
+	return lines, true
+}
+
+// Strip removes all formatting codes from msg.
+func Strip(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); {
+		n := tokenLen(msg[i:])
+		if !isFormat(msg[i]) {
+			b.WriteString(msg[i : i+n])
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// cutPoint finds where to end a line of at most room bytes taken from the
+// front of msg. It returns the end of the line and where the next line
+// starts, which skips the space that was split on.
+func cutPoint(msg string, room int) (cut, next int) {
+	if len(msg) <= room {
+		return len(msg), len(msg)
+	}
+
+	lastSpace := -1
+	i := 0
+	for i < len(msg) {
+		n := tokenLen(msg[i:])
+		if i+n > room {
+			break
+		}
+		if msg[i] == ' ' {
+			lastSpace = i
+		}
+		i += n
+	}
+	if i < len(msg) && msg[i] == ' ' {
+		// The line ends right where a word does.
+		lastSpace = i
+	}
+
+	// Only split on a space if it doesn't waste most of the line.
+	if lastSpace > 0 && lastSpace >= room/2 {
+		cut, next = lastSpace, lastSpace
+		for cut > 0 && msg[cut-1] == ' ' {
+			cut--
+		}
+		for next < len(msg) && msg[next] == ' ' {
+			next++
+		}
+		return cut, next
+	}
+
+	if i == 0 {
+		// A single token larger than the room, there's nothing to do but
+		// send it whole.
+		i = tokenLen(msg)
+	}
+	return i, i
+}
+
+// tokenLen returns the length of the rune or formatting code at the start
+// of s. Colour codes carry up to two digits of foreground and optionally a
+// comma and two digits of background.
+func tokenLen(s string) int {
+	if s[0] != color {
+		if s[0] < utf8.RuneSelf {
+			return 1
+		}
+		_, n := utf8.DecodeRuneInString(s)
+		return n
+	}
+
+	i := 1 + digits(s[1:])
+	if i > 1 && i+1 < len(s) && s[i] == ',' {
+		if d := digits(s[i+1:]); d > 0 {
+			i += 1 + d
+		}
+	}
+	return i
+}
+
+// digits counts up to two leading ascii digits.
+func digits(s string) int {
+	n := 0
+	for n < 2 && n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// startsColorArg is true if s would be read as part of a colour code
+// preceding it.
+func startsColorArg(s string) bool {
+	return len(s) != 0 && (s[0] == ',' || (s[0] >= '0' && s[0] <= '9'))
+}
+
+func isFormat(c byte) bool {
+	switch c {
+	case bold, color, reset, reverse, italic, underline:
+		return true
+	}
+	return false
+}
+
+// format is the formatting in effect at some point in a message.
+type format struct {
+	bold, italic, underline, reverse bool
+
+	// color is the colour code in effect, eg. "\x0304,01", or empty.
+	color string
+}
+
+// apply updates the format with the codes found in s.
+func (f *format) apply(s string) {
+	for i := 0; i < len(s); {
+		n := tokenLen(s[i:])
+		switch s[i] {
+		case bold:
+			f.bold = !f.bold
+		case italic:
+			f.italic = !f.italic
+		case underline:
+			f.underline = !f.underline
+		case reverse:
+			f.reverse = !f.reverse
+		case reset:
+			*f = format{}
+		case color:
+			if n == 1 {
+				f.color = ""
+			} else {
+				f.color = s[i : i+n]
+			}
+		}
+		i += n
+	}
+}
+
+// String returns the codes needed to re-open the format on a new line.
+func (f format) String() string {
+	var b strings.Builder
+	if f.bold {
+		b.WriteByte(bold)
+	}
+	if f.italic {
+		b.WriteByte(italic)
+	}
+	if f.underline {
+		b.WriteByte(underline)
+	}
+	if f.reverse {
+		b.WriteByte(reverse)
+	}
+	b.WriteString(f.color)
+	return b.String()
+}
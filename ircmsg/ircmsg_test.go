@@ -0,0 +1,157 @@
+package ircmsg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/ultimateq/irc"
+)
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		msg    string
+		maxlen int
+		want   []string
+	}{
+		{"fits", "  hello world  ", 20, []string{"hello world"}},
+		{"words", "hello world", 5, []string{"hello", "world"}},
+		{"spaces", "one two   three", 8, []string{"one two", "three"}},
+		{"long word", "a verylongword b", 5, []string{"a ver", "ylong", "word", "b"}},
+		{"multibyte", "aé", 2, []string{"a", "é"}},
+		{"multibyte budget", "日本語", 7, []string{"日本", "語"}},
+		{"wider than budget", "日本", 2, []string{"日", "本"}},
+		{"bold", "\x02bold words", 6, []string{"\x02bold", "\x02words"}},
+		{"bold closed", "\x02b\x02 plain", 6, []string{"\x02b\x02", "plain"}},
+		{"colour", "\x0304,01red text", 10, []string{"\x0304,01red", "\x0304,01text"}},
+		{"colour reset", "\x0304red\x03 plain", 10, []string{"\x0304red\x03", "plain"}},
+		{"colour digits", "\x0304red 12345", 10, []string{"\x0304red", "\x0304\x02\x0212345"}},
+		{"code wider than budget", "ab\x0304,01cd", 4, []string{"ab", "\x0304,01", "cd"}},
+		{"prefix over budget", "\x02\x1d\x1f\x16\x0304abcdefgh", 4,
+			[]string{"\x02\x1d\x1f\x16", "\x0304a", "bcde", "fgh"}},
+		{"empty", "   ", 10, nil},
+	}
+
+	for _, test := range tests {
+		got := Split(test.msg, test.maxlen)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: want %q, got %q", test.name, test.want, got)
+		}
+		for _, line := range got {
+			if len(line) > test.maxlen && !strings.HasSuffix(test.name, "wider than budget") {
+				t.Errorf("%s: %q is longer than %d", test.name, line, test.maxlen)
+			}
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+
+	const msg = "one two three four"
+
+	tests := []struct {
+		name      string
+		maxlen    int
+		nlines    int
+		marker    string
+		want      []string
+		truncated bool
+	}{
+		{"fits", 20, 1, "...", []string{msg}, false},
+		{"enough lines", 9, 3, "...", []string{"one two", "three", "four"}, false},
+		{"one line", 9, 1, "...", []string{"one\x0f..."}, true},
+		{"two lines", 9, 2, "...", []string{"one two", "three\x0f..."}, true},
+		{"no lines", 9, 0, "...", []string{}, true},
+		{"marker over budget", 9, 1, "... https://p.test/1", []string{"\x0f... https://p.test/1"}, true},
+	}
+
+	for _, test := range tests {
+		got, truncated := Truncate(msg, test.maxlen, test.nlines, test.marker)
+		if !reflect.DeepEqual(got, test.want) || truncated != test.truncated {
+			t.Errorf("%s: want %q %v, got %q %v", test.name, test.want, test.truncated, got, truncated)
+		}
+	}
+
+	got, _ := Truncate("\x0304red words here", 12, 1, "...")
+	if want := []string{"\x0304red\x0f..."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want the marker after a reset, got %q", got)
+	}
+}
+
+func TestFit(t *testing.T) {
+	const msg = "alpha beta gamma delta epsilon zeta eta theta"
+
+	var pasted []string
+	defer func() { Overflow = nil }()
+
+	Overflow = nil
+	if got, want := fit(30, msg, 1), []string{"alpha beta gamma delta\x0f..."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q without a paste, got %q", want, got)
+	}
+
+	Overflow = func(full string) (string, bool) {
+		pasted = append(pasted, full)
+		return "https://p.test/1", true
+	}
+	if got, want := fit(30, msg, 1), []string{"alpha\x0f... https://p.test/1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q with the paste link, got %q", want, got)
+	}
+	if len(pasted) != 1 || pasted[0] != msg {
+		t.Errorf("want the full message pasted once, got %q", pasted)
+	}
+
+	pasted = nil
+	if got := fit(30, msg, 0); len(got) != 2 || len(pasted) != 0 {
+		t.Errorf("want every line and no paste without a limit, got %q %q", got, pasted)
+	}
+	if got := fit(30, msg, 2); len(got) != 2 || len(pasted) != 0 {
+		t.Errorf("want no paste when nothing was cut, got %q %q", got, pasted)
+	}
+
+	Overflow = func(string) (string, bool) { return "", false }
+	if got, want := fit(30, msg, 1), []string{"alpha beta gamma delta\x0f..."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q when the paste fails, got %q", want, got)
+	}
+}
+
+func TestStrip(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"plain":                      "plain",
+		"\x02bold\x02 \x1ditalic":    "bold italic",
+		"\x0304,01red\x03 \x0312,5x": "red x",
+		"\x034,text":                 ",text",
+		"\x0f\x16\x1fé":              "é",
+	}
+
+	for msg, want := range tests {
+		if got := Strip(msg); got != want {
+			t.Errorf("%q: want %q, got %q", msg, want, got)
+		}
+	}
+}
+
+func TestMaxLen(t *testing.T) {
+	t.Parallel()
+
+	header := len("PRIVMSG #chan :")
+	tests := []struct {
+		self string
+		want int
+	}{
+		{"bot!bot@bot.host", irc.IRC_MAX_LENGTH - header},
+		{strings.Repeat("h", maxHostLen), maxLine - (maxHostLen + 2) - header},
+		{"", maxLine - (maxHostLen + 2) - header},
+	}
+
+	for _, test := range tests {
+		if got := MaxLen(test.self, irc.PRIVMSG, "#chan"); got != test.want {
+			t.Errorf("%q: want %d, got %d", test.self, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package paste runs a small web server that holds on to output too long to
+// send to irc. Any extension can store text with Put and hand out the link
+// in channel instead of losing everything past the line limit.
+package paste
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/internal/randid"
+	"github.com/aarondl/uq/ircmsg"
+	"github.com/aarondl/uq/webserver"
+)
+
+const (
+	defaultExpiry = 24 * time.Hour
+	idLength      = 6
+	maxPasteSize  = 1 << 20
+	// maxPastes bounds the memory held to maxPastes*maxPasteSize, the
+	// oldest paste makes room for a new one.
+	maxPastes    = 256
+	reapInterval = time.Minute
+)
+
+var (
+	mut     sync.RWMutex
+	current *Paster
+)
+
+func init() {
+	ext.RegisterExtension("paste", &Paster{})
+	ircmsg.Overflow = Put
+}
+
+type paste struct {
+	text    string
+	expires time.Time
+}
+
+// Paster extension
+type Paster struct {
+	web  *webserver.Server
+	stop chan struct{}
+
+	mut    sync.RWMutex
+	Listen string
+	URL    string
+	Expiry time.Duration
+	pastes map[string]paste
+}
+
+// Init the extension
+func (p *Paster) Init(b *bot.Bot) error {
+	p.mut.Lock()
+	p.pastes = make(map[string]paste)
+	p.mut.Unlock()
+	p.web = webserver.New(p)
+
+	if err := p.loadConfig(b); err != nil {
+		return err
+	}
+
+	p.stop = make(chan struct{})
+	go p.reap(p.stop)
+	return nil
+}
+
+// Deinit the extension
+func (p *Paster) Deinit(b *bot.Bot) error {
+	mut.Lock()
+	if current == p {
+		current = nil
+	}
+	mut.Unlock()
+
+	close(p.stop)
+	return p.web.Stop()
+}
+
+// Rehash moves the paste server and applies the new url and expiry.
+func (p *Paster) Rehash(b *bot.Bot) error {
+	return p.loadConfig(b)
+}
+
+// loadConfig reads paste_listen, paste_url and paste_expiry and (re)binds
+// the server. Pastes are only handed out while it's listening.
+func (p *Paster) loadConfig(b *bot.Bot) error {
+	var listen, uri, expiry string
+	b.ReadConfig(func(cfg *config.Config) {
+		listen, _ = cfg.ExtGlobal().ConfigVal("", "", "paste_listen")
+		uri, _ = cfg.ExtGlobal().ConfigVal("", "", "paste_url")
+		expiry, _ = cfg.ExtGlobal().ConfigVal("", "", "paste_expiry")
+	})
+
+	ttl := defaultExpiry
+	if len(expiry) != 0 {
+		var err error
+		if ttl, err = time.ParseDuration(expiry); err != nil {
+			return fmt.Errorf("failed to parse paste_expiry: %v", err)
+		}
+	}
+	if len(uri) == 0 {
+		uri = "http://" + listen
+	}
+
+	if err := p.web.Serve(listen); err != nil {
+		return fmt.Errorf("failed to start paste server: %v", err)
+	}
+
+	p.mut.Lock()
+	p.Listen, p.URL, p.Expiry = listen, strings.TrimRight(uri, "/"), ttl
+	p.mut.Unlock()
+
+	mut.Lock()
+	if len(listen) != 0 {
+		current = p
+	} else if current == p {
+		current = nil
+	}
+	mut.Unlock()
+
+	return nil
+}
+
+// Put stores text on the paste server and returns the link to it. The bool
+// is false if there is no paste server running.
+func Put(text string) (string, bool) {
+	mut.RLock()
+	p := current
+	mut.RUnlock()
+
+	if p == nil {
+		return "", false
+	}
+
+	link, err := p.put(text)
+	if err != nil {
+		return "", false
+	}
+	return link, true
+}
+
+func (p *Paster) put(text string) (string, error) {
+	if len(text) > maxPasteSize {
+		cut := maxPasteSize
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if len(p.pastes) >= maxPastes {
+		p.evictOldest()
+	}
+
+	var id string
+	for {
+		var err error
+		if id, err = randid.New(idLength); err != nil {
+			return "", err
+		}
+		if _, ok := p.pastes[id]; !ok {
+			break
+		}
+	}
+
+	p.pastes[id] = paste{
+		text:    ircmsg.Strip(text),
+		expires: time.Now().Add(p.Expiry),
+	}
+
+	return p.URL + "/" + id, nil
+}
+
+// evictOldest must be called with mut held. Every paste lives for the same
+// time so the oldest is the one that expires first.
+func (p *Paster) evictOldest() {
+	var oldest string
+	var expires time.Time
+	for id, pst := range p.pastes {
+		if len(oldest) == 0 || pst.expires.Before(expires) {
+			oldest, expires = id, pst.expires
+		}
+	}
+	delete(p.pastes, oldest)
+}
+
+// ServeHTTP serves the pastes as plain text.
+func (p *Paster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/")
+
+	p.mut.RLock()
+	pst, ok := p.pastes[id]
+	p.mut.RUnlock()
+
+	if !ok || time.Now().After(pst.expires) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Expires", pst.expires.UTC().Format(http.TimeFormat))
+	fmt.Fprint(w, pst.text)
+}
+
+// reap removes expired pastes until stop is closed.
+func (p *Paster) reap(stop <-chan struct{}) {
+	tick := time.NewTicker(reapInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-tick.C:
+			p.mut.Lock()
+			for id, pst := range p.pastes {
+				if now.After(pst.expires) {
+					delete(p.pastes, id)
+				}
+			}
+			p.mut.Unlock()
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package paste
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/uq/internal/testbot"
+)
+
+func newTestPaster() *Paster {
+	return &Paster{
+		URL:    "http://paste.test",
+		Expiry: time.Hour,
+		pastes: make(map[string]paste),
+	}
+}
+
+func TestPutCutsOnRuneBoundary(t *testing.T) {
+	p := newTestPaster()
+
+	// The 3 byte rune straddles the size limit.
+	text := strings.Repeat("a", maxPasteSize-1) + "€"
+	link, err := p.put(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pst := p.pastes[strings.TrimPrefix(link, p.URL+"/")]
+	if len(pst.text) != maxPasteSize-1 {
+		t.Errorf("want %d bytes, got %d", maxPasteSize-1, len(pst.text))
+	}
+	if !utf8.ValidString(pst.text) {
+		t.Error("the paste was cut in the middle of a rune")
+	}
+}
+
+func TestPutEvictsOldest(t *testing.T) {
+	p := newTestPaster()
+
+	first, err := p.put("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstID := strings.TrimPrefix(first, p.URL+"/")
+	// Make sure it's the oldest even if the clock hasn't moved.
+	pst := p.pastes[firstID]
+	pst.expires = pst.expires.Add(-time.Minute)
+	p.pastes[firstID] = pst
+
+	for i := 1; i < maxPastes; i++ {
+		if _, err := p.put("filler"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := p.pastes[firstID]; !ok {
+		t.Fatal("nothing should be evicted before the limit")
+	}
+
+	if _, err := p.put("last"); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.pastes) != maxPastes {
+		t.Errorf("want %d pastes, got %d", maxPastes, len(p.pastes))
+	}
+	if _, ok := p.pastes[firstID]; ok {
+		t.Error("the oldest paste should have been evicted")
+	}
+}
+
+// newTestBot makes a bot with ext's config. The bot starts the registered
+// paster with an empty config so it stays out of the way of the test's own.
+func newTestBot(t *testing.T, ext string) *bot.Bot {
+	t.Helper()
+
+	b := testbot.NewStoreless(t, "")
+	b.ReplaceConfig(testbot.Config("", ext))
+	return b
+}
+
+func TestInitBindError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	b := newTestBot(t, fmt.Sprintf(`paste_listen = %q`, taken.Addr()))
+	p := &Paster{}
+	if err := p.Init(b); err == nil {
+		p.Deinit(b)
+		t.Fatal("want the bind error from Init")
+	}
+	if _, ok := Put("text"); ok {
+		t.Error("nothing should be pasted when the server couldn't start")
+	}
+}
+
+func TestRehash(t *testing.T) {
+	b := newTestBot(t, `paste_listen = "127.0.0.1:0"
+paste_url = "http://one.test/"`)
+
+	p := &Paster{}
+	if err := p.Init(b); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Deinit(b)
+
+	if link, ok := Put("text"); !ok || !strings.HasPrefix(link, "http://one.test/") {
+		t.Errorf("want a link on paste_url, got %q %v", link, ok)
+	}
+
+	b.ReplaceConfig(testbot.Config("", `paste_listen = "127.0.0.1:0"
+paste_url = "http://two.test"
+paste_expiry = "1m"`))
+	if err := p.Rehash(b); err != nil {
+		t.Fatal(err)
+	}
+	link, ok := Put("text")
+	if !ok || !strings.HasPrefix(link, "http://two.test/") {
+		t.Errorf("want a link on the new paste_url, got %q %v", link, ok)
+	}
+	if pst := p.pastes[strings.TrimPrefix(link, "http://two.test/")]; time.Until(pst.expires) > time.Minute {
+		t.Errorf("want the new expiry, the paste expires at %v", pst.expires)
+	}
+
+	b.ReplaceConfig(testbot.Config("", `paste_expiry = "soon"`))
+	if err := p.Rehash(b); err == nil {
+		t.Error("want an error for a bad paste_expiry")
+	}
+	if _, ok := Put("text"); !ok {
+		t.Error("a bad rehash should leave the server running")
+	}
+
+	b.ReplaceConfig(testbot.Config("", ""))
+	if err := p.Rehash(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Put("text"); ok {
+		t.Error("nothing should be pasted once paste_listen is unset")
+	}
+}
@@ -0,0 +1,67 @@
+package preview
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDescription is how many characters of a description are shown.
+const maxDescription = 160
+
+// ErrNoTitle is returned when a page has nothing to show.
+var ErrNoTitle = errors.New("preview: page has no title")
+
+// defaultExtractor shows the title, the site name if the title doesn't
+// already say it, and for OpenGraph pages a short description.
+func defaultExtractor(p *Page) (string, error) {
+	if len(p.Title) == 0 {
+		return "", ErrNoTitle
+	}
+
+	summary := p.Title
+	site := p.SiteName
+	if len(site) == 0 {
+		site = strings.TrimPrefix(p.URL.Hostname(), "www.")
+	}
+	if !strings.Contains(strings.ToLower(summary), strings.ToLower(site)) {
+		summary = site + ": " + summary
+	}
+
+	if _, og := p.Meta["og:description"]; og && len(p.Description) != 0 &&
+		!strings.HasPrefix(p.Description, p.Title) {
+		summary += " - " + shorten(p.Description, maxDescription)
+	}
+
+	return summary, nil
+}
+
+// githubExtractor uses GitHub's og:title which reads "Title · Issue #1 ·
+// owner/repo" and skips the description, which repeats it.
+func githubExtractor(p *Page) (string, bool) {
+	title := p.Meta["og:title"]
+	if len(title) == 0 {
+		return "", false
+	}
+	return "GitHub: " + clean(title), true
+}
+
+// shorten cuts s to at most n characters on a word boundary.
+func shorten(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	cut := 0
+	for i := range s {
+		if utf8.RuneCountInString(s[:i]) >= n {
+			break
+		}
+		cut = i
+	}
+
+	if space := strings.LastIndexByte(s[:cut], ' '); space > cut/2 {
+		cut = space
+	}
+	return strings.TrimRight(s[:cut], " ,.;:") + "…"
+}
@@ -0,0 +1,401 @@
+// Package preview fetches web pages linked on irc and pulls a short summary
+// out of them, usually the <title> or the OpenGraph data.
+//
+// Fetching arbitrary links for strangers is dangerous, so a Fetcher limits
+// the time and bytes it spends on each page, only reads html, and refuses to
+// connect to loopback, private and link-local addresses, even through
+// redirects or dns that changes between lookups.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// Defaults for a Fetcher's limits.
+const (
+	DefaultTimeout   = 5 * time.Second
+	DefaultMaxBytes  = 512 << 10
+	DefaultRedirects = 5
+	DefaultCacheTTL  = 30 * time.Minute
+	DefaultCacheSize = 512
+
+	userAgent = "uq-preview/1.0 (irc link preview)"
+)
+
+var (
+	// ErrForbiddenAddress is returned when a link leads to an address that
+	// isn't on the public internet.
+	ErrForbiddenAddress = errors.New("preview: refusing to connect to a non-public address")
+	// ErrNotHTML is returned when a link isn't a web page.
+	ErrNotHTML = errors.New("preview: not an html page")
+
+	rgxURL = regexp.MustCompile(`https?://[^\s<>"\x00-\x1f]+`)
+)
+
+// Page is what was found in a fetched page.
+type Page struct {
+	// URL is where the page was found after redirects.
+	URL         *url.URL
+	Title       string
+	SiteName    string
+	Description string
+	// Meta holds the page's <meta> tags by property or name.
+	Meta map[string]string
+}
+
+// Extractor makes the summary for a page, ok is false to fall back to the
+// next extractor.
+type Extractor func(p *Page) (summary string, ok bool)
+
+// Fetcher fetches pages and summarizes them. The zero value is not usable,
+// use New.
+type Fetcher struct {
+	Timeout   time.Duration
+	MaxBytes  int64
+	Redirects int
+	CacheTTL  time.Duration
+	CacheSize int
+	// AllowPrivate turns off the address checks, for tests against local
+	// servers.
+	AllowPrivate bool
+
+	client *http.Client
+
+	mut        sync.RWMutex
+	extractors map[string]Extractor
+
+	cacheMut sync.Mutex
+	cache    map[string]cached
+}
+
+type cached struct {
+	summary string
+	err     error
+	expires time.Time
+}
+
+// New creates a fetcher with the default limits.
+func New() *Fetcher {
+	f := &Fetcher{
+		Timeout:    DefaultTimeout,
+		MaxBytes:   DefaultMaxBytes,
+		Redirects:  DefaultRedirects,
+		CacheTTL:   DefaultCacheTTL,
+		CacheSize:  DefaultCacheSize,
+		extractors: make(map[string]Extractor),
+		cache:      make(map[string]cached),
+	}
+
+	dialer := &net.Dialer{
+		Timeout: DefaultTimeout,
+		// Checking the address that's actually being connected to, rather
+		// than what a lookup returned earlier, is what stops dns rebinding.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if f.AllowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !Public(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+
+	f.client = &http.Client{
+		Transport: &http.Transport{
+			// No proxy, it would be the one connecting to the address.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   DefaultTimeout,
+			ResponseHeaderTimeout: DefaultTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.Redirects {
+				return fmt.Errorf("preview: stopped after %d redirects", f.Redirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("preview: refusing to follow redirect to %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+
+	f.Handle("github.com", githubExtractor)
+	return f
+}
+
+// Handle sets the extractor for a domain and its subdomains. The most
+// specific domain wins.
+func (f *Fetcher) Handle(domain string, e Extractor) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.extractors[strings.ToLower(domain)] = e
+}
+
+// Links finds the http and https links in a message.
+func Links(msg string) []string {
+	links := rgxURL.FindAllString(msg, -1)
+	for i, l := range links {
+		// Punctuation at the end of a sentence isn't part of the link.
+		links[i] = strings.TrimRight(l, ".,;:!?)]}'")
+	}
+	return links
+}
+
+// Summary fetches a link and summarizes it, results are cached.
+func (f *Fetcher) Summary(ctx context.Context, link string) (string, error) {
+	now := time.Now()
+
+	f.cacheMut.Lock()
+	c, ok := f.cache[link]
+	f.cacheMut.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.summary, c.err
+	}
+
+	summary, err := f.summarize(ctx, link)
+
+	f.cacheMut.Lock()
+	if len(f.cache) >= f.CacheSize {
+		f.prune(now)
+	}
+	expires := now.Add(f.CacheTTL)
+	if err != nil {
+		// Don't hold on to what might be a passing problem for too long.
+		expires = now.Add(time.Minute)
+	}
+	f.cache[link] = cached{summary: summary, err: err, expires: expires}
+	f.cacheMut.Unlock()
+
+	return summary, err
+}
+
+func (f *Fetcher) summarize(ctx context.Context, link string) (string, error) {
+	p, err := f.Fetch(ctx, link)
+	if err != nil {
+		return "", err
+	}
+
+	if e := f.extractor(p.URL.Hostname()); e != nil {
+		if summary, ok := e(p); ok {
+			return summary, nil
+		}
+	}
+	return defaultExtractor(p)
+}
+
+// prune removes expired entries, and the ones closest to expiring if that
+// doesn't make enough room. It must be called with cacheMut held.
+func (f *Fetcher) prune(now time.Time) {
+	var oldest string
+	var oldestAt time.Time
+	for k, c := range f.cache {
+		if now.After(c.expires) {
+			delete(f.cache, k)
+			continue
+		}
+		if len(oldest) == 0 || c.expires.Before(oldestAt) {
+			oldest, oldestAt = k, c.expires
+		}
+	}
+
+	if len(f.cache) >= f.CacheSize && len(oldest) != 0 {
+		delete(f.cache, oldest)
+	}
+}
+
+// Fetch a page and parse out its title and meta tags.
+func (f *Fetcher) Fetch(ctx context.Context, link string) (*Page, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("preview: unsupported scheme: %s", u.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) && errors.Is(urlErr.Err, ErrForbiddenAddress) {
+			return nil, ErrForbiddenAddress
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("preview: status %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, f.MaxBytes), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parse(body)
+	p.URL = resp.Request.URL
+	return p, nil
+}
+
+func (f *Fetcher) extractor(host string) Extractor {
+	host = strings.ToLower(host)
+
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+
+	for len(host) != 0 {
+		if e, ok := f.extractors[host]; ok {
+			return e
+		}
+		dot := strings.IndexByte(host, '.')
+		if dot < 0 {
+			break
+		}
+		host = host[dot+1:]
+	}
+	return nil
+}
+
+// parse reads the title and meta tags, stopping at <body> since everything
+// wanted lives in <head>. A page cut short by the size limit still parses.
+func parse(r io.Reader) *Page {
+	p := &Page{Meta: make(map[string]string)}
+	z := html.NewTokenizer(r)
+
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			p.finish()
+			return p
+		case html.TextToken:
+			if inTitle {
+				p.Title += string(z.Text())
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "title" {
+				inTitle = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = len(p.Title) == 0
+			case "body":
+				p.finish()
+				return p
+			case "meta":
+				var key, content string
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					switch string(k) {
+					case "property", "name":
+						key = strings.ToLower(string(v))
+					case "content":
+						content = string(v)
+					}
+				}
+				if len(key) != 0 && len(content) != 0 {
+					if _, ok := p.Meta[key]; !ok {
+						p.Meta[key] = content
+					}
+				}
+			}
+		}
+	}
+}
+
+func (p *Page) finish() {
+	p.Title = clean(p.Title)
+	if t := clean(p.Meta["og:title"]); len(t) != 0 {
+		p.Title = t
+	}
+	p.SiteName = clean(p.Meta["og:site_name"])
+	p.Description = clean(p.Meta["og:description"])
+	if len(p.Description) == 0 {
+		p.Description = clean(p.Meta["description"])
+	}
+}
+
+// clean collapses whitespace so the text fits on a line.
+func clean(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Public checks that an ip is a public unicast address.
+func Public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, block := range reserved {
+		if block.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// reserved are the blocks the net.IP methods don't cover.
+var reserved = func() []*net.IPNet {
+	var blocks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // this network
+		"100.64.0.0/10",   // carrier grade nat
+		"192.0.0.0/24",    // protocol assignments
+		"192.0.2.0/24",    // documentation
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"240.0.0.0/4",     // reserved
+		"64:ff9b::/96",    // nat64, can reach ipv4 private space
+		"2001:db8::/32",   // documentation
+	} {
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}()
@@ -0,0 +1,147 @@
+package preview
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPublic(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"fc00::1":         false,
+		"0.0.0.0":         false,
+		"100.64.0.1":      false,
+		"198.18.0.1":      false,
+		"224.0.0.1":       false,
+		"64:ff9b::a00:1":  false,
+		"::ffff:10.0.0.1": false,
+	}
+
+	for addr, want := range tests {
+		if got := Public(net.ParseIP(addr)); got != want {
+			t.Errorf("%s: want %v, got %v", addr, want, got)
+		}
+	}
+}
+
+func serve(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func htmlPage(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, body)
+	}
+}
+
+func TestFetchRefusesPrivate(t *testing.T) {
+	srv := serve(t, htmlPage("<title>secret</title>"))
+
+	f := New()
+	if _, err := f.Fetch(context.Background(), srv.URL); err != ErrForbiddenAddress {
+		t.Errorf("want ErrForbiddenAddress for %s, got %v", srv.URL, err)
+	}
+
+	f.AllowPrivate = true
+	p, err := f.Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "secret" {
+		t.Errorf("want the title when private addresses are allowed, got %q", p.Title)
+	}
+}
+
+func TestFetchMaxBytes(t *testing.T) {
+	padding := "<!--" + strings.Repeat("x", 1000) + "-->"
+	early := serve(t, htmlPage("<title>early</title>"+padding))
+	late := serve(t, htmlPage(padding+"<title>late</title>"))
+
+	f := New()
+	f.AllowPrivate = true
+	f.MaxBytes = 500
+
+	p, err := f.Fetch(context.Background(), early.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "early" {
+		t.Errorf("want the title inside the limit, got %q", p.Title)
+	}
+
+	p, err = f.Fetch(context.Background(), late.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Title) != 0 {
+		t.Errorf("the title past the limit shouldn't be read, got %q", p.Title)
+	}
+}
+
+func TestFetchContentType(t *testing.T) {
+	tests := map[string]error{
+		"text/html":                       nil,
+		"text/html; charset=iso-8859-1":   nil,
+		"application/xhtml+xml":           nil,
+		"image/png":                       ErrNotHTML,
+		"application/octet-stream":        ErrNotHTML,
+		"text/plain":                      ErrNotHTML,
+		"":                                ErrNotHTML,
+		"application/json; charset=utf-8": ErrNotHTML,
+		"TEXT/HTML; charset=\"utf-8\"":    nil,
+	}
+
+	f := New()
+	f.AllowPrivate = true
+
+	for contentType, want := range tests {
+		srv := serve(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header()["Content-Type"] = []string{contentType}
+			io.WriteString(w, "<title>page</title>")
+		})
+		if _, err := f.Fetch(context.Background(), srv.URL); err != want {
+			t.Errorf("%q: want %v, got %v", contentType, want, err)
+		}
+	}
+}
+
+func TestSummaryCached(t *testing.T) {
+	var hits int
+	srv := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		htmlPage(`<title>Cached</title><meta property="og:site_name" content="Site">`)(w, r)
+	})
+
+	f := New()
+	f.AllowPrivate = true
+
+	for i := 0; i < 2; i++ {
+		summary, err := f.Summary(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary != "Site: Cached" {
+			t.Errorf("want %q, got %q", "Site: Cached", summary)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("want the page fetched once, got %d", hits)
+	}
+}
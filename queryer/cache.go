@@ -0,0 +1,178 @@
+package queryer
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCacheSize = 1000
+
+// defaultTTLs is how long each command's results are kept, commands that
+// aren't listed aren't cached. They can be changed with query_cache_<cmd>
+// in the config. Shorten isn't cached so a link deleted with delshort isn't
+// handed out again.
+var defaultTTLs = map[string]time.Duration{
+	"search":   time.Hour,
+	"google":   time.Hour,
+	"bing":     time.Hour,
+	"calc":     24 * time.Hour,
+	"weather":  15 * time.Minute,
+	"forecast": time.Hour,
+	"stars":    10 * time.Minute,
+	"gh":       5 * time.Minute,
+	"tr":       24 * time.Hour,
+	"define":   24 * time.Hour,
+	"urban":    time.Hour,
+	"youtube":  time.Hour,
+}
+
+// caseSensitive commands don't lowercase their query before using it as a
+// key, calc's units are case sensitive for example since Mb isn't MB, and so
+// are translations and youtube's video ids. Queries start with the
+// provider's name so channels using different providers don't share results.
+var caseSensitive = map[string]bool{
+	"calc":    true,
+	"tr":      true,
+	"youtube": true,
+}
+
+// cache is a size bounded TTL cache for the results of the query commands,
+// the least recently used result is dropped when it's full.
+type cache struct {
+	mut     sync.Mutex
+	size    int
+	ttls    map[string]time.Duration
+	entries map[string]*list.Element
+	lru     *list.List
+	stats   map[string]*cacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	val     string
+	expires time.Time
+}
+
+type cacheStats struct {
+	hits   uint64
+	misses uint64
+}
+
+func newCache(size int, ttls map[string]time.Duration) *cache {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+
+	return &cache{
+		size:    size,
+		ttls:    ttls,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		stats:   make(map[string]*cacheStats),
+	}
+}
+
+// configure changes the size and ttls, shrinking the cache if needed.
+func (c *cache) configure(size int, ttls map[string]time.Duration) {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.size, c.ttls = size, ttls
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// do returns the cached result for the command and query, or calls fn and
+// caches what it returns. Errors and empty results aren't cached.
+func (c *cache) do(command, query string, fn func() (string, error)) (string, error) {
+	key := cacheKey(command, query)
+	now := time.Now()
+
+	c.mut.Lock()
+	ttl := c.ttls[command]
+	stats, ok := c.stats[command]
+	if !ok {
+		stats = &cacheStats{}
+		c.stats[command] = stats
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if now.Before(entry.expires) {
+			stats.hits++
+			c.lru.MoveToFront(elem)
+			c.mut.Unlock()
+			return entry.val, nil
+		}
+		c.remove(elem)
+	}
+	stats.misses++
+	c.mut.Unlock()
+
+	val, err := fn()
+	if err != nil || len(val) == 0 || ttl <= 0 {
+		return val, err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, val: val, expires: now.Add(ttl)})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+
+	return val, nil
+}
+
+// remove must be called with mut held.
+func (c *cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// String reports the hit rate of each command.
+func (c *cache) String() string {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	commands := make([]string, 0, len(c.stats))
+	for command := range c.stats {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	parts := make([]string, 0, len(commands)+1)
+	parts = append(parts, fmt.Sprintf("%d/%d cached", c.lru.Len(), c.size))
+	for _, command := range commands {
+		s := c.stats[command]
+		rate := 0.0
+		if total := s.hits + s.misses; total != 0 {
+			rate = 100 * float64(s.hits) / float64(total)
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d hits, %d misses (%.0f%%)",
+			command, s.hits, s.misses, rate))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func cacheKey(command, query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if !caseSensitive[command] {
+		query = strings.ToLower(query)
+	}
+	return command + "\x00" + query
+}
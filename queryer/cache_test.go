@@ -0,0 +1,165 @@
+package queryer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lookup counts the calls made to answer queries.
+type lookup struct {
+	calls int
+}
+
+func (l *lookup) fn(val string, err error) func() (string, error) {
+	return func() (string, error) {
+		l.calls++
+		return val, err
+	}
+}
+
+func TestCacheHit(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(10, map[string]time.Duration{"google": time.Hour})
+	l := &lookup{}
+
+	for _, query := range []string{"Go  Lang", "go lang", " GO LANG "} {
+		val, err := c.do("google", query, l.fn("result", nil))
+		if err != nil || val != "result" {
+			t.Errorf("%q: want the result, got %q %v", query, val, err)
+		}
+	}
+	if l.calls != 1 {
+		t.Errorf("want queries differing in case and spaces to share a result, got %d calls", l.calls)
+	}
+
+	if _, err := c.do("bing", "go lang", l.fn("other", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.do("bing", "go lang", l.fn("other", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if l.calls != 3 {
+		t.Errorf("want commands without a ttl never cached, got %d calls", l.calls)
+	}
+}
+
+func TestCacheCaseSensitive(t *testing.T) {
+	t.Parallel()
+
+	ttls := make(map[string]time.Duration)
+	for command := range defaultTTLs {
+		ttls[command] = time.Hour
+	}
+	c := newCache(10, ttls)
+
+	for _, command := range []string{"calc", "tr", "youtube"} {
+		l := &lookup{}
+		c.do(command, "dQw4w9WgXcQ", l.fn("lower", nil))
+		val, _ := c.do(command, "DQW4W9WGXCQ", l.fn("upper", nil))
+		if l.calls != 2 || val != "upper" {
+			t.Errorf("%s: want queries differing in case kept apart, got %d calls and %q", command, l.calls, val)
+		}
+	}
+
+	l := &lookup{}
+	c.do("define", "Word", l.fn("lower", nil))
+	if val, _ := c.do("define", "WORD", l.fn("upper", nil)); l.calls != 1 || val != "lower" {
+		t.Errorf("want define's queries folded, got %d calls and %q", l.calls, val)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(10, map[string]time.Duration{"google": time.Hour})
+	l := &lookup{}
+
+	c.do("google", "query", l.fn("old", nil))
+
+	c.mut.Lock()
+	c.entries[cacheKey("google", "query")].Value.(*cacheEntry).expires = time.Now().Add(-time.Second)
+	c.mut.Unlock()
+
+	if val, _ := c.do("google", "query", l.fn("new", nil)); val != "new" || l.calls != 2 {
+		t.Errorf("want an expired result looked up again, got %q after %d calls", val, l.calls)
+	}
+	if val, _ := c.do("google", "query", l.fn("newer", nil)); val != "new" || l.calls != 2 {
+		t.Errorf("want the new result cached, got %q after %d calls", val, l.calls)
+	}
+}
+
+func TestCacheErrorsAndEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(10, map[string]time.Duration{"google": time.Hour})
+	l := &lookup{}
+
+	wantErr := errors.New("failed")
+	if _, err := c.do("google", "query", l.fn("", wantErr)); err != wantErr {
+		t.Errorf("want the lookup's error, got %v", err)
+	}
+	c.do("google", "query", l.fn("", nil))
+	c.do("google", "query", l.fn("found", nil))
+	if l.calls != 3 {
+		t.Errorf("want errors and empty results not cached, got %d calls", l.calls)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(3, map[string]time.Duration{"google": time.Hour})
+	l := &lookup{}
+
+	for i := 0; i < 3; i++ {
+		c.do("google", fmt.Sprint(i), l.fn("result", nil))
+	}
+	// 0 is now the most recently used, so 1 goes first.
+	c.do("google", "0", l.fn("result", nil))
+	c.do("google", "3", l.fn("result", nil))
+
+	if c.lru.Len() != 3 || len(c.entries) != 3 {
+		t.Fatalf("want the cache kept to 3, got %d %d", c.lru.Len(), len(c.entries))
+	}
+	for query, want := range map[string]bool{"0": true, "1": false, "2": true, "3": true} {
+		if _, ok := c.entries[cacheKey("google", query)]; ok != want {
+			t.Errorf("%s: want cached %v, got %v", query, want, ok)
+		}
+	}
+
+	c.configure(1, c.ttls)
+	if _, ok := c.entries[cacheKey("google", "3")]; !ok || len(c.entries) != 1 {
+		t.Errorf("want only the most recent result left after shrinking, got %d", len(c.entries))
+	}
+	c.configure(0, c.ttls)
+	if c.size != defaultCacheSize {
+		t.Errorf("want the default size for 0, got %d", c.size)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	t.Parallel()
+
+	c := newCache(10, map[string]time.Duration{"google": time.Hour, "calc": time.Hour})
+	l := &lookup{}
+
+	c.do("google", "a", l.fn("result", nil))
+	c.do("google", "a", l.fn("result", nil))
+	c.do("google", "a", l.fn("result", nil))
+	c.do("google", "b", l.fn("result", nil))
+	c.do("calc", "1+1", l.fn("", errors.New("failed")))
+
+	got := c.String()
+	want := "2/10 cached, calc: 0 hits, 1 misses (0%), google: 2 hits, 2 misses (50%)"
+	if got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if got := newCache(5, nil).String(); !strings.HasPrefix(got, "0/5 cached") || strings.Contains(got, ",") {
+		t.Errorf("want only the size without stats, got %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package queryer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	dictionaryURL = "https://api.dictionaryapi.dev"
+	urbanURL      = "https://api.urbandictionary.com"
+	// maxDefinitions is how many meanings of a word are shown.
+	maxDefinitions = 3
+)
+
+// rgxUrbanLink matches urban dictionary's [links] to other definitions.
+var rgxUrbanLink = regexp.MustCompile(`\[([^\]]*)\]`)
+
+// dictionary defines english words with dictionaryapi.dev, which needs no
+// api key. language in [providers.dictionary] picks another language.
+type dictionary struct {
+	cfg ProviderConfig
+}
+
+func newDictionary(cfg ProviderConfig) Provider {
+	return dictionary{cfg: cfg}
+}
+
+// Query defines a word.
+func (d dictionary) Query(ctx context.Context, word string) (string, error) {
+	word = strings.TrimSpace(word)
+	path := fmt.Sprintf("/api/v2/entries/%s/%s",
+		url.PathEscape(d.cfg.Option("language", "en")), url.PathEscape(word))
+	req, err := http.NewRequest(http.MethodGet, d.cfg.BaseURL(dictionaryURL)+path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var entries []struct {
+		Word     string `json:"word"`
+		Phonetic string `json:"phonetic"`
+		Meanings []struct {
+			PartOfSpeech string `json:"partOfSpeech"`
+			Definitions  []struct {
+				Definition string `json:"definition"`
+			} `json:"definitions"`
+		} `json:"meanings"`
+	}
+	err = getJSON(ctx, d.cfg.Client, "dictionary", req, &entries)
+	if isNotFound(err) || (err == nil && len(entries) == 0) {
+		return fmt.Sprintf("\x02Define:\x02 No definition of %s found.", word), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	entry := entries[0]
+	var defs []string
+	for _, e := range entries {
+		for _, m := range e.Meanings {
+			if len(m.Definitions) == 0 || len(defs) == maxDefinitions {
+				continue
+			}
+			defs = append(defs, fmt.Sprintf("\x02%d.\x02 (%s) %s",
+				len(defs)+1, m.PartOfSpeech, m.Definitions[0].Definition))
+		}
+	}
+	if len(defs) == 0 {
+		return fmt.Sprintf("\x02Define:\x02 No definition of %s found.", word), nil
+	}
+
+	name := entry.Word
+	if len(entry.Phonetic) != 0 {
+		name += " " + entry.Phonetic
+	}
+	return fmt.Sprintf("\x02Define (\x02%s\x02):\x02 %s", name, strings.Join(defs, " ")), nil
+}
+
+// urban looks terms up on urban dictionary.
+type urban struct {
+	cfg ProviderConfig
+}
+
+func newUrban(cfg ProviderConfig) Provider {
+	return urban{cfg: cfg}
+}
+
+// Query shows the top definition of a term.
+func (u urban) Query(ctx context.Context, term string) (string, error) {
+	term = strings.TrimSpace(term)
+	vals := url.Values{"term": {term}}
+	req, err := http.NewRequest(http.MethodGet, u.cfg.BaseURL(urbanURL)+"/v0/define?"+vals.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		List []struct {
+			Word       string `json:"word"`
+			Definition string `json:"definition"`
+			Example    string `json:"example"`
+			ThumbsUp   int    `json:"thumbs_up"`
+			ThumbsDown int    `json:"thumbs_down"`
+		} `json:"list"`
+	}
+	if err := getJSON(ctx, u.cfg.Client, "urban dictionary", req, &result); err != nil {
+		return "", err
+	}
+
+	if len(result.List) == 0 {
+		return fmt.Sprintf("\x02Urban:\x02 No definition of %s found.", term), nil
+	}
+
+	// The first is usually the best, but not always.
+	best := result.List[0]
+	for _, def := range result.List[1:] {
+		if def.ThumbsUp-def.ThumbsDown > best.ThumbsUp-best.ThumbsDown {
+			best = def
+		}
+	}
+
+	out := fmt.Sprintf("\x02Urban (\x02%s, +%d -%d\x02):\x02 %s",
+		best.Word, best.ThumbsUp, best.ThumbsDown, rgxUrbanLink.ReplaceAllString(best.Definition, "$1"))
+	if len(best.Example) != 0 {
+		out += " \x02Example:\x02 " + rgxUrbanLink.ReplaceAllString(best.Example, "$1")
+	}
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package queryer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestDictionary(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/entries/en/run":
+			io.WriteString(w, `[
+				{"word":"run","phonetic":"/ɹʌn/","meanings":[
+					{"partOfSpeech":"verb","definitions":[{"definition":"To move quickly."},{"definition":"unused"}]},
+					{"partOfSpeech":"noun","definitions":[{"definition":"An act of running."}]}]},
+				{"word":"run","meanings":[
+					{"partOfSpeech":"adjective","definitions":[]},
+					{"partOfSpeech":"adjective","definitions":[{"definition":"Melted."}]},
+					{"partOfSpeech":"verb","definitions":[{"definition":"One too many."}]}]}]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"title":"No Definitions Found"}`)
+		}
+	})
+	d := newDictionary(cfg)
+
+	out, err := d.Query(context.Background(), " run ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\x02Define (\x02run /ɹʌn/\x02):\x02 \x021.\x02 (verb) To move quickly. " +
+		"\x022.\x02 (noun) An act of running. \x023.\x02 (adjective) Melted."
+	if out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	out, err = d.Query(context.Background(), "zzxq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02Define:\x02 No definition of zzxq found."; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+}
+
+func TestDictionaryLanguage(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, reply(t, "/api/v2/entries/es/hola", nil,
+		`[{"word":"hola","meanings":[{"partOfSpeech":"interjección","definitions":[{"definition":"Saludo."}]}]}]`))
+	cfg.Options["language"] = "es"
+
+	out, err := newDictionary(cfg).Query(context.Background(), "hola")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02Define (\x02hola\x02):\x02 \x021.\x02 (interjección) Saludo."; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+}
+
+func TestUrban(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v0/define" {
+			t.Errorf("want /v0/define, got %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("term") != "yeet" {
+			io.WriteString(w, `{"list":[]}`)
+			return
+		}
+		io.WriteString(w, `{"list":[
+			{"word":"yeet","definition":"first","thumbs_up":10,"thumbs_down":8},
+			{"word":"Yeet","definition":"To [throw] hard.","example":"He [yeeted] it.","thumbs_up":7,"thumbs_down":1}]}`)
+	})
+	u := newUrban(cfg)
+
+	out, err := u.Query(context.Background(), "yeet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\x02Urban (\x02Yeet, +7 -1\x02):\x02 To throw hard. \x02Example:\x02 He yeeted it."
+	if out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	out, err = u.Query(context.Background(), "nothing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02Urban:\x02 No definition of nothing found."; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+}
@@ -0,0 +1,495 @@
+package queryer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ircmsg"
+	"github.com/aarondl/uq/settings"
+)
+
+const (
+	githubURL = "https://api.github.com"
+	// maxStarPages limits how many pages of a user's repos are counted.
+	maxStarPages = 10
+	// maxGithubLinks is how many issue and pr links are expanded from a
+	// single line.
+	maxGithubLinks = 3
+	// privateKey is the config key listing the repos the token is used for,
+	// like owner/repo or owner/*, separated by commas.
+	privateKey = "queryer_github_private"
+)
+
+var (
+	rgxGithubRef  = regexp.MustCompile(`^([\w.-]+)/([\w.-]+)#(\d+)$`)
+	rgxGithubLink = regexp.MustCompile(
+		`https?://(?:www\.)?github\.com/([\w.-]+)/([\w.-]+)/(issues|pull)/(\d+)`)
+)
+
+// github talks to the github api, it's the stars provider and what the gh
+// command and issue links use. The token is github_api_key from query.toml
+// or token in [providers.github], base_url can point it at a fake server.
+//
+// The token can see whatever its owner can, so repos are looked up without
+// it unless the config allows them for the channel with
+// queryer_github_private. It's only read from the config since anyone that
+// can change a channel's settings could otherwise give it the owner's repos.
+type github struct {
+	cfg ProviderConfig
+	// anonymous leaves the token off the requests.
+	anonymous bool
+	// private is set when the token is used for a repo the channel allows.
+	private bool
+}
+
+func newGithub(cfg ProviderConfig) Provider {
+	return github{cfg: cfg}
+}
+
+// githubRef is an issue or pull request.
+type githubRef struct {
+	Owner  string
+	Repo   string
+	Number int
+}
+
+func (r githubRef) String() string {
+	return fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, r.Number)
+}
+
+func (r githubRef) path() string {
+	return "/repos/" + url.PathEscape(r.Owner) + "/" + url.PathEscape(r.Repo)
+}
+
+// forRepo returns g with the token only if the repo is one of allowed, the
+// queryer_github_private config value.
+func (g github) forRepo(owner, repo, allowed string) github {
+	g.private = privateRepo(allowed, owner, repo)
+	g.anonymous = !g.private
+	return g
+}
+
+// privateRepo checks if owner/repo is in allowed, a comma separated list of
+// owner/repo or owner/*.
+func privateRepo(allowed, owner, repo string) bool {
+	for _, a := range strings.Split(allowed, ",") {
+		parts := strings.SplitN(strings.TrimSpace(a), "/", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], owner) {
+			continue
+		}
+		if parts[1] == "*" || strings.EqualFold(parts[1], repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKey marks key as looked up in a private repo so the answer isn't
+// given to channels that don't allow it.
+func (g github) cacheKey(key string) string {
+	if g.private {
+		return "private " + key
+	}
+	return key
+}
+
+// parseGithubRef parses owner/repo#123, owner/repo 123 or a link to an issue
+// or pull request. A bare number or #123 uses defaultRepo.
+func parseGithubRef(args []string, defaultRepo string) (githubRef, bool) {
+	var ref githubRef
+	var number string
+
+	switch {
+	case len(args) == 1 && rgxGithubLink.MatchString(args[0]):
+		m := rgxGithubLink.FindStringSubmatch(args[0])
+		ref.Owner, ref.Repo, number = m[1], m[2], m[4]
+	case len(args) == 1 && rgxGithubRef.MatchString(args[0]):
+		m := rgxGithubRef.FindStringSubmatch(args[0])
+		ref.Owner, ref.Repo, number = m[1], m[2], m[3]
+	case len(args) == 2:
+		repo := strings.SplitN(args[0], "/", 2)
+		if len(repo) != 2 {
+			return ref, false
+		}
+		ref.Owner, ref.Repo, number = repo[0], repo[1], strings.TrimPrefix(args[1], "#")
+	case len(args) == 1 && len(defaultRepo) != 0:
+		repo := strings.SplitN(defaultRepo, "/", 2)
+		if len(repo) != 2 {
+			return ref, false
+		}
+		ref.Owner, ref.Repo, number = repo[0], repo[1], strings.TrimPrefix(args[0], "#")
+	default:
+		return ref, false
+	}
+
+	var err error
+	ref.Number, err = strconv.Atoi(number)
+	return ref, err == nil && ref.Number > 0
+}
+
+// githubLinks finds the issues and pull requests linked in msg.
+func githubLinks(msg string) []githubRef {
+	var refs []githubRef
+	for _, m := range rgxGithubLink.FindAllStringSubmatch(msg, -1) {
+		ref, _ := parseGithubRef([]string{m[0]}, "")
+
+		dupe := false
+		for _, have := range refs {
+			dupe = dupe || have == ref
+		}
+		if !dupe {
+			refs = append(refs, ref)
+		}
+		if len(refs) == maxGithubLinks {
+			break
+		}
+	}
+	return refs
+}
+
+// Query counts the stars of a repo or all of a user's repos.
+func (g github) Query(ctx context.Context, userOrRepo string) (string, error) {
+	userOrRepo = strings.ToLower(strings.Trim(userOrRepo, "/"))
+	if len(userOrRepo) == 0 {
+		return "", errors.New("must supply a user or repo")
+	}
+
+	var count int
+	var err error
+	if parts := strings.SplitN(userOrRepo, "/", 2); len(parts) == 2 {
+		var repo struct {
+			Stars int `json:"stargazers_count"`
+		}
+		// The stars provider doesn't know the channel, so repos are public.
+		g.anonymous = true
+		err = g.get(ctx, "/repos/"+url.PathEscape(parts[0])+"/"+url.PathEscape(parts[1]), &repo)
+		count = repo.Stars
+	} else {
+		count, err = g.userStars(ctx, userOrRepo)
+	}
+
+	if isNotFound(err) {
+		return fmt.Sprintf("\x02Github stars:\x02 could not find %s", userOrRepo), nil
+	} else if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("\x02Github stars (%s):\x02 %d", userOrRepo, count), nil
+}
+
+func (g github) userStars(ctx context.Context, user string) (int, error) {
+	count := 0
+	for page := 1; page <= maxStarPages; page++ {
+		var repos []struct {
+			Stars int `json:"stargazers_count"`
+		}
+		vals := url.Values{
+			"type":     {"public"},
+			"per_page": {"100"},
+			"page":     {fmt.Sprint(page)},
+		}
+		if err := g.get(ctx, "/users/"+url.PathEscape(user)+"/repos?"+vals.Encode(), &repos); err != nil {
+			return 0, err
+		}
+
+		for _, r := range repos {
+			count += r.Stars
+		}
+		if len(repos) < 100 {
+			break
+		}
+	}
+	return count, nil
+}
+
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+type githubLabel struct {
+	Name string `json:"name"`
+}
+
+func labelNames(labels []githubLabel) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, len(labels))
+	for i, l := range labels {
+		names[i] = l.Name
+	}
+	return ", labels: " + strings.Join(names, ", ")
+}
+
+// Issue describes an issue, or a pull request since github's issues include
+// them. Like the other lookups it returns a statusError if there's no such
+// thing, or the token can't see it.
+func (g github) Issue(ctx context.Context, ref githubRef) (string, error) {
+	var issue struct {
+		Title       string        `json:"title"`
+		State       string        `json:"state"`
+		User        githubUser    `json:"user"`
+		Labels      []githubLabel `json:"labels"`
+		Comments    int           `json:"comments"`
+		HTMLURL     string        `json:"html_url"`
+		PullRequest *struct{}     `json:"pull_request"`
+	}
+	err := g.get(ctx, fmt.Sprintf("%s/issues/%d", ref.path(), ref.Number), &issue)
+	if err != nil {
+		return "", err
+	}
+
+	if issue.PullRequest != nil {
+		return g.Pull(ctx, ref)
+	}
+
+	return fmt.Sprintf("\x02Issue %s:\x02 %s [%s] by %s%s, %d comments %s",
+		ref, issue.Title, issue.State, issue.User.Login, labelNames(issue.Labels),
+		issue.Comments, issue.HTMLURL), nil
+}
+
+// Pull describes a pull request.
+func (g github) Pull(ctx context.Context, ref githubRef) (string, error) {
+	var pull struct {
+		Title        string        `json:"title"`
+		State        string        `json:"state"`
+		Draft        bool          `json:"draft"`
+		Merged       bool          `json:"merged"`
+		User         githubUser    `json:"user"`
+		Labels       []githubLabel `json:"labels"`
+		Additions    int           `json:"additions"`
+		Deletions    int           `json:"deletions"`
+		ChangedFiles int           `json:"changed_files"`
+		HTMLURL      string        `json:"html_url"`
+	}
+	err := g.get(ctx, fmt.Sprintf("%s/pulls/%d", ref.path(), ref.Number), &pull)
+	if err != nil {
+		return "", err
+	}
+
+	state := pull.State
+	switch {
+	case pull.Merged:
+		state = "merged"
+	case pull.Draft && state == "open":
+		state = "draft"
+	}
+
+	return fmt.Sprintf("\x02PR %s:\x02 %s [%s] by %s%s, +%d -%d in %d files %s",
+		ref, pull.Title, state, pull.User.Login, labelNames(pull.Labels),
+		pull.Additions, pull.Deletions, pull.ChangedFiles, pull.HTMLURL), nil
+}
+
+// Release describes a repo's latest release.
+func (g github) Release(ctx context.Context, owner, repo string) (string, error) {
+	var release struct {
+		TagName     string     `json:"tag_name"`
+		Name        string     `json:"name"`
+		Author      githubUser `json:"author"`
+		Prerelease  bool       `json:"prerelease"`
+		PublishedAt time.Time  `json:"published_at"`
+		HTMLURL     string     `json:"html_url"`
+	}
+	name := owner + "/" + repo
+	err := g.get(ctx, "/repos/"+url.PathEscape(owner)+"/"+url.PathEscape(repo)+"/releases/latest", &release)
+	if err != nil {
+		return "", err
+	}
+
+	title := release.TagName
+	if len(release.Name) != 0 && release.Name != release.TagName {
+		title += " " + release.Name
+	}
+	if release.Prerelease {
+		title += " [prerelease]"
+	}
+
+	return fmt.Sprintf("\x02Release %s:\x02 %s by %s on %s %s",
+		name, title, release.Author.Login, release.PublishedAt.Format("2006-01-02"), release.HTMLURL), nil
+}
+
+// User describes a user or organization.
+func (g github) User(ctx context.Context, login string) (string, error) {
+	var user struct {
+		Login       string `json:"login"`
+		Name        string `json:"name"`
+		Type        string `json:"type"`
+		Bio         string `json:"bio"`
+		PublicRepos int    `json:"public_repos"`
+		Followers   int    `json:"followers"`
+		HTMLURL     string `json:"html_url"`
+	}
+	err := g.get(ctx, "/users/"+url.PathEscape(login), &user)
+	if err != nil {
+		return "", err
+	}
+
+	name := user.Login
+	if len(user.Name) != 0 {
+		name += " (" + user.Name + ")"
+	}
+	if len(user.Bio) != 0 {
+		name += " - " + user.Bio
+	}
+
+	return fmt.Sprintf("\x02GitHub %s:\x02 %s, %d repos, %d followers %s",
+		strings.ToLower(user.Type), name, user.PublicRepos, user.Followers, user.HTMLURL), nil
+}
+
+func (g github) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, g.cfg.BaseURL(githubURL)+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := g.cfg.Option("token", g.cfg.Keys.GithubAPIKey); len(token) != 0 && !g.anonymous {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return getJSON(ctx, g.cfg.Client, "github", req, v)
+}
+
+func isNotFound(err error) bool {
+	var status statusError
+	return errors.As(err, &status) && status.status == http.StatusNotFound
+}
+
+// Gh looks up issues, pull requests, releases and users on github.
+func (q Queryer) Gh(w irc.Writer, ev *cmd.Event) error {
+	nick := ev.Nick()
+	what := strings.ToLower(ev.Args["what"])
+	args := strings.Fields(ev.Args["args"])
+
+	p, ok := q.provider(w, ev, KindStars, "github")
+	if !ok {
+		return nil
+	}
+	gh, ok := p.(github)
+	if !ok {
+		w.Notice(nick, "\x02GitHub:\x02 The github provider has been replaced.")
+		return nil
+	}
+
+	var channel string
+	if ev.IsTargetChan() {
+		channel = ev.Target()
+	}
+	defaultRepo := settings.String(q.b, ev.NetworkID, channel, "queryer", "github_repo")
+	private := settings.Config(q.b, ev.NetworkID, channel, privateKey)
+
+	// name is what's looked up, the cache key is what and name.
+	var name string
+	var fn func(ctx context.Context) (string, error)
+	switch what {
+	case "issue", "pr":
+		ref, ok := parseGithubRef(args, defaultRepo)
+		if !ok {
+			w.Noticef(nick, "\x02GitHub:\x02 Usage: gh %s owner/repo#123", what)
+			return nil
+		}
+		gh = gh.forRepo(ref.Owner, ref.Repo, private)
+		name = ref.String()
+		fn = func(ctx context.Context) (string, error) { return gh.Issue(ctx, ref) }
+		if what == "pr" {
+			fn = func(ctx context.Context) (string, error) { return gh.Pull(ctx, ref) }
+		}
+	case "release":
+		repo := defaultRepo
+		if len(args) != 0 {
+			repo = args[0]
+		}
+		parts := strings.SplitN(strings.Trim(repo, "/"), "/", 2)
+		if len(args) > 1 || len(parts) != 2 {
+			w.Notice(nick, "\x02GitHub:\x02 Usage: gh release owner/repo")
+			return nil
+		}
+		gh = gh.forRepo(parts[0], parts[1], private)
+		name = parts[0] + "/" + parts[1]
+		fn = func(ctx context.Context) (string, error) { return gh.Release(ctx, parts[0], parts[1]) }
+	case "user":
+		if len(args) != 1 {
+			w.Notice(nick, "\x02GitHub:\x02 Usage: gh user name")
+			return nil
+		}
+		login := args[0]
+		name = login
+		fn = func(ctx context.Context) (string, error) { return gh.User(ctx, login) }
+	default:
+		w.Notice(nick, "\x02GitHub:\x02 Try gh issue, gh pr, gh release or gh user.")
+		return nil
+	}
+
+	key := gh.cacheKey(what + " " + name)
+	return q.answer(w, ev, "gh", "github", key, 0, p, func(ctx context.Context) (string, error) {
+		out, err := fn(ctx)
+		if isNotFound(err) {
+			return "", fmt.Errorf("\x02GitHub:\x02 Could not find %s.", name)
+		}
+		return out, err
+	})
+}
+
+// githubLinkHandler expands the issues and pull requests linked in channels
+// that have turned it on.
+type githubLinkHandler struct {
+	q *Queryer
+}
+
+// Handle expands links, failures are only logged like youtube's.
+func (g githubLinkHandler) Handle(w irc.Writer, ev *irc.Event) {
+	if !ev.IsTargetChan() {
+		return
+	}
+
+	q := g.q
+	network, channel := ev.NetworkID, ev.Target()
+	if !settings.Bool(q.b, network, channel, "queryer", "github") {
+		return
+	}
+	window := settings.Duration(q.b, network, channel, "queryer", "github_dedupe")
+	private := settings.Config(q.b, network, channel, privateKey)
+
+	p, ok := getProvider(KindStars, "github")
+	if !ok {
+		return
+	}
+	gh, ok := p.(github)
+	if !ok {
+		return
+	}
+
+	for _, ref := range githubLinks(ev.Message()) {
+		if q.seen.has(network, channel, "github:"+ref.String()) {
+			continue
+		}
+
+		if ok, _, _ := q.allowed(ev, "github"); !ok {
+			return
+		}
+
+		ref := ref
+		gh := gh.forRepo(ref.Owner, ref.Repo, private)
+		out, err := q.cache.do("gh", gh.cacheKey("github issue "+ref.String()), func() (string, error) {
+			if err := q.limit.spend("github"); err != nil {
+				return "", err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+			defer cancel()
+			return gh.Issue(ctx, ref)
+		})
+		if err != nil {
+			q.b.Logger.Debug("github lookup failed", "ref", ref.String(), "err", err)
+			continue
+		}
+		q.seen.mark(network, channel, "github:"+ref.String(), window)
+		ircmsg.Privmsg(q.b, w, network, channel, sanitize(out))
+	}
+}
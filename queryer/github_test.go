@@ -0,0 +1,120 @@
+package queryer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/query"
+)
+
+// fakeGithub answers every issue with a title saying whether the token was
+// sent.
+func fakeGithub(t *testing.T) github {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authed := r.Header.Get("Authorization") == "Bearer secret"
+		fmt.Fprintf(w, `{"title":"authed %v","state":"open","user":{"login":"someone"}}`, authed)
+	}))
+	t.Cleanup(srv.Close)
+
+	return newGithub(ProviderConfig{
+		Keys:    &query.Config{},
+		Client:  srv.Client(),
+		Options: map[string]string{"base_url": srv.URL, "token": "secret"},
+	}).(github)
+}
+
+func TestGithubPrivateRepos(t *testing.T) {
+	t.Parallel()
+
+	gh := fakeGithub(t)
+	ref := githubRef{Owner: "aarondl", Repo: "secret", Number: 1}
+
+	tests := []struct {
+		allowed string
+		authed  bool
+	}{
+		{"", false},
+		{"aarondl/uq", false},
+		{"someone/*", false},
+		{"aarondl/secret", true},
+		{"other/repo, AaronDL/*", true},
+	}
+
+	for _, test := range tests {
+		g := gh.forRepo(ref.Owner, ref.Repo, test.allowed)
+		out, err := g.Issue(context.Background(), ref)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.allowed, err)
+			continue
+		}
+		if want := fmt.Sprintf("authed %v", test.authed); !strings.Contains(out, want) {
+			t.Errorf("%q: want %s, got %s", test.allowed, want, out)
+		}
+		if key := g.cacheKey("issue"); strings.HasPrefix(key, "private ") != test.authed {
+			t.Errorf("%q: the cache key should only be private when the token is used, got %s", test.allowed, key)
+		}
+	}
+}
+
+func TestParseGithubRef(t *testing.T) {
+	t.Parallel()
+
+	uq := githubRef{Owner: "aarondl", Repo: "uq", Number: 12}
+	tests := []struct {
+		args        []string
+		defaultRepo string
+		want        githubRef
+		ok          bool
+	}{
+		{[]string{"aarondl/uq#12"}, "", uq, true},
+		{[]string{"aarondl/uq", "12"}, "", uq, true},
+		{[]string{"aarondl/uq", "#12"}, "", uq, true},
+		{[]string{"https://github.com/aarondl/uq/issues/12"}, "", uq, true},
+		{[]string{"http://www.github.com/aarondl/uq/pull/12"}, "", uq, true},
+		{[]string{"https://github.com/aarondl/uq/pull/12/files"}, "", uq, true},
+		{[]string{"12"}, "aarondl/uq", uq, true},
+		{[]string{"#12"}, "aarondl/uq", uq, true},
+		{[]string{"aarondl/uq#12"}, "other/repo", uq, true},
+		{[]string{"some.one/my-repo.go#1"}, "", githubRef{Owner: "some.one", Repo: "my-repo.go", Number: 1}, true},
+		{[]string{"12"}, "", githubRef{}, false},
+		{[]string{"12"}, "norepo", githubRef{}, false},
+		{[]string{"aarondl/uq#0"}, "", githubRef{}, false},
+		{[]string{"aarondl/uq", "twelve"}, "", githubRef{}, false},
+		{[]string{"aarondl", "12"}, "", githubRef{}, false},
+		{[]string{"https://github.com/aarondl/uq"}, "", githubRef{}, false},
+		{[]string{"aarondl/uq", "12", "extra"}, "", githubRef{}, false},
+		{nil, "aarondl/uq", githubRef{}, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseGithubRef(test.args, test.defaultRepo)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("%q (%s): want %v %v, got %v %v", test.args, test.defaultRepo,
+				test.want, test.ok, got, ok)
+		}
+	}
+}
+
+func TestGithubLinks(t *testing.T) {
+	t.Parallel()
+
+	msg := "see https://github.com/a/b/issues/1 and https://github.com/a/b/pull/1, " +
+		"https://github.com/a/b/issues/2 https://github.com/c/d/pull/3 https://github.com/e/f/issues/4"
+	refs := githubLinks(msg)
+
+	want := []string{"a/b#1", "a/b#2", "c/d#3"}
+	if len(refs) != len(want) {
+		t.Fatalf("want %v, got %v", want, refs)
+	}
+	for i, ref := range refs {
+		if ref.String() != want[i] {
+			t.Errorf("%d: want %s, got %s", i, want[i], ref)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package queryer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+)
+
+// ExemptFlag lets a user skip the rate limits, quotas still apply.
+const ExemptFlag = "q"
+
+// Default rates in burst/period form, changed with query_rate_user,
+// query_rate_channel and query_rate_provider in the config.
+const (
+	defaultUserRate     = "5/1m"
+	defaultChannelRate  = "15/1m"
+	defaultProviderRate = "60/1m"
+)
+
+// defaultUsageFile is where the day's quota usage is kept, changed with
+// query_usage_file in the config.
+const defaultUsageFile = "queryusage.json"
+
+// flushInterval is how often the day's usage is written out if it changed.
+const flushInterval = time.Minute
+
+// dailyUsage is the calls made to each provider on a day (UTC).
+type dailyUsage struct {
+	Day  string         `json:"day"`
+	Used map[string]int `json:"used"`
+}
+
+// quotaAliases are the names providers' quotas were set under before they
+// were named after the api they use, they're read if the new key isn't set.
+var quotaAliases = map[string]string{
+	"metno": "yr",
+	"isgd":  "shorten",
+}
+
+// rate is a token bucket's size and how long it takes to fill.
+type rate struct {
+	burst  float64
+	period time.Duration
+}
+
+func parseRate(s string) (rate, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return rate{}, fmt.Errorf("rate must look like burst/period: %s", s)
+	}
+
+	burst, err := strconv.Atoi(parts[0])
+	if err != nil || burst <= 0 {
+		return rate{}, fmt.Errorf("bad burst in rate: %s", s)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return rate{}, fmt.Errorf("bad period in rate: %s", s)
+	}
+
+	return rate{burst: float64(burst), period: period}, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// warned is when the owner can next be told to slow down, so the
+	// notices don't become a flood of their own.
+	warned time.Time
+}
+
+// fill the bucket for the time passed and return how long until it has a
+// token to spend.
+func (b *bucket) fill(r rate, now time.Time) time.Duration {
+	perToken := r.period / time.Duration(r.burst)
+	b.tokens += float64(now.Sub(b.last)) / float64(perToken)
+	if b.tokens > r.burst {
+		b.tokens = r.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(perToken))
+}
+
+// limiter rate limits the query commands per user, channel and provider and
+// keeps track of each provider's daily quota.
+type limiter struct {
+	b *bot.Bot
+
+	mut      sync.Mutex
+	user     rate
+	channel  rate
+	provider rate
+	buckets  map[string]*bucket
+
+	quotas map[string]int
+	used   map[string]int
+	day    string
+	// dirty is set when used has changed since it was last written to file,
+	// which is empty until load is called.
+	dirty bool
+	file  string
+
+	// flushing keeps the writes in the order their usage was taken.
+	flushing sync.Mutex
+	done     chan struct{}
+}
+
+func newLimiter(b *bot.Bot) *limiter {
+	return &limiter{
+		b:       b,
+		buckets: make(map[string]*bucket),
+		quotas:  make(map[string]int),
+		used:    make(map[string]int),
+		done:    make(chan struct{}),
+	}
+}
+
+// configure reads the rates and the daily quotas, set for each provider with
+// query_quota_<provider> in the config, 0 or unset is unlimited.
+func (l *limiter) configure(b *bot.Bot) error {
+	rates := map[string]string{
+		"query_rate_user":     defaultUserRate,
+		"query_rate_channel":  defaultChannelRate,
+		"query_rate_provider": defaultProviderRate,
+	}
+	quotas := make(map[string]int)
+
+	var err error
+	b.ReadConfig(func(cfg *config.Config) {
+		for key := range rates {
+			if val, ok := cfg.ExtGlobal().ConfigVal("", "", key); ok {
+				rates[key] = val
+			}
+		}
+		for _, p := range ProviderNames("") {
+			key := "query_quota_" + p
+			val, ok := cfg.ExtGlobal().ConfigVal("", "", key)
+			if old, isAlias := quotaAliases[p]; !ok && isAlias {
+				key = "query_quota_" + old
+				val, ok = cfg.ExtGlobal().ConfigVal("", "", key)
+			}
+			if !ok {
+				continue
+			}
+			if quotas[p], err = strconv.Atoi(val); err != nil {
+				err = fmt.Errorf("failed to parse %s: %v", key, err)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	parsed := make(map[string]rate, len(rates))
+	for key, val := range rates {
+		if parsed[key], err = parseRate(val); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", key, err)
+		}
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	l.user = parsed["query_rate_user"]
+	l.channel = parsed["query_rate_channel"]
+	l.provider = parsed["query_rate_provider"]
+	l.quotas = quotas
+	return nil
+}
+
+// allow checks the user's, channel's and provider's buckets and takes a
+// token from each if they all have one. If not it returns how long to wait
+// and whether the user should be told, which is only once per wait.
+// Private messages have an empty channel and skip that bucket.
+func (l *limiter) allow(network, user, channel, provider string) (ok bool, wait time.Duration, warn bool) {
+	now := time.Now()
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	type check struct {
+		key  string
+		rate rate
+	}
+	checks := []check{
+		{"u " + strings.ToLower(network+" "+user), l.user},
+		{"p " + provider, l.provider},
+	}
+	if len(channel) != 0 {
+		checks = append(checks, check{"c " + strings.ToLower(network+" "+channel), l.channel})
+	}
+
+	for _, c := range checks {
+		b, ok := l.buckets[c.key]
+		if !ok {
+			b = &bucket{tokens: c.rate.burst, last: now}
+			l.buckets[c.key] = b
+		}
+		if w := b.fill(c.rate, now); w > wait {
+			wait = w
+		}
+	}
+
+	if wait > 0 {
+		userBucket := l.buckets[checks[0].key]
+		if now.Before(userBucket.warned) {
+			return false, wait, false
+		}
+		userBucket.warned = now.Add(wait)
+		return false, wait, true
+	}
+
+	for _, c := range checks {
+		l.buckets[c.key].tokens--
+	}
+	l.prune(now)
+	return true, 0, false
+}
+
+// prune drops full buckets that haven't been used in a while, since they're
+// the same as a new one. It must be called with mut held.
+func (l *limiter) prune(now time.Time) {
+	if len(l.buckets) < 1000 {
+		return
+	}
+
+	longest := l.user.period
+	for _, r := range []rate{l.channel, l.provider} {
+		if r.period > longest {
+			longest = r.period
+		}
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > longest {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// load today's usage so a restart doesn't hand out the quotas again, and
+// start writing it out every flushInterval.
+func (l *limiter) load() error {
+	file := defaultUsageFile
+	l.b.ReadConfig(func(cfg *config.Config) {
+		if val, ok := cfg.ExtGlobal().ConfigVal("", "", "query_usage_file"); ok {
+			file = val
+		}
+	})
+
+	var u dailyUsage
+	buf, err := os.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(buf, &u)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read query usage from %s: %v", file, err)
+	}
+
+	l.mut.Lock()
+	l.file = file
+	l.rollover()
+	if u.Day == l.day && u.Used != nil {
+		l.used = u.Used
+		l.dirty = false
+	}
+	l.mut.Unlock()
+
+	go l.run()
+	return nil
+}
+
+func (l *limiter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.flush()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// stop writing the usage out on a timer and write it one last time.
+func (l *limiter) stop() {
+	close(l.done)
+	l.flush()
+}
+
+// spend one of the provider's daily calls, it's an error if they're used up.
+// Only calls that reach the provider are spent, cached results are free.
+func (l *limiter) spend(provider string) error {
+	l.mut.Lock()
+	rolled := l.rollover()
+	quota := l.quotas[provider]
+	if quota > 0 && l.used[provider] >= quota {
+		l.mut.Unlock()
+		return fmt.Errorf("%s has used up its %d queries for today, try again tomorrow (UTC)", provider, quota)
+	}
+	l.used[provider]++
+	l.dirty = true
+	l.mut.Unlock()
+
+	if rolled {
+		l.flush()
+	}
+	return nil
+}
+
+// flush writes the day's usage to file if it changed. The write happens
+// outside of mut so queries don't wait on the disk.
+func (l *limiter) flush() {
+	l.flushing.Lock()
+	defer l.flushing.Unlock()
+
+	l.mut.Lock()
+	if !l.dirty || len(l.file) == 0 {
+		l.mut.Unlock()
+		return
+	}
+	file := l.file
+	u := dailyUsage{Day: l.day, Used: make(map[string]int, len(l.used))}
+	for p, n := range l.used {
+		u.Used[p] = n
+	}
+	l.dirty = false
+	l.mut.Unlock()
+
+	if err := writeUsage(file, u); err != nil {
+		l.b.Logger.Error("failed to save query quota usage", "file", file, "err", err)
+
+		l.mut.Lock()
+		l.dirty = true
+		l.mut.Unlock()
+	}
+}
+
+// writeUsage replaces file with u, through a temporary file so a crash
+// doesn't leave half of it behind.
+func writeUsage(file string, u dailyUsage) error {
+	buf, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// usage reports the calls made to each provider today.
+func (l *limiter) usage() string {
+	l.mut.Lock()
+	rolled := l.rollover()
+	var parts []string
+	for _, p := range ProviderNames("") {
+		used := l.used[p]
+		if quota := l.quotas[p]; quota > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d/%d", p, used, quota))
+		} else if used != 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", p, used))
+		}
+	}
+	l.mut.Unlock()
+
+	if rolled {
+		l.flush()
+	}
+	if len(parts) == 0 {
+		return "no queries today"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// rollover starts the counts over on a new day (UTC), returning true if it
+// did. The new day needs flushing. It must be called with mut held.
+func (l *limiter) rollover() bool {
+	today := time.Now().UTC().Format("2006-01-02")
+	if l.day == today {
+		return false
+	}
+	l.day = today
+	l.used = make(map[string]int)
+	l.dirty = true
+	return true
+}
@@ -0,0 +1,156 @@
+package queryer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/internal/testbot"
+)
+
+// newTestBot makes a bot with a store. It's made in a temporary directory
+// since queryer reads query.toml from the working directory when the bot
+// starts it.
+func newTestBot(t *testing.T, ext string) *bot.Bot {
+	t.Helper()
+	inTempDir(t)
+	return testbot.New(t, ext)
+}
+
+// newStorelessBot makes a bot like newTestBot but without a store.
+func newStorelessBot(t *testing.T, ext string) *bot.Bot {
+	t.Helper()
+	inTempDir(t)
+	return testbot.NewStoreless(t, ext)
+}
+
+// inTempDir runs the rest of the test in a temporary directory with an empty
+// query.toml.
+func inTempDir(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err = os.WriteFile(queryFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimiterQuotaAliases(t *testing.T) {
+	b := newTestBot(t, `query_quota_yr = "3"
+query_quota_shorten = "4"
+query_quota_isgd = "5"`)
+
+	l := newLimiter(b)
+	if err := l.configure(b); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.quotas["metno"]; got != 3 {
+		t.Errorf("want metno's quota from the old yr key to be 3, got %d", got)
+	}
+	if got := l.quotas["isgd"]; got != 5 {
+		t.Errorf("want isgd's own key to win over the old one, got %d", got)
+	}
+}
+
+func TestLimiterUsageSurvivesRestart(t *testing.T) {
+	b := newTestBot(t, `query_quota_google = "2"`)
+
+	l := newLimiter(b)
+	if err := l.configure(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.load(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := l.spend("google"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(defaultUsageFile); !os.IsNotExist(err) {
+		t.Errorf("spending shouldn't write the usage out, got %v", err)
+	}
+	l.stop()
+
+	restarted := newLimiter(b)
+	if err := restarted.configure(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.load(); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.stop()
+	if err := restarted.spend("google"); err == nil {
+		t.Error("the quota should still be used up after a restart")
+	}
+	if err := restarted.spend("bing"); err != nil {
+		t.Errorf("other providers shouldn't be limited: %v", err)
+	}
+}
+
+func TestLimiterFlush(t *testing.T) {
+	b := newStorelessBot(t, `query_usage_file = "usage.json"`)
+
+	l := newLimiter(b)
+	if err := l.load(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.stop()
+
+	read := func() (u dailyUsage) {
+		t.Helper()
+		buf, err := os.ReadFile("usage.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal(buf, &u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	l.spend("google")
+	l.flush()
+	today := l.day
+	if u := read(); u.Day != today || u.Used["google"] != 1 {
+		t.Errorf("want 1 google query today, got %+v", u)
+	}
+
+	// A day that's over is written out as soon as the next one starts.
+	l.mut.Lock()
+	l.day = "2000-01-01"
+	l.used["google"] = 9
+	l.mut.Unlock()
+
+	l.spend("bing")
+	if u := read(); u.Day != today || u.Used["google"] != 0 || u.Used["bing"] != 1 {
+		t.Errorf("want the new day written on rollover, got %+v", u)
+	}
+}
+
+func TestLimitedWithoutStore(t *testing.T) {
+	b := newStorelessBot(t, "")
+
+	q := Queryer{b: b, limit: newLimiter(b)}
+	if err := q.limit.configure(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	ev := &cmd.Event{Event: irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG,
+		"nick!user@host", "#chan", ".google uq")}
+	if q.limited(irc.Helper{Writer: &out}, ev, "google") {
+		t.Errorf("the first query shouldn't be limited, got %q", out.String())
+	}
+}
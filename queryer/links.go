@@ -0,0 +1,72 @@
+package queryer
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ircmsg"
+	"github.com/aarondl/uq/preview"
+	"github.com/aarondl/uq/settings"
+)
+
+// maxPreviewLinks is how many links are previewed from a single line.
+const maxPreviewLinks = 2
+
+// links previews the pages linked in channels that have turned it on.
+type links struct {
+	q       *Queryer
+	fetcher *preview.Fetcher
+}
+
+// Handle previews links, failures are only logged like youtube's.
+func (l links) Handle(w irc.Writer, ev *irc.Event) {
+	if !ev.IsTargetChan() {
+		return
+	}
+
+	q := l.q
+	network, channel := ev.NetworkID, ev.Target()
+	if !settings.Bool(q.b, network, channel, "queryer", "links") {
+		return
+	}
+	window := settings.Duration(q.b, network, channel, "queryer", "links_dedupe")
+	youtube := settings.Bool(q.b, network, channel, "queryer", "youtube")
+	github := settings.Bool(q.b, network, channel, "queryer", "github")
+
+	shown := 0
+	for _, link := range preview.Links(ev.Message()) {
+		if shown == maxPreviewLinks {
+			break
+		}
+		if youtube && isYoutube(link) {
+			continue
+		}
+		if github && rgxGithubLink.MatchString(link) {
+			continue
+		}
+		if q.seen.has(network, channel, link) {
+			continue
+		}
+		shown++
+
+		summary, err := l.fetcher.Summary(context.Background(), link)
+		if err != nil {
+			q.b.Logger.Debug("link preview failed", "link", link, "err", err)
+			continue
+		}
+		q.seen.mark(network, channel, link, window)
+		ircmsg.Privmsg(q.b, w, network, channel, "\x02Link:\x02 "+sanitize(summary))
+	}
+}
+
+func isYoutube(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	return host == "youtube.com" || host == "youtu.be"
+}
@@ -0,0 +1,175 @@
+package queryer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/query"
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/internal/testbot"
+	"github.com/aarondl/uq/preview"
+	"github.com/aarondl/uq/settings"
+)
+
+func TestLinksMarkedOnlyWhenShown(t *testing.T) {
+	b := newTestBot(t, "")
+	if err := settings.Set(b, "test", "#chan", "queryer", "links", "true"); err != nil {
+		t.Fatal(err)
+	}
+	testbot.Welcome(b, "test")
+
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<title>Page</title>")
+	}))
+	defer srv.Close()
+
+	newFetcher := func() *preview.Fetcher {
+		f := preview.New()
+		f.AllowPrivate = true
+		return f
+	}
+	l := links{q: &Queryer{b: b, seen: newRecently()}, fetcher: newFetcher()}
+
+	post := func() string {
+		var out bytes.Buffer
+		l.Handle(irc.Helper{Writer: &out}, irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG,
+			"nick!user@host", "#chan", "look "+srv.URL+"/page"))
+		return out.String()
+	}
+
+	if out := post(); len(out) != 0 {
+		t.Errorf("want nothing shown when the preview fails, got %q", out)
+	}
+	if l.q.seen.has("test", "#chan", srv.URL+"/page") {
+		t.Error("a link that failed to preview shouldn't be marked as shown")
+	}
+
+	// The fetcher holds on to the failure for a while, start over with a new one.
+	fail = false
+	l.fetcher = newFetcher()
+	if out := post(); !strings.Contains(out, "Page") {
+		t.Errorf("want the link previewed after a failure, got %q", out)
+	}
+	if out := post(); len(out) != 0 {
+		t.Errorf("want the link shown once within the window, got %q", out)
+	}
+}
+
+// withProviders replaces the loaded providers until the test ends.
+func withProviders(t *testing.T, providers map[string]Provider) {
+	t.Helper()
+
+	providerMut.Lock()
+	old := providerSet
+	providerSet = providers
+	providerMut.Unlock()
+	t.Cleanup(func() {
+		providerMut.Lock()
+		providerSet = old
+		providerMut.Unlock()
+	})
+}
+
+// newLimitedQueryer makes a Queryer with a cache and the rate limits from
+// b's config.
+func newLimitedQueryer(t *testing.T, b *bot.Bot) *Queryer {
+	t.Helper()
+
+	q := &Queryer{b: b, seen: newRecently(), cache: newCache(defaultCacheSize, defaultTTLs)}
+	q.limit = newLimiter(b)
+	if err := q.limit.configure(b); err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// countingVideos answers every video lookup and counts them.
+type countingVideos struct {
+	calls *int
+}
+
+func (c countingVideos) Query(ctx context.Context, id string) (string, error) {
+	*c.calls++
+	return "video " + id, nil
+}
+
+func TestYoutubeLimitedQuietly(t *testing.T) {
+	b := newTestBot(t, `query_rate_user = "1/1h"`)
+	if err := settings.Set(b, "test", "#chan", "queryer", "youtube", "true"); err != nil {
+		t.Fatal(err)
+	}
+	testbot.Welcome(b, "test")
+
+	var calls int
+	withProviders(t, map[string]Provider{"youtube": countingVideos{calls: &calls}})
+	q := newLimitedQueryer(t, b)
+
+	post := func(id string) string {
+		var out bytes.Buffer
+		q.Handle(irc.Helper{Writer: &out}, irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG,
+			"nick!user@host", "#chan", "https://youtu.be/"+id))
+		return out.String()
+	}
+
+	if out := post("first"); !strings.Contains(out, "video first") {
+		t.Errorf("want the video shown, got %q", out)
+	}
+	if out := post("second"); len(out) != 0 {
+		t.Errorf("want nothing sent to anyone when limited, got %q", out)
+	}
+	if calls != 1 {
+		t.Errorf("want only the first video looked up, got %d lookups", calls)
+	}
+}
+
+func TestGithubLinksLimitedQuietly(t *testing.T) {
+	b := newTestBot(t, `query_rate_user = "1/1h"`)
+	if err := settings.Set(b, "test", "#chan", "queryer", "github", "true"); err != nil {
+		t.Fatal(err)
+	}
+	testbot.Welcome(b, "test")
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.WriteString(w, `{"title":"Issue","state":"open","user":{"login":"someone"}}`)
+	}))
+	defer srv.Close()
+
+	withProviders(t, map[string]Provider{"github": newGithub(ProviderConfig{
+		Keys:    &query.Config{},
+		Client:  srv.Client(),
+		Options: map[string]string{"base_url": srv.URL},
+	})})
+	g := githubLinkHandler{q: newLimitedQueryer(t, b)}
+
+	post := func(number int) string {
+		var out bytes.Buffer
+		g.Handle(irc.Helper{Writer: &out}, irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG,
+			"nick!user@host", "#chan", fmt.Sprintf("https://github.com/a/b/issues/%d", number)))
+		return out.String()
+	}
+
+	if out := post(1); !strings.Contains(out, "Issue") {
+		t.Errorf("want the issue shown, got %q", out)
+	}
+	if out := post(2); len(out) != 0 {
+		t.Errorf("want nothing sent to anyone when limited, got %q", out)
+	}
+	if calls != 1 {
+		t.Errorf("want only the first issue looked up, got %d lookups", calls)
+	}
+}
@@ -0,0 +1,238 @@
+package queryer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ircmsg"
+)
+
+const (
+	// searchResults is how many results are kept for next to page through.
+	searchResults = 10
+	// maxShown is the most results shown at once with -n or next count.
+	maxShown = 5
+	// pageTTL is how long after a search next still works.
+	pageTTL = 30 * time.Minute
+)
+
+// searched is what a search caches.
+type searched struct {
+	Total   string   `json:"total"`
+	Results []Result `json:"results"`
+}
+
+// page is a user's last search and how far through it they are.
+type page struct {
+	label   string
+	total   string
+	results []Result
+	next    int
+	at      time.Time
+}
+
+// pages remembers each user's last search in each channel.
+type pages struct {
+	mut  sync.Mutex
+	last map[string]*page
+}
+
+func newPages() *pages {
+	return &pages{last: make(map[string]*page)}
+}
+
+// pageKey is a user's key in a channel, private messages have no channel.
+func pageKey(ev *cmd.Event) string {
+	var channel string
+	if ev.IsTargetChan() {
+		channel = ev.Target()
+	}
+	return strings.ToLower(ev.NetworkID + " " + channel + " " + ev.Username() + "@" + ev.Hostname())
+}
+
+func (p *pages) put(key string, pg *page) {
+	now := time.Now()
+	pg.at = now
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	for k, old := range p.last {
+		if now.Sub(old.at) > pageTTL {
+			delete(p.last, k)
+		}
+	}
+	p.last[key] = pg
+}
+
+// take the next n results of the user's search, pg.next is the position after
+// the last of them. ok is false if there's no search to page through.
+func (p *pages) take(key string, n int) (pg page, shown []Result, ok bool) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	last, ok := p.last[key]
+	if !ok || time.Since(last.at) > pageTTL {
+		delete(p.last, key)
+		return page{}, nil, false
+	}
+
+	from := last.next
+	last.next = from + n
+	if last.next > len(last.results) {
+		last.next = len(last.results)
+	}
+	return *last, last.results[from:last.next], true
+}
+
+// search asks a provider for its top results and shows the first of them, or
+// the first few with -n. Providers that can't return more than one result are
+// just asked.
+func (q Queryer) search(w irc.Writer, ev *cmd.Event, command, kind, name, args string) error {
+	nick := ev.Nick()
+	n, query, ok := parseCount(args)
+	if !ok {
+		w.Noticef(nick, "\x02Query:\x02 Usage: %s [-n count] query", command)
+		return nil
+	}
+
+	p, ok := q.provider(w, ev, kind, name)
+	if !ok {
+		return nil
+	}
+	s, ok := p.(Searcher)
+	if !ok {
+		return q.ask(w, ev, command, kind, name, query, 0)
+	}
+
+	out, ok, err := q.fetch(w, ev, command, name, query, p, func(ctx context.Context) (string, error) {
+		results, total, err := s.Search(ctx, query, searchResults)
+		if err != nil || len(results) == 0 {
+			return "", err
+		}
+		js, err := json.Marshal(searched{Total: total, Results: results})
+		return string(js), err
+	})
+	switch {
+	case !ok:
+		return nil
+	case err != nil:
+		w.Notice(nick, err.Error())
+		return nil
+	}
+
+	label := strings.ToUpper(name[:1]) + name[1:]
+	if len(out) == 0 {
+		ircmsg.Notify(q.b, w, ev.Event, nick, "\x02"+label+":\x02 No results found.")
+		return nil
+	}
+
+	var found searched
+	if err := json.Unmarshal([]byte(out), &found); err != nil {
+		return err
+	}
+
+	key := pageKey(ev)
+	q.pages.put(key, &page{label: label, total: found.Total, results: found.Results})
+	q.showPage(w, ev, key, n)
+	return nil
+}
+
+// Next shows the next results of the user's last search.
+func (q Queryer) Next(w irc.Writer, ev *cmd.Event) error {
+	n := 1
+	if arg := ev.Args["count"]; len(arg) != 0 {
+		var err error
+		if n, err = strconv.Atoi(arg); err != nil || n <= 0 {
+			w.Notice(ev.Nick(), "\x02Query:\x02 Count must be a positive number.")
+			return nil
+		}
+	}
+
+	q.showPage(w, ev, pageKey(ev), n)
+	return nil
+}
+
+// More is another name for next.
+func (q Queryer) More(w irc.Writer, ev *cmd.Event) error {
+	return q.Next(w, ev)
+}
+
+// showPage shows the user's next n results, one result is shown in full and
+// more than that compactly on a line each.
+func (q Queryer) showPage(w irc.Writer, ev *cmd.Event, key string, n int) {
+	nick := ev.Nick()
+	if n > maxShown {
+		n = maxShown
+	}
+
+	pg, shown, ok := q.pages.take(key, n)
+	switch {
+	case !ok:
+		w.Notice(nick, "\x02Query:\x02 There's no search to page through, search for something first.")
+		return
+	case len(shown) == 0:
+		w.Noticef(nick, "\x02%s:\x02 No more results, that was all %d.", pg.label, len(pg.results))
+		return
+	}
+
+	from, of := pg.next-len(shown), len(pg.results)
+	if len(shown) == 1 {
+		r := shown[0]
+		header := fmt.Sprintf("%d/%d", from+1, of)
+		if from == 0 && len(pg.total) != 0 {
+			header += ", " + pg.total
+		}
+		ircmsg.Notify(q.b, w, ev.Event, nick,
+			sanitize(fmt.Sprintf("\x02%s (\x02%s\x02):\x02 %s - %s", pg.label, header, r.URL, r.Snippet)))
+		return
+	}
+
+	for i, r := range shown {
+		title := r.Title
+		if len(title) == 0 {
+			title = r.Snippet
+		}
+		ircmsg.NotifyN(q.b, w, ev.Event, nick,
+			sanitize(fmt.Sprintf("\x02%s %d/%d:\x02 %s - %s", pg.label, from+i+1, of, title, r.URL)), 1)
+	}
+}
+
+// parseCount takes -n count, or -ncount, off the front of a query. count is
+// 1 if it's not given.
+func parseCount(args string) (int, string, bool) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return 0, "", false
+	}
+
+	var count string
+	var rest []string
+	switch {
+	case fields[0] == "-n" && len(fields) > 1:
+		count, rest = fields[1], fields[2:]
+	case fields[0] == "-n":
+		return 0, "", false
+	case strings.HasPrefix(fields[0], "-n"):
+		// Searching for -nothing shouldn't be an error.
+		if _, err := strconv.Atoi(fields[0][2:]); err != nil {
+			return 1, args, true
+		}
+		count, rest = fields[0][2:], fields[1:]
+	default:
+		return 1, args, true
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 || len(rest) == 0 {
+		return 0, "", false
+	}
+	return n, strings.Join(rest, " "), true
+}
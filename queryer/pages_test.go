@@ -0,0 +1,70 @@
+package queryer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args  string
+		n     int
+		query string
+		ok    bool
+	}{
+		{"golang", 1, "golang", true},
+		{"go lang", 1, "go lang", true},
+		{"-n 3 go lang", 3, "go lang", true},
+		{"-n3 go  lang", 3, "go lang", true},
+		{"-nothing to see", 1, "-nothing to see", true},
+		{"go -n 3", 1, "go -n 3", true},
+		{"", 0, "", false},
+		{"   ", 0, "", false},
+		{"-n", 0, "", false},
+		{"-n 3", 0, "", false},
+		{"-n3", 0, "", false},
+		{"-n x golang", 0, "", false},
+		{"-n 0 golang", 0, "", false},
+		{"-n -2 golang", 0, "", false},
+		{"-n0 golang", 0, "", false},
+	}
+
+	for _, test := range tests {
+		n, query, ok := parseCount(test.args)
+		if n != test.n || query != test.query || ok != test.ok {
+			t.Errorf("%q: want %d %q %v, got %d %q %v", test.args,
+				test.n, test.query, test.ok, n, query, ok)
+		}
+	}
+}
+
+func TestPagesTake(t *testing.T) {
+	t.Parallel()
+
+	p := newPages()
+	results := []Result{{URL: "1"}, {URL: "2"}, {URL: "3"}}
+	p.put("key", &page{label: "Google", results: results, next: 1})
+
+	if _, _, ok := p.take("other", 1); ok {
+		t.Error("want nothing for a user who hasn't searched")
+	}
+
+	pg, shown, ok := p.take("key", 1)
+	if !ok || len(shown) != 1 || shown[0].URL != "2" || pg.next != 2 {
+		t.Errorf("want the second result, got %v %v next %d", shown, ok, pg.next)
+	}
+	pg, shown, ok = p.take("key", 5)
+	if !ok || len(shown) != 1 || shown[0].URL != "3" || pg.next != 3 {
+		t.Errorf("want only the last result, got %v %v next %d", shown, ok, pg.next)
+	}
+	if _, shown, ok = p.take("key", 1); !ok || len(shown) != 0 {
+		t.Errorf("want no more results, got %v %v", shown, ok)
+	}
+
+	p.last["key"].at = time.Now().Add(-pageTTL - time.Second)
+	if _, _, ok = p.take("key", 1); ok {
+		t.Error("want nothing after the search has expired")
+	}
+}
@@ -0,0 +1,232 @@
+package queryer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/aarondl/query"
+)
+
+// The kinds of provider, a channel picks one provider of each kind with the
+// queryer.<kind> setting.
+const (
+	KindSearch    = "search"
+	KindCalc      = "calc"
+	KindWeather   = "weather"
+	KindShorten   = "shorten"
+	KindStars     = "stars"
+	KindTranslate = "translate"
+	KindDefine    = "define"
+	KindUrban     = "urban"
+	// KindVideo providers look up the videos linked in channels, there's no
+	// setting to choose one.
+	KindVideo = "video"
+)
+
+const (
+	providerTimeout = 10 * time.Second
+	userAgent       = "uq-queryer/1.0 (irc bot)"
+	// maxResponse is the most of a provider's response that's read.
+	maxResponse = 1 << 20
+)
+
+// Provider answers queries for one of the commands.
+type Provider interface {
+	// Query returns the line to show for the query. A provider with nothing
+	// to say returns an empty string.
+	Query(ctx context.Context, query string) (string, error)
+}
+
+// Uncached is implemented by providers whose answers shouldn't be cached,
+// like ones that are free to ask or answer differently every time.
+type Uncached interface {
+	Uncached() bool
+}
+
+// Result is one of a search's results.
+type Result struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+}
+
+// Searcher is implemented by search providers that can return more than one
+// result, the next command pages through them.
+type Searcher interface {
+	// Search returns the top n results, and the total number of results
+	// if the provider knows it.
+	Search(ctx context.Context, query string, n int) (results []Result, total string, err error)
+}
+
+type requesterKey struct{}
+
+// Requester is the nick!user@host of the user that made the query.
+func Requester(ctx context.Context) string {
+	who, _ := ctx.Value(requesterKey{}).(string)
+	return who
+}
+
+// ProviderConfig is what a provider is made with.
+type ProviderConfig struct {
+	// Keys are the api keys from query.toml.
+	Keys   *query.Config
+	Client *http.Client
+	// Options are the provider's table in query.toml, [providers.<name>],
+	// base_url in there points the provider at a different server.
+	Options map[string]string
+}
+
+// Option returns the provider's option or def if it isn't set.
+func (p ProviderConfig) Option(key, def string) string {
+	if val, ok := p.Options[key]; ok && len(val) != 0 {
+		return val
+	}
+	return def
+}
+
+// BaseURL returns the base_url option or def, without a trailing slash.
+func (p ProviderConfig) BaseURL(def string) string {
+	return strings.TrimRight(p.Option("base_url", def), "/")
+}
+
+// ProviderFactory makes a provider, it's called again whenever query.toml is
+// reloaded.
+type ProviderFactory func(cfg ProviderConfig) Provider
+
+type providerEntry struct {
+	kind    string
+	factory ProviderFactory
+}
+
+var (
+	providerMut sync.RWMutex
+	// providerFactories starts with the built in providers so they're there
+	// before any init that lists them.
+	providerFactories = map[string]providerEntry{
+		"google":          {kind: KindSearch, factory: newGoogle},
+		"bing":            {kind: KindSearch, factory: newBing},
+		"wolfram":         {kind: KindCalc, factory: newWolfram},
+		"metno":           {kind: KindWeather, factory: newMetno},
+		"isgd":            {kind: KindShorten, factory: newIsgd},
+		"github":          {kind: KindStars, factory: newGithub},
+		"libretranslate":  {kind: KindTranslate, factory: newLibretranslate},
+		"dictionary":      {kind: KindDefine, factory: newDictionary},
+		"urbandictionary": {kind: KindUrban, factory: newUrban},
+		"youtube":         {kind: KindVideo, factory: newYoutube},
+	}
+	providerSet = make(map[string]Provider)
+)
+
+// RegisterProvider adds a provider that channels can choose for the kind.
+// Names are shared between kinds and it panics if one is used twice. It
+// must be called before the extension is loaded, typically in init.
+func RegisterProvider(kind, name string, factory ProviderFactory) {
+	name = strings.ToLower(name)
+
+	providerMut.Lock()
+	defer providerMut.Unlock()
+
+	if _, ok := providerFactories[name]; ok {
+		panic(fmt.Sprintf("queryer: provider %s registered twice", name))
+	}
+	providerFactories[name] = providerEntry{kind: kind, factory: factory}
+}
+
+// ProviderNames lists the providers of a kind, or all of them if kind is
+// empty.
+func ProviderNames(kind string) []string {
+	providerMut.RLock()
+	defer providerMut.RUnlock()
+
+	var names []string
+	for name, entry := range providerFactories {
+		if len(kind) == 0 || entry.kind == kind {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getProvider returns the provider by name if it's of the kind.
+func getProvider(kind, name string) (Provider, bool) {
+	name = strings.ToLower(name)
+
+	providerMut.RLock()
+	defer providerMut.RUnlock()
+
+	if providerFactories[name].kind != kind {
+		return nil, false
+	}
+	p, ok := providerSet[name]
+	return p, ok
+}
+
+// loadProviders makes every provider from query.toml's [providers] tables.
+func loadProviders(file string, keys *query.Config) error {
+	var conf struct {
+		Providers map[string]map[string]string `toml:"providers"`
+	}
+	if _, err := toml.DecodeFile(file, &conf); err != nil {
+		return fmt.Errorf("failed to read providers from %s: %v", file, err)
+	}
+
+	client := &http.Client{Timeout: providerTimeout}
+
+	providerMut.Lock()
+	defer providerMut.Unlock()
+
+	set := make(map[string]Provider, len(providerFactories))
+	for name, entry := range providerFactories {
+		set[name] = entry.factory(ProviderConfig{
+			Keys:    keys,
+			Client:  client,
+			Options: conf.Providers[name],
+		})
+	}
+	providerSet = set
+	return nil
+}
+
+// statusError is returned when a provider responds with something other than
+// 200 OK.
+type statusError struct {
+	name   string
+	status int
+}
+
+func (s statusError) Error() string {
+	return fmt.Sprintf("%s returned status: %d", s.name, s.status)
+}
+
+// getJSON does a request and decodes the json response into v. Statuses
+// other than 200 are statusErrors.
+func getJSON(ctx context.Context, client *http.Client, name string, req *http.Request, v interface{}) error {
+	resp, err := do(ctx, client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError{name: name, status: resp.StatusCode}
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(v)
+}
+
+func do(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	req = req.WithContext(ctx)
+	if len(req.Header.Get("User-Agent")) == 0 {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	return client.Do(req)
+}
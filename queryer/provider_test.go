@@ -0,0 +1,295 @@
+package queryer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/query"
+)
+
+// fakeAPI points a provider at handler with keys for every service.
+func fakeAPI(t *testing.T, handler http.HandlerFunc) ProviderConfig {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	return ProviderConfig{
+		Keys: &query.Config{
+			GoogleSearchAPIKey: "gkey",
+			GoogleSearchCXID:   "gcx",
+			BingAPIKey:         "bkey",
+			WolframID:          "wid",
+			GoogleYoutubeKey:   "ykey",
+		},
+		Client:  srv.Client(),
+		Options: map[string]string{"base_url": srv.URL + "/"},
+	}
+}
+
+// reply answers every request with body after checking the path and query.
+func reply(t *testing.T, path string, params map[string]string, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("want path %s, got %s", path, r.URL.Path)
+		}
+		for k, want := range params {
+			if got := r.URL.Query().Get(k); got != want {
+				t.Errorf("want %s=%q, got %q", k, want, got)
+			}
+		}
+		io.WriteString(w, body)
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	t.Parallel()
+
+	cfg := ProviderConfig{}
+	if got := cfg.BaseURL("https://a.test"); got != "https://a.test" {
+		t.Errorf("want the default without base_url, got %s", got)
+	}
+
+	cfg.Options = map[string]string{"base_url": "http://b.test//"}
+	if got := cfg.BaseURL("https://a.test"); got != "http://b.test" {
+		t.Errorf("want base_url without trailing slashes, got %s", got)
+	}
+}
+
+func TestGoogle(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, reply(t, "/customsearch/v1",
+		map[string]string{"cx": "gcx", "key": "gkey", "q": "golang", "num": "1"},
+		`{"items":[{"title":"Go","link":"https://go.dev","snippet":"The Go language"}],
+			"searchInformation":{"formattedTotalResults":"1,234"}}`))
+
+	out, err := newGoogle(cfg).Query(context.Background(), "golang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02Google (\x021,234 results\x02):\x02 https://go.dev - The Go language"; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	cfg.Keys = &query.Config{}
+	if _, err = newGoogle(cfg).Query(context.Background(), "golang"); err == nil {
+		t.Error("want an error without keys")
+	}
+}
+
+func TestGoogleNoResults(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, reply(t, "/customsearch/v1", nil, `{}`))
+	out, err := newGoogle(cfg).Query(context.Background(), "nothing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02Google:\x02 No results found."; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+}
+
+func TestBing(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("Ocp-Apim-Subscription-Key"); key != "bkey" {
+			t.Errorf("want the key in the header, got %q", key)
+		}
+		reply(t, "/v7.0/search", map[string]string{"q": "golang", "count": "2"},
+			`{"webPages":{"totalEstimatedMatches":42,"value":[
+				{"name":"Go","url":"https://go.dev","snippet":"one"},
+				{"name":"Tour","url":"https://go.dev/tour","snippet":"two"},
+				{"name":"Extra","url":"https://go.dev/extra","snippet":"three"}]}}`)(w, r)
+	})
+
+	results, total, err := newBing(cfg).(Searcher).Search(context.Background(), "golang", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != "42 results" {
+		t.Errorf("want 42 results, got %s", total)
+	}
+	if len(results) != 2 || results[1].URL != "https://go.dev/tour" {
+		t.Errorf("want the first two results, got %v", results)
+	}
+}
+
+func TestBingVideos(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, reply(t, "/v7.0/search", nil,
+		`{"videos":{"value":[{"name":"Talk","description":"about go",
+			"contentUrl":"https://v.test/1","duration":"PT1M30S"}]}}`))
+
+	out, err := newBing(cfg).Query(context.Background(), "go talk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02Bing (\x021m30s\x02):\x02 https://v.test/1 - Talk - about go"; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+}
+
+func TestWolfram(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{
+			`<queryresult success="true" parsetiming="0.5">
+				<pod><subpod><plaintext>2+2</plaintext></subpod></pod>
+				<pod><subpod><plaintext>4</plaintext></subpod></pod>
+			</queryresult>`,
+			"\x02Wolfram (\x020.50ms\x02):\x02 2+2 \x02=>\x02 4",
+		},
+		{
+			`<queryresult success="true" parsetiming="1">
+				<pod><subpod><plaintext>thing</plaintext></subpod></pod>
+			</queryresult>`,
+			"\x02Wolfram (\x021.00ms\x02):\x02 thing \x02=>\x02 https://www.wolframalpha.com/input/?i=the+thing",
+		},
+		{
+			`<queryresult success="false" parsetiming="1">
+				<didyoumeans><didyoumean>the thing</didyoumean></didyoumeans>
+			</queryresult>`,
+			"\x02Wolfram (\x021.00ms\x02):\x02 Did you mean: the thing",
+		},
+		{
+			`<queryresult success="false" parsetiming="1"></queryresult>`,
+			"\x02Wolfram (\x021.00ms\x02):\x02 No results found.",
+		},
+	}
+
+	for _, test := range tests {
+		cfg := fakeAPI(t, reply(t, "/v2/query",
+			map[string]string{"appid": "wid", "input": "the thing"}, test.body))
+		out, err := newWolfram(cfg).Query(context.Background(), "the thing")
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if out != test.want {
+			t.Errorf("want %q, got %q", test.want, out)
+		}
+	}
+}
+
+func TestIsgd(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, reply(t, "/create.php",
+		map[string]string{"format": "json", "url": "https://go.dev"},
+		`{"shorturl":"https://is.gd/abc"}`))
+	out, err := newIsgd(cfg).Query(context.Background(), "https://go.dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02Shorten:\x02 https://is.gd/abc"; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	cfg = fakeAPI(t, reply(t, "/create.php", nil, `{"errormessage":"bad url"}`))
+	if _, err = newIsgd(cfg).Query(context.Background(), "nope"); err == nil || err.Error() != "is.gd: bad url" {
+		t.Errorf("want is.gd's error, got %v", err)
+	}
+}
+
+func TestProviderStatusError(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	for name, p := range map[string]Provider{
+		"google":  newGoogle(cfg),
+		"bing":    newBing(cfg),
+		"wolfram": newWolfram(cfg),
+		"isgd":    newIsgd(cfg),
+		"youtube": newYoutube(cfg),
+	} {
+		_, err := p.Query(context.Background(), "query")
+		var status statusError
+		if !errors.As(err, &status) || status.status != http.StatusTooManyRequests {
+			t.Errorf("%s: want a 429 statusError, got %v", name, err)
+		}
+	}
+}
+
+func TestGithubStars(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/aarondl/uq":
+			io.WriteString(w, `{"stargazers_count":42}`)
+		case r.URL.Path == "/users/aarondl/repos" && r.URL.Query().Get("page") == "1":
+			io.WriteString(w, "["+strings.Repeat(`{"stargazers_count":1},`, 99)+`{"stargazers_count":1}]`)
+		case r.URL.Path == "/users/aarondl/repos" && r.URL.Query().Get("page") == "2":
+			io.WriteString(w, `[{"stargazers_count":5}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	gh := newGithub(cfg)
+
+	tests := map[string]string{
+		"aarondl/uq":  "\x02Github stars (aarondl/uq):\x02 42",
+		"/AaronDL/":   "\x02Github stars (aarondl):\x02 105",
+		"nobody/here": "\x02Github stars:\x02 could not find nobody/here",
+	}
+	for query, want := range tests {
+		out, err := gh.Query(context.Background(), query)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", query, err)
+		} else if out != want {
+			t.Errorf("%s: want %q, got %q", query, want, out)
+		}
+	}
+}
+
+func TestYoutube(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/youtube/v3/videos" || r.URL.Query().Get("key") != "ykey" {
+			t.Errorf("want the videos api with the key, got %s", r.URL)
+		}
+		if r.URL.Query().Get("id") != "dQw4w9WgXcQ" {
+			io.WriteString(w, `{"items":[]}`)
+			return
+		}
+		io.WriteString(w, `{"items":[{
+			"snippet":{"title":"Song","channelTitle":"Rick","liveBroadcastContent":"none"},
+			"contentDetails":{"duration":"PT3M33S"},
+			"statistics":{"viewCount":"1234567"}}]}`)
+	})
+	yt := newYoutube(cfg)
+
+	out, err := yt.Query(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02YouTube (\x023m33s\x02):\x02 Song \x02Channel:\x02 Rick \x02Views:\x02 1,234,567"; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	if out, err = yt.Query(context.Background(), "missing"); err != nil || len(out) != 0 {
+		t.Errorf("want nothing for a missing video, got %q %v", out, err)
+	}
+
+	cfg.Keys = &query.Config{}
+	if _, err = newYoutube(cfg).Query(context.Background(), "dQw4w9WgXcQ"); err == nil {
+		t.Error("want an error without a key")
+	}
+}
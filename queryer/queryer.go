@@ -1,97 +1,301 @@
 package queryer
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aarondl/query"
 	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
 	"github.com/aarondl/ultimateq/dispatch/cmd"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/calc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
+	"github.com/aarondl/uq/preview"
+	"github.com/aarondl/uq/settings"
 )
 
+// queryFile holds the api keys and the [providers.<name>] tables.
+const queryFile = "query.toml"
+
 var (
 	sanitizeNewline = strings.NewReplacer("\r\n", " ", "\n", " ")
 	rgxSpace        = regexp.MustCompile(`\s{2,}`)
-	queryConf       *query.Config
+
+	confMut   sync.RWMutex
+	queryConf *query.Config
 )
 
 func init() {
-	bot.RegisterExtension("queryer", &Queryer{})
+	ext.RegisterExtension("queryer", &Queryer{})
+	settings.Define("queryer", settings.Option{
+		Name:    "youtube",
+		Type:    settings.BoolType,
+		Default: "false",
+		Desc:    "Show the title, length, channel and views of youtube links posted in the channel.",
+	}, settings.Option{
+		Name:    "youtube_dedupe",
+		Type:    settings.DurationType,
+		Default: "10m",
+		Desc:    "How long before the same youtube link is shown again in a channel.",
+	}, settings.Option{
+		Name:    "links",
+		Type:    settings.BoolType,
+		Default: "false",
+		Desc:    "Show the title of web pages linked in the channel.",
+	}, settings.Option{
+		Name:    "links_dedupe",
+		Type:    settings.DurationType,
+		Default: "10m",
+		Desc:    "How long before the same link is previewed again in a channel.",
+	}, settings.Option{
+		Name:    "github",
+		Type:    settings.BoolType,
+		Default: "true",
+		Desc:    "Show the title, state and author of github issues and pull requests linked in the channel.",
+	}, settings.Option{
+		Name:    "github_dedupe",
+		Type:    settings.DurationType,
+		Default: "10m",
+		Desc:    "How long before the same issue or pull request is shown again in a channel.",
+	}, settings.Option{
+		Name: "github_repo",
+		Desc: "The owner/repo that gh issue and gh pr use when given only a number.",
+	}, settings.Option{
+		Name:    "calc_local",
+		Type:    settings.BoolType,
+		Default: "true",
+		Desc:    "Work out arithmetic and unit conversions without asking the calc provider.",
+	}, settings.Option{
+		Name:    "units",
+		Default: string(Metric),
+		Desc:    "The units weather is shown in for users that haven't picked any, metric or imperial.",
+	}, providerOption(KindSearch, "google", "The search provider used by the search command."),
+		providerOption(KindCalc, "wolfram", "The provider used by the calc command for what it can't work out itself."),
+		providerOption(KindWeather, "metno", "The weather provider used by the weather command."),
+		providerOption(KindShorten, "uq", "The url shortener used by the shorten command."),
+		providerOption(KindStars, "github", "The provider used by the stars command."),
+		providerOption(KindTranslate, "libretranslate", "The translator used by the tr command."),
+		providerOption(KindDefine, "dictionary", "The dictionary used by the define command."),
+		providerOption(KindUrban, "urbandictionary", "The provider used by the urban command."),
+	)
+}
+
+// providerOption is the setting that picks a channel's provider of a kind.
+// The providers are listed when it's looked at since other extensions add
+// theirs after this is defined.
+func providerOption(kind, def, desc string) settings.Option {
+	return settings.Option{
+		Name:    kind,
+		Type:    settings.StringType,
+		Default: def,
+		Desc:    desc,
+		Describe: func() string {
+			return strings.TrimSuffix(desc, ".") + ", one of: " +
+				strings.Join(ProviderNames(kind), ", ") + "."
+		},
+	}
 }
 
 // Queryer allows for various HTTP queries to different servers.
 type Queryer struct {
+	b     *bot.Bot
+	seen  *recently
+	pages *pages
+
 	youtubeID       uint64
+	linksID         uint64
+	ghLinksID       uint64
 	googleHandlerID uint64
+	searchID        uint64
+	bingHandlerID   uint64
 	calcHandlerID   uint64
+	weatherID       uint64
 	yrID            uint64
 	shortenID       uint64
 	githubID        uint64
+	ghID            uint64
+	nextID          uint64
+	trID            uint64
+	defineID        uint64
+	urbanID         uint64
+	moreID          uint64
+	cacheStatsID    uint64
+	quotaID         uint64
+
+	cache *cache
+	limit *limiter
 }
 
 // Init the extension
 func (q *Queryer) Init(b *bot.Bot) error {
-	if conf := query.NewConfig("query.toml"); conf != nil {
-		queryConf = conf
-	} else {
-		return errors.New("error loading queryer configuration")
+	q.b = b
+	q.seen = newRecently()
+	q.pages = newPages()
+
+	if err := loadQueryConfig(); err != nil {
+		return err
+	}
+	size, ttls, err := cacheConfig(b)
+	if err != nil {
+		return err
+	}
+	q.cache = newCache(size, ttls)
+	q.limit = newLimiter(b)
+	if err = q.limit.configure(b); err != nil {
+		return err
+	}
+	if err = q.limit.load(); err != nil {
+		return err
 	}
 
-	var err error
-	q.youtubeID = b.Register("", "", irc.PRIVMSG, q)
-	q.googleHandlerID, err = b.RegisterCmd("", "", cmd.New(
+	// fail stops the limiter, which writes out the day's usage, when a
+	// command can't be registered.
+	fail := func(err error) error {
+		q.limit.stop()
+		return err
+	}
+
+	q.youtubeID = ext.RegisterNamed(b, "youtube", "", "", irc.PRIVMSG, q)
+	q.linksID = ext.RegisterNamed(b, "links", "", "", irc.PRIVMSG,
+		links{q: q, fetcher: preview.New()})
+	q.ghLinksID = ext.RegisterNamed(b, "github", "", "", irc.PRIVMSG, githubLinkHandler{q: q})
+	q.googleHandlerID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"query",
 		"google",
-		"Submits a query to Google.",
+		"Submits a query to Google, -n count shows that many results. "+
+			"See the rest with next.",
 		q,
 		cmd.Privmsg, cmd.AnyScope, "query...",
 	))
 	if err != nil {
-		return err
+		return fail(err)
+	}
+	q.searchID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"search",
+		"Submits a query to the channel's search provider, -n count shows "+
+			"that many results. See the rest with next.",
+		q,
+		cmd.Privmsg, cmd.AnyScope, "query...",
+	))
+	if err != nil {
+		return fail(err)
 	}
-	q.googleHandlerID, err = b.RegisterCmd("", "", cmd.New(
+	q.bingHandlerID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"query",
 		"bing",
-		"Submits a query to Bing.",
+		"Submits a query to Bing, -n count shows that many results. "+
+			"See the rest with next.",
 		q,
 		cmd.Privmsg, cmd.AnyScope, "query...",
 	))
 	if err != nil {
-		return err
+		return fail(err)
+	}
+	q.nextID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"next",
+		"Shows the next results of your last search.",
+		q,
+		cmd.Privmsg, cmd.AnyScope, "[count]",
+	))
+	if err != nil {
+		return fail(err)
 	}
-	q.calcHandlerID, err = b.RegisterCmd("", "", cmd.New(
+	q.moreID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"more",
+		"Another name for next.",
+		q,
+		cmd.Privmsg, cmd.AnyScope, "[count]",
+	))
+	if err != nil {
+		return fail(err)
+	}
+	q.calcHandlerID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"query",
 		"calc",
-		"Submits a query to Wolfram Alpha.",
+		"Works out arithmetic, hex and binary and unit conversions, like "+
+			"5 km to miles or 255 in hex. Anything else goes to the channel's "+
+			"calculator, Wolfram Alpha by default.",
 		q,
 		cmd.Privmsg, cmd.AnyScope, "query...",
 	))
 	if err != nil {
-		return err
+		return fail(err)
+	}
+	q.weatherID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"weather",
+		"Get the weather for a place, or the one saved with: weather set place. "+
+			"Also: weather forecast [days] [place], weather units metric|imperial.",
+		q,
+		cmd.Privmsg, cmd.AnyScope, "query...",
+	))
+	if err != nil {
+		return fail(err)
 	}
-	q.yrID, err = b.RegisterCmd("", "", cmd.New(
+	q.yrID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"query",
 		"yr",
-		"Get weather from norway based sources",
+		"Old name for the weather command.",
 		q,
 		cmd.Privmsg, cmd.AnyScope, "query...",
 	))
 	if err != nil {
-		return err
+		return fail(err)
 	}
-	q.shortenID, err = b.RegisterCmd("", "", cmd.New(
+	q.shortenID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"query",
 		"shorten",
-		"Shorten a URL with the goo.gl url shortener",
+		"Shorten a URL with the channel's url shortener. The bot's own "+
+			"shortener takes an expiry after the url, like 12h or 7d.",
 		q,
 		cmd.Privmsg, cmd.AnyScope, "query...",
 	))
 	if err != nil {
-		return err
+		return fail(err)
+	}
+	q.trID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"tr",
+		"Translate text, like: tr en hola or tr fr:de bonjour. The language "+
+			"it's from is guessed when it's left out.",
+		q,
+		cmd.Privmsg, cmd.AnyScope, "languages", "text...",
+	))
+	if err != nil {
+		return fail(err)
+	}
+	q.defineID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"define",
+		"Look a word up in the dictionary.",
+		q,
+		cmd.Privmsg, cmd.AnyScope, "word...",
+	))
+	if err != nil {
+		return fail(err)
 	}
-	q.githubID, err = b.RegisterCmd("", "", cmd.New(
+	q.urbanID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"urban",
+		"Look a term up on urban dictionary.",
+		q,
+		cmd.Privmsg, cmd.AnyScope, "term...",
+	))
+	if err != nil {
+		return fail(err)
+	}
+	q.githubID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"query",
 		"stars",
 		"Count the number of stars a user or repo has on github",
@@ -99,7 +303,38 @@ func (q *Queryer) Init(b *bot.Bot) error {
 		cmd.Privmsg, cmd.AnyScope, "userorrepo",
 	))
 	if err != nil {
-		return err
+		return fail(err)
+	}
+	q.ghID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"gh",
+		"Look up github things: gh issue owner/repo#123, gh pr owner/repo#123, "+
+			"gh release owner/repo or gh user name.",
+		q,
+		cmd.Privmsg, cmd.AnyScope, "what", "args...",
+	))
+	if err != nil {
+		return fail(err)
+	}
+	q.cacheStatsID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"cachestats",
+		"Shows how often query results come from the cache.",
+		q,
+		cmd.Privmsg, cmd.AnyScope,
+	))
+	if err != nil {
+		return fail(err)
+	}
+	q.quotaID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"query",
+		"quota",
+		"Shows how many queries each provider has made today.",
+		q,
+		cmd.Privmsg, cmd.AnyScope,
+	))
+	if err != nil {
+		return fail(err)
 	}
 
 	return nil
@@ -107,132 +342,362 @@ func (q *Queryer) Init(b *bot.Bot) error {
 
 // Deinit the extension
 func (q *Queryer) Deinit(b *bot.Bot) error {
-	b.Unregister(q.youtubeID)
-	b.UnregisterCmd(q.googleHandlerID)
-	b.UnregisterCmd(q.calcHandlerID)
-	b.UnregisterCmd(q.yrID)
-	b.UnregisterCmd(q.shortenID)
-	b.UnregisterCmd(q.githubID)
+	ext.Unregister(b, q.youtubeID)
+	ext.Unregister(b, q.linksID)
+	ext.Unregister(b, q.ghLinksID)
+	ext.UnregisterCmd(b, q.googleHandlerID)
+	ext.UnregisterCmd(b, q.searchID)
+	ext.UnregisterCmd(b, q.bingHandlerID)
+	ext.UnregisterCmd(b, q.nextID)
+	ext.UnregisterCmd(b, q.moreID)
+	ext.UnregisterCmd(b, q.calcHandlerID)
+	ext.UnregisterCmd(b, q.weatherID)
+	ext.UnregisterCmd(b, q.yrID)
+	ext.UnregisterCmd(b, q.shortenID)
+	ext.UnregisterCmd(b, q.trID)
+	ext.UnregisterCmd(b, q.defineID)
+	ext.UnregisterCmd(b, q.urbanID)
+	ext.UnregisterCmd(b, q.githubID)
+	ext.UnregisterCmd(b, q.ghID)
+	ext.UnregisterCmd(b, q.cacheStatsID)
+	ext.UnregisterCmd(b, q.quotaID)
+	q.limit.stop()
 	return nil
 }
 
+// Rehash reloads query.toml so API keys can be changed without a restart,
+// along with the cache settings and rate limits.
+func (q *Queryer) Rehash(b *bot.Bot) error {
+	if err := loadQueryConfig(); err != nil {
+		return err
+	}
+
+	size, ttls, err := cacheConfig(b)
+	if err != nil {
+		return err
+	}
+	q.cache.configure(size, ttls)
+	return q.limit.configure(b)
+}
+
+// cacheConfig reads query_cache_size and the query_cache_<cmd> ttls.
+func cacheConfig(b *bot.Bot) (int, map[string]time.Duration, error) {
+	size := defaultCacheSize
+	ttls := make(map[string]time.Duration, len(defaultTTLs))
+	for command, ttl := range defaultTTLs {
+		ttls[command] = ttl
+	}
+
+	var err error
+	b.ReadConfig(func(cfg *config.Config) {
+		if val, ok := cfg.ExtGlobal().ConfigVal("", "", "query_cache_size"); ok {
+			if size, err = strconv.Atoi(val); err != nil {
+				err = fmt.Errorf("failed to parse query_cache_size: %v", err)
+				return
+			}
+		}
+
+		for command := range ttls {
+			key := "query_cache_" + command
+			val, ok := cfg.ExtGlobal().ConfigVal("", "", key)
+			if !ok {
+				continue
+			}
+			if ttls[command], err = time.ParseDuration(val); err != nil {
+				err = fmt.Errorf("failed to parse %s: %v", key, err)
+				return
+			}
+		}
+	})
+
+	return size, ttls, err
+}
+
+func loadQueryConfig() error {
+	conf := query.NewConfig(queryFile)
+	if conf == nil {
+		return errors.New("error loading queryer configuration")
+	}
+	if err := loadProviders(queryFile, conf); err != nil {
+		return err
+	}
+
+	confMut.Lock()
+	queryConf = conf
+	confMut.Unlock()
+	return nil
+}
+
+// queryConfig returns the current query.toml configuration.
+func queryConfig() *query.Config {
+	confMut.RLock()
+	defer confMut.RUnlock()
+	return queryConf
+}
+
 // Cmd handler to satisfy the interface, but let reflection look up
 // all our methods.
 func (q Queryer) Cmd(string, irc.Writer, *cmd.Event) error {
 	return nil
 }
 
-// Handle traps youtube links
+// Handle expands youtube links in channels that have turned it on. Failures
+// are only logged since the person pasting the link didn't ask for anything.
 func (q Queryer) Handle(w irc.Writer, ev *irc.Event) {
 	if !ev.IsTargetChan() {
 		return
 	}
 
-	if out, err := query.YouTube(ev.Message(), queryConf); len(out) != 0 {
-		w.Privmsg(ev.Target(), out)
-	} else if err != nil {
-		nick := ev.Nick()
-		w.Notice(nick, err.Error())
+	network, channel := ev.NetworkID, ev.Target()
+	if !settings.Bool(q.b, network, channel, "queryer", "youtube") {
+		return
 	}
-}
+	window := settings.Duration(q.b, network, channel, "queryer", "youtube_dedupe")
 
-// Calc something using wolfram alpha
-func (Queryer) Calc(w irc.Writer, ev *cmd.Event) error {
-	q := ev.Args["query"]
-	nick := ev.Nick()
+	p, ok := getProvider(KindVideo, "youtube")
+	if !ok {
+		return
+	}
 
-	if out, err := query.Wolfram(q, queryConf); len(out) != 0 {
-		out = sanitize(out)
+	for _, id := range videoIDs(ev.Message()) {
+		if q.seen.has(network, channel, "youtube:"+id) {
+			continue
+		}
+		if ok, _, _ := q.allowed(ev, "youtube"); !ok {
+			return
+		}
 
-		// Ensure two lines only
-		// ircmaxlen - maxhostsize - PRIVMSG - targetsize - spacing - colons
-		maxlen := 2 * (510 - 62 - 7 - len(ev.Target()) - 3 - 2)
-		if len(out) > maxlen {
-			out = out[:maxlen-3]
-			out += "..."
+		id := id
+		out, err := q.cache.do("youtube", "youtube "+id, func() (string, error) {
+			if err := q.limit.spend("youtube"); err != nil {
+				return "", err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+			defer cancel()
+			return p.Query(ctx, id)
+		})
+		if err != nil {
+			q.b.Logger.Debug("youtube lookup failed", "id", id, "err", err)
+			continue
 		}
+		if len(out) != 0 {
+			q.seen.mark(network, channel, "youtube:"+id, window)
+			ircmsg.Privmsg(q.b, w, network, channel, out)
+		}
+	}
+}
 
-		w.Notify(ev.Event, nick, out)
-	} else if err != nil {
-		w.Notice(nick, err.Error())
+// Calc something locally, or with the channel's calc provider if it's not
+// just arithmetic
+func (q Queryer) Calc(w irc.Writer, ev *cmd.Event) error {
+	query := ev.Args["query"]
+	if q.local(ev) {
+		out, err := calc.Eval(query)
+		switch {
+		case err == nil:
+			ircmsg.NotifyN(q.b, w, ev.Event, ev.Nick(),
+				sanitize(fmt.Sprintf("\x02Calc:\x02 %s \x02=>\x02 %s", query, out)), 2)
+			return nil
+		case err != calc.ErrUnsupported:
+			w.Notice(ev.Nick(), "\x02Calc:\x02 "+err.Error())
+			return nil
+		}
 	}
 
-	return nil
+	// Ensure two lines only
+	return q.ask(w, ev, "calc", KindCalc, q.chosen(ev, KindCalc), query, 2)
 }
 
-// Google some query and return the first result
-func (Queryer) Google(w irc.Writer, ev *cmd.Event) error {
-	q := ev.Args["query"]
-	nick := ev.Nick()
+// local checks if calc should try working things out itself.
+func (q Queryer) local(ev *cmd.Event) bool {
+	var channel string
+	if ev.IsTargetChan() {
+		channel = ev.Target()
+	}
+	return settings.Bool(q.b, ev.NetworkID, channel, "queryer", "calc_local")
+}
 
-	if out, err := query.Google(q, queryConf); len(out) != 0 {
-		out = sanitize(out)
-		w.Notify(ev.Event, nick, out)
-	} else if err != nil {
-		w.Notice(nick, err.Error())
+// Search with the channel's search provider and return the first result, or
+// the first few with -n
+func (q Queryer) Search(w irc.Writer, ev *cmd.Event) error {
+	return q.search(w, ev, "search", KindSearch, q.chosen(ev, KindSearch), ev.Args["query"])
+}
+
+// Google some query and return the first result, or the first few with -n
+func (q Queryer) Google(w irc.Writer, ev *cmd.Event) error {
+	return q.search(w, ev, "google", KindSearch, "google", ev.Args["query"])
+}
+
+// Bing some query and return the first result, or the first few with -n
+func (q Queryer) Bing(w irc.Writer, ev *cmd.Event) error {
+	return q.search(w, ev, "bing", KindSearch, "bing", ev.Args["query"])
+}
+
+// Yr is the old name of weather.
+func (q Queryer) Yr(w irc.Writer, ev *cmd.Event) error {
+	return q.Weather(w, ev)
+}
+
+// Shorten a url
+func (q Queryer) Shorten(w irc.Writer, ev *cmd.Event) error {
+	return q.ask(w, ev, "shorten", KindShorten, q.chosen(ev, KindShorten), ev.Args["query"], 0)
+}
+
+// Tr translates text
+func (q Queryer) Tr(w irc.Writer, ev *cmd.Event) error {
+	query := ev.Args["languages"] + " " + ev.Args["text"]
+	if _, _, _, ok := parseTranslation(query); !ok {
+		w.Notice(ev.Nick(), "\x02Translate:\x02 Usage: tr [from:]to text, with languages like en or pt-BR.")
+		return nil
 	}
+	return q.ask(w, ev, "tr", KindTranslate, q.chosen(ev, KindTranslate), query, 2)
+}
 
-	return nil
+// Define a word
+func (q Queryer) Define(w irc.Writer, ev *cmd.Event) error {
+	return q.ask(w, ev, "define", KindDefine, q.chosen(ev, KindDefine), ev.Args["word"], 2)
 }
 
-// Bing some query and return the first result
-func (Queryer) Bing(w irc.Writer, ev *cmd.Event) error {
-	q := ev.Args["query"]
-	nick := ev.Nick()
+// Urban looks a term up on urban dictionary
+func (q Queryer) Urban(w irc.Writer, ev *cmd.Event) error {
+	return q.ask(w, ev, "urban", KindUrban, q.chosen(ev, KindUrban), ev.Args["term"], 2)
+}
 
-	if out, err := query.Bing(q, queryConf); len(out) != 0 {
-		out = sanitize(out)
-		w.Notify(ev.Event, nick, out)
-	} else if err != nil {
-		w.Notice(nick, err.Error())
+// Stars counts github stars
+func (q Queryer) Stars(w irc.Writer, ev *cmd.Event) error {
+	return q.ask(w, ev, "stars", KindStars, q.chosen(ev, KindStars), ev.Args["userorrepo"], 0)
+}
+
+// ask a provider something for a command, going through the rate limits and
+// the cache. The answer is cut to lines if it's not 0.
+func (q Queryer) ask(w irc.Writer, ev *cmd.Event, command, kind, name, search string, lines int) error {
+	p, ok := q.provider(w, ev, kind, name)
+	if !ok {
+		return nil
 	}
 
-	return nil
+	return q.answer(w, ev, command, name, search, lines, p, func(ctx context.Context) (string, error) {
+		return p.Query(ctx, search)
+	})
 }
 
-// Yr weather for norway based residents
-func (Queryer) Yr(w irc.Writer, ev *cmd.Event) error {
-	q := ev.Args["query"]
+// provider looks up a provider, telling the user what the choices are if
+// there's no such provider.
+func (q Queryer) provider(w irc.Writer, ev *cmd.Event, kind, name string) (Provider, bool) {
+	p, ok := getProvider(kind, name)
+	if !ok {
+		w.Noticef(ev.Nick(), "\x02Query:\x02 No %s provider named %q, try one of: %s",
+			kind, name, strings.Join(ProviderNames(kind), ", "))
+	}
+	return p, ok
+}
+
+// answer calls fn, which asks provider p, and shows the user its answer.
+// key is what the answer is cached under along with the provider's name.
+func (q Queryer) answer(w irc.Writer, ev *cmd.Event, command, name, key string, lines int,
+	p Provider, fn func(ctx context.Context) (string, error)) error {
+
 	nick := ev.Nick()
+	out, ok, err := q.fetch(w, ev, command, name, key, p, fn)
+	if !ok {
+		return nil
+	}
 
-	if out, err := query.WeatherYR(q, queryConf); len(out) != 0 {
-		out = sanitize(out)
-		w.Notify(ev.Event, nick, out)
-	} else if err != nil {
+	switch {
+	case len(out) != 0 && lines != 0:
+		ircmsg.NotifyN(q.b, w, ev.Event, nick, sanitize(out), lines)
+	case len(out) != 0:
+		ircmsg.Notify(q.b, w, ev.Event, nick, sanitize(out))
+	case err != nil:
 		w.Notice(nick, err.Error())
 	}
 
 	return nil
 }
 
-// Shorten a url
-func (Queryer) Shorten(w irc.Writer, ev *cmd.Event) error {
-	q := ev.Args["query"]
-	nick := ev.Nick()
+// fetch calls fn through the rate limits and the cache. It's not ok if the
+// user was told they're being limited.
+func (q Queryer) fetch(w irc.Writer, ev *cmd.Event, command, name, key string,
+	p Provider, fn func(ctx context.Context) (string, error)) (string, bool, error) {
 
-	if out, err := query.GetShortURL(q, queryConf); len(out) != 0 {
-		w.Notifyf(ev.Event, nick, "\x02Shorten:\x02 %s", sanitize(out))
-	} else if err != nil {
-		w.Notice(nick, err.Error())
+	if q.limited(w, ev, name) {
+		return "", false, nil
 	}
 
+	call := func() (string, error) {
+		if err := q.limit.spend(name); err != nil {
+			return "", err
+		}
+
+		ctx := context.WithValue(context.Background(), requesterKey{}, ev.Sender)
+		ctx, cancel := context.WithTimeout(ctx, providerTimeout)
+		defer cancel()
+		return fn(ctx)
+	}
+
+	if u, ok := p.(Uncached); ok && u.Uncached() {
+		out, err := call()
+		return out, true, err
+	}
+	out, err := q.cache.do(command, name+" "+key, call)
+	return out, true, err
+}
+
+// chosen is the provider of a kind picked for the channel the command was
+// used in, or the network's when it's a private message.
+func (q Queryer) chosen(ev *cmd.Event, kind string) string {
+	var channel string
+	if ev.IsTargetChan() {
+		channel = ev.Target()
+	}
+	return settings.String(q.b, ev.NetworkID, channel, "queryer", kind)
+}
+
+// Cachestats shows the cache's hit rates.
+func (q Queryer) Cachestats(w irc.Writer, ev *cmd.Event) error {
+	ircmsg.Notify(q.b, w, ev.Event, ev.Nick(), "\x02Query cache:\x02 "+q.cache.String())
 	return nil
 }
 
-// Stars counts github stars
-func (Queryer) Stars(w irc.Writer, ev *cmd.Event) error {
-	q := ev.Args["userorrepo"]
-	nick := ev.Nick()
+// Quota shows each provider's usage today.
+func (q Queryer) Quota(w irc.Writer, ev *cmd.Event) error {
+	ircmsg.Notify(q.b, w, ev.Event, ev.Nick(), "\x02Query quota:\x02 "+q.limit.usage())
+	return nil
+}
 
-	if out, err := query.GithubStars(q, queryConf); err != nil {
-		w.Notice(nick, err.Error())
-	} else if out != 0 {
-		w.Notifyf(ev.Event, nick, "\x02Github stars (%s):\x02 %d", strings.ToLower(q), out)
-	} else {
-		w.Notify(ev.Event, nick, "\x02Github stars:\x02 could not find repo %s", strings.ToLower(q))
+// limited checks the rate limits before a command runs, telling the user to
+// slow down the first time they hit one.
+func (q Queryer) limited(w irc.Writer, ev *cmd.Event, provider string) bool {
+	ok, wait, warn := q.allowed(ev.Event, provider)
+	if ok {
+		return false
 	}
 
-	return nil
+	if warn {
+		wait = (wait + time.Second - 1).Truncate(time.Second)
+		w.Noticef(ev.Nick(), "\x02Query:\x02 Slow down! Try again in %v.", wait)
+	}
+	return true
+}
+
+// allowed checks the rate limits without telling anyone, users with
+// ExemptFlag are always allowed.
+func (q Queryer) allowed(ev *irc.Event, provider string) (ok bool, wait time.Duration, warn bool) {
+	network := ev.NetworkID
+	var channel string
+	if ev.IsTargetChan() {
+		channel = ev.Target()
+	}
+
+	if store := q.b.Store(); store != nil {
+		user := store.AuthedUser(network, ev.Sender)
+		if user != nil && user.HasFlags(network, channel, ExemptFlag) {
+			return true, 0, false
+		}
+	}
+
+	host := ev.Username() + "@" + ev.Hostname()
+	return q.limit.allow(network, host, channel, provider)
 }
 
 func sanitize(str string) string {
@@ -0,0 +1,55 @@
+package queryer
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// recently remembers what was shown in each channel so that a link pasted
+// over and over is only expanded once.
+type recently struct {
+	mut sync.Mutex
+	// seen maps keys to when they can be shown again, each key has the window
+	// of the channel it was shown in.
+	seen map[string]time.Time
+}
+
+func newRecently() *recently {
+	return &recently{seen: make(map[string]time.Time)}
+}
+
+// has checks if key was shown in the channel within its window. It doesn't
+// mark it, that's left until it's actually been shown.
+func (r *recently) has(network, channel, key string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	return r.shown(recentKey(network, channel, key))
+}
+
+// mark key as shown in the channel for the window.
+func (r *recently) mark(network, channel, key string, window time.Duration) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.seen[recentKey(network, channel, key)] = time.Now().Add(window)
+}
+
+// shown drops the expired keys and checks if key is left. It must be called
+// with mut held.
+func (r *recently) shown(key string) bool {
+	now := time.Now()
+	for k, expires := range r.seen {
+		if !now.Before(expires) {
+			delete(r.seen, k)
+		}
+	}
+
+	_, ok := r.seen[key]
+	return ok
+}
+
+func recentKey(network, channel, key string) string {
+	return strings.ToLower(network+" "+channel) + " " + key
+}
@@ -0,0 +1,47 @@
+package queryer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecentlyWindows(t *testing.T) {
+	t.Parallel()
+
+	r := newRecently()
+	r.mark("net", "#long", "link", time.Hour)
+	if !r.has("net", "#long", "link") {
+		t.Error("the link should be seen within the window")
+	}
+
+	if r.has("net", "#short", "link") {
+		t.Error("a link in another channel shouldn't be seen")
+	}
+	r.mark("net", "#short", "link", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	// The short window expiring mustn't take the long one with it.
+	if r.has("net", "#short", "link") {
+		t.Error("the link should have expired in the short window")
+	}
+	if !r.has("net", "#long", "link") {
+		t.Error("a short window evicted another channel's link")
+	}
+}
+
+func TestRecentlyMark(t *testing.T) {
+	t.Parallel()
+
+	r := newRecently()
+	if r.has("net", "#chan", "video") {
+		t.Error("a new video shouldn't be seen")
+	}
+	if r.has("net", "#chan", "video") {
+		t.Error("has shouldn't mark the video as shown")
+	}
+
+	r.mark("net", "#chan", "video", time.Hour)
+	if !r.has("net", "#chan", "video") {
+		t.Error("the marked video should be seen")
+	}
+}
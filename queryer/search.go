@@ -0,0 +1,172 @@
+package queryer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	googleURL = "https://www.googleapis.com"
+	bingURL   = "https://api.bing.microsoft.com"
+)
+
+// google searches with a google custom search engine.
+type google struct {
+	cfg ProviderConfig
+}
+
+func newGoogle(cfg ProviderConfig) Provider {
+	return google{cfg: cfg}
+}
+
+func (g google) Query(ctx context.Context, search string) (string, error) {
+	results, total, err := g.Search(ctx, search, 1)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "\x02Google:\x02 No results found.", nil
+	}
+
+	return fmt.Sprintf("\x02Google (\x02%s\x02):\x02 %s - %s",
+		total, results[0].URL, results[0].Snippet), nil
+}
+
+// Search returns up to 10 results, which is all google gives in one request.
+func (g google) Search(ctx context.Context, search string, n int) ([]Result, string, error) {
+	key, cx := g.cfg.Keys.GoogleSearchAPIKey, g.cfg.Keys.GoogleSearchCXID
+	if len(key) == 0 || len(cx) == 0 {
+		return nil, "", errors.New("cannot use google search without google_search_api_key and google_search_cx_id")
+	}
+
+	vals := url.Values{
+		"cx":  {cx},
+		"key": {key},
+		"q":   {search},
+		"num": {strconv.Itoa(clamp(n, 1, 10))},
+	}
+	req, err := http.NewRequest(http.MethodGet, g.cfg.BaseURL(googleURL)+"/customsearch/v1?"+vals.Encode(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var results struct {
+		Items []struct {
+			Title   string `json:"title"`
+			Link    string `json:"link"`
+			Snippet string `json:"snippet"`
+		} `json:"items"`
+		Info struct {
+			FormattedTotalResults string `json:"formattedTotalResults"`
+		} `json:"searchInformation"`
+	}
+	if err := getJSON(ctx, g.cfg.Client, "google", req, &results); err != nil {
+		return nil, "", err
+	}
+
+	found := make([]Result, len(results.Items))
+	for i, item := range results.Items {
+		found[i] = Result{Title: item.Title, URL: item.Link, Snippet: item.Snippet}
+	}
+	return found, results.Info.FormattedTotalResults + " results", nil
+}
+
+// bing searches with the bing web search api.
+type bing struct {
+	cfg ProviderConfig
+}
+
+func newBing(cfg ProviderConfig) Provider {
+	return bing{cfg: cfg}
+}
+
+func (b bing) Query(ctx context.Context, search string) (string, error) {
+	results, total, err := b.Search(ctx, search, 1)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "\x02Bing:\x02 No results found.", nil
+	}
+
+	return fmt.Sprintf("\x02Bing (\x02%s\x02):\x02 %s - %s",
+		total, results[0].URL, results[0].Snippet), nil
+}
+
+// Search returns web pages, or videos when bing has no pages for the query.
+func (b bing) Search(ctx context.Context, search string, n int) ([]Result, string, error) {
+	key := b.cfg.Keys.BingAPIKey
+	if len(key) == 0 {
+		return nil, "", errors.New("cannot use bing search without bing_api_key")
+	}
+
+	count := strconv.Itoa(clamp(n, 1, 50))
+	vals := url.Values{
+		"answerCount": {"1"},
+		"count":       {count},
+		"safeSearch":  {"Moderate"},
+		"q":           {search},
+	}
+	req, err := http.NewRequest(http.MethodGet, b.cfg.BaseURL(bingURL)+"/v7.0/search?"+vals.Encode(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Ocp-Apim-Subscription-Key", key)
+
+	var results struct {
+		WebPages struct {
+			TotalEstimatedMatches int `json:"totalEstimatedMatches"`
+			Value                 []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+		Videos struct {
+			Value []struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				ContentURL  string `json:"contentUrl"`
+				Duration    string `json:"duration"`
+			} `json:"value"`
+		} `json:"videos"`
+	}
+	if err := getJSON(ctx, b.cfg.Client, "bing", req, &results); err != nil {
+		return nil, "", err
+	}
+
+	var found []Result
+	var total string
+	switch {
+	case len(results.WebPages.Value) != 0:
+		for _, page := range results.WebPages.Value {
+			found = append(found, Result{Title: page.Name, URL: page.URL, Snippet: page.Snippet})
+		}
+		total = fmt.Sprintf("%d results", results.WebPages.TotalEstimatedMatches)
+	case len(results.Videos.Value) != 0:
+		for _, v := range results.Videos.Value {
+			found = append(found, Result{Title: v.Name, URL: v.ContentURL,
+				Snippet: v.Name + " - " + v.Description})
+		}
+		total = fmt.Sprint(parseISODuration(results.Videos.Value[0].Duration))
+	}
+	if len(found) > n {
+		found = found[:n]
+	}
+	return found, total, nil
+}
+
+func clamp(n, min, max int) int {
+	switch {
+	case n < min:
+		return min
+	case n > max:
+		return max
+	}
+	return n
+}
@@ -0,0 +1,47 @@
+package queryer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+const isgdURL = "https://is.gd"
+
+// isgd shortens links with is.gd, which needs no api key.
+type isgd struct {
+	cfg ProviderConfig
+}
+
+func newIsgd(cfg ProviderConfig) Provider {
+	return isgd{cfg: cfg}
+}
+
+func (i isgd) Query(ctx context.Context, link string) (string, error) {
+	vals := url.Values{
+		"format": {"json"},
+		"url":    {link},
+	}
+	req, err := http.NewRequest(http.MethodGet, i.cfg.BaseURL(isgdURL)+"/create.php?"+vals.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		ShortURL     string `json:"shorturl"`
+		ErrorMessage string `json:"errormessage"`
+	}
+	if err := getJSON(ctx, i.cfg.Client, "is.gd", req, &result); err != nil {
+		return "", err
+	}
+
+	if len(result.ShortURL) == 0 {
+		if len(result.ErrorMessage) != 0 {
+			return "", errors.New("is.gd: " + result.ErrorMessage)
+		}
+		return "", errors.New("is.gd did not return a link")
+	}
+
+	return "\x02Shorten:\x02 " + result.ShortURL, nil
+}
@@ -0,0 +1,88 @@
+package queryer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const libretranslateURL = "https://libretranslate.com"
+
+var rgxLang = regexp.MustCompile(`^(?i:[a-z]{2,3}(?:-[a-z]{2,4})?)$`)
+
+// parseTranslation splits "[from:]to text", from is auto when it's left out.
+func parseTranslation(query string) (from, to, text string, ok bool) {
+	fields := strings.SplitN(strings.TrimSpace(query), " ", 2)
+	if len(fields) != 2 || len(strings.TrimSpace(fields[1])) == 0 {
+		return "", "", "", false
+	}
+
+	from, to = "auto", fields[0]
+	if i := strings.IndexByte(fields[0], ':'); i >= 0 {
+		from, to = fields[0][:i], fields[0][i+1:]
+		if !rgxLang.MatchString(from) {
+			return "", "", "", false
+		}
+	}
+	if !rgxLang.MatchString(to) {
+		return "", "", "", false
+	}
+	return strings.ToLower(from), strings.ToLower(to), strings.TrimSpace(fields[1]), true
+}
+
+// libretranslate translates with a libretranslate server, api_key in
+// [providers.libretranslate] is needed by the public one.
+type libretranslate struct {
+	cfg ProviderConfig
+}
+
+func newLibretranslate(cfg ProviderConfig) Provider {
+	return libretranslate{cfg: cfg}
+}
+
+// Query translates "[from:]to text".
+func (l libretranslate) Query(ctx context.Context, query string) (string, error) {
+	from, to, text, ok := parseTranslation(query)
+	if !ok {
+		return "", errors.New("usage: tr [from:]to text")
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  from,
+		"target":  to,
+		"format":  "text",
+		"api_key": l.cfg.Option("api_key", ""),
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, l.cfg.BaseURL(libretranslateURL)+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		TranslatedText string `json:"translatedText"`
+		Detected       struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	if err := getJSON(ctx, l.cfg.Client, "libretranslate", req, &result); err != nil {
+		return "", err
+	}
+
+	if len(result.TranslatedText) == 0 {
+		return "\x02Translate:\x02 No translation found.", nil
+	}
+	if from == "auto" && len(result.Detected.Language) != 0 {
+		from = result.Detected.Language
+	}
+	return fmt.Sprintf("\x02Translate (\x02%s => %s\x02):\x02 %s", from, to, result.TranslatedText), nil
+}
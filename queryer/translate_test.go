@@ -0,0 +1,84 @@
+package queryer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestParseTranslation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		query          string
+		from, to, text string
+		ok             bool
+	}{
+		{"en hola mundo", "auto", "en", "hola mundo", true},
+		{"  ES:EN   hola  ", "es", "en", "hola", true},
+		{"de:en-GB hallo", "de", "en-gb", "hallo", true},
+		{"zh-Hans:en 你好", "zh-hans", "en", "你好", true},
+		{"en", "", "", "", false},
+		{"en    ", "", "", "", false},
+		{"", "", "", "", false},
+		{"english hello", "", "", "", false},
+		{"e hello", "", "", "", false},
+		{":en hello", "", "", "", false},
+		{"es: hola", "", "", "", false},
+		{"es:en:fr hola", "", "", "", false},
+	}
+
+	for _, test := range tests {
+		from, to, text, ok := parseTranslation(test.query)
+		if ok != test.ok || from != test.from || to != test.to || text != test.text {
+			t.Errorf("%q: want %q %q %q %v, got %q %q %q %v", test.query,
+				test.from, test.to, test.text, test.ok, from, to, text, ok)
+		}
+	}
+}
+
+func TestLibretranslate(t *testing.T) {
+	t.Parallel()
+
+	cfg := fakeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/translate" {
+			t.Errorf("want POST /translate, got %s %s", r.Method, r.URL.Path)
+		}
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if req["q"] != "hola mundo" || req["target"] != "en" || req["api_key"] != "lkey" {
+			t.Errorf("unexpected request: %v", req)
+		}
+		if req["source"] == "auto" {
+			io.WriteString(w, `{"translatedText":"hello world","detectedLanguage":{"language":"es"}}`)
+			return
+		}
+		io.WriteString(w, `{"translatedText":""}`)
+	})
+	cfg.Options["api_key"] = "lkey"
+	l := newLibretranslate(cfg)
+
+	out, err := l.Query(context.Background(), "en hola mundo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02Translate (\x02es => en\x02):\x02 hello world"; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	out, err = l.Query(context.Background(), "fr:en hola mundo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x02Translate:\x02 No translation found."; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	if _, err = l.Query(context.Background(), "hola"); err == nil {
+		t.Error("want a usage error without a language")
+	}
+}
@@ -0,0 +1,468 @@
+package queryer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/settings"
+)
+
+const (
+	metnoURL    = "https://api.met.no"
+	geonamesURL = "https://secure.geonames.org"
+
+	defaultForecastDays = 3
+	maxForecastDays     = 7
+)
+
+// Units are the units weather is reported in.
+type Units string
+
+// The units a user can choose.
+const (
+	Metric   Units = "metric"
+	Imperial Units = "imperial"
+)
+
+// ParseUnits parses metric or imperial, and the first letter of either.
+func ParseUnits(s string) (Units, bool) {
+	switch strings.ToLower(s) {
+	case "metric", "m", "c", "celsius":
+		return Metric, true
+	case "imperial", "i", "f", "fahrenheit":
+		return Imperial, true
+	}
+	return "", false
+}
+
+func (u Units) degrees(celsius float64) float64 {
+	if u == Imperial {
+		return celsius*9/5 + 32
+	}
+	return celsius
+}
+
+func (u Units) temperature(celsius float64) string {
+	if u == Imperial {
+		return fmt.Sprintf("%.0f °F", u.degrees(celsius))
+	}
+	return fmt.Sprintf("%.0f °C", celsius)
+}
+
+func (u Units) speed(ms float64) string {
+	if u == Imperial {
+		return fmt.Sprintf("%.0f mph", ms*2.23694)
+	}
+	return fmt.Sprintf("%.0f m/s", ms)
+}
+
+// WeatherProvider is a weather provider for the weather command, its Query
+// is the current weather in metric.
+type WeatherProvider interface {
+	Provider
+	// Current weather at a place.
+	Current(ctx context.Context, place string, units Units) (string, error)
+	// Forecast for a place, one summary for each day.
+	Forecast(ctx context.Context, place string, units Units, days int) (string, error)
+}
+
+// metno gets the weather from the norwegian meteorological institute, which
+// covers the whole world, after finding the place with geonames.
+type metno struct {
+	cfg ProviderConfig
+}
+
+func newMetno(cfg ProviderConfig) Provider {
+	return metno{cfg: cfg}
+}
+
+// place is a location found by geonames.
+type place struct {
+	Name     string
+	Country  string
+	Lat      string
+	Lon      string
+	Location *time.Location
+}
+
+func (p place) String() string {
+	if len(p.Country) == 0 {
+		return p.Name
+	}
+	return p.Name + ", " + p.Country
+}
+
+// metnoEntry is one hour of met.no's forecast.
+type metnoEntry struct {
+	Time time.Time `json:"time"`
+	Data struct {
+		Instant struct {
+			Details struct {
+				Temperature float64 `json:"air_temperature"`
+				WindSpeed   float64 `json:"wind_speed"`
+			} `json:"details"`
+		} `json:"instant"`
+		NextHour struct {
+			Summary struct {
+				Symbol string `json:"symbol_code"`
+			} `json:"summary"`
+		} `json:"next_1_hours"`
+		NextSixHours struct {
+			Summary struct {
+				Symbol string `json:"symbol_code"`
+			} `json:"summary"`
+		} `json:"next_6_hours"`
+	} `json:"data"`
+}
+
+func (m metno) Query(ctx context.Context, search string) (string, error) {
+	return m.Current(ctx, search, Metric)
+}
+
+func (m metno) Current(ctx context.Context, search string, units Units) (string, error) {
+	p, entries, err := m.lookup(ctx, search)
+	if err != nil {
+		return "", err
+	} else if p == nil {
+		return notFound(search), nil
+	}
+
+	now := entries[0].Data
+	symbol := now.NextHour.Summary.Symbol
+	if len(symbol) == 0 {
+		symbol = now.NextSixHours.Summary.Symbol
+	}
+
+	return fmt.Sprintf("\x02Weather (\x02met.no\x02):\x02 %s \x02=>\x02 %s, %s, wind %s",
+		p, symbolName(symbol), units.temperature(now.Instant.Details.Temperature),
+		units.speed(now.Instant.Details.WindSpeed)), nil
+}
+
+func (m metno) Forecast(ctx context.Context, search string, units Units, days int) (string, error) {
+	p, entries, err := m.lookup(ctx, search)
+	if err != nil {
+		return "", err
+	} else if p == nil {
+		return notFound(search), nil
+	}
+
+	type day struct {
+		date     time.Time
+		min, max float64
+		symbol   string
+		noon     time.Duration
+	}
+	var forecast []*day
+	for _, e := range entries {
+		local := e.Time.In(p.Location)
+		date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, p.Location)
+		temp := e.Data.Instant.Details.Temperature
+
+		var d *day
+		if n := len(forecast); n != 0 && forecast[n-1].date.Equal(date) {
+			d = forecast[n-1]
+		} else {
+			if len(forecast) == days {
+				break
+			}
+			d = &day{date: date, min: temp, max: temp, noon: math.MaxInt64}
+			forecast = append(forecast, d)
+		}
+
+		d.min, d.max = math.Min(d.min, temp), math.Max(d.max, temp)
+		// The day's weather is whatever's forecast closest to midday.
+		symbol := e.Data.NextSixHours.Summary.Symbol
+		if fromNoon := absDuration(local.Sub(date.Add(12 * time.Hour))); len(symbol) != 0 && fromNoon < d.noon {
+			d.symbol, d.noon = symbol, fromNoon
+		}
+	}
+
+	parts := make([]string, len(forecast))
+	for i, d := range forecast {
+		parts[i] = fmt.Sprintf("\x02%s:\x02 %s %.0f to %s", d.date.Format("Mon"),
+			symbolName(d.symbol), units.degrees(d.min), units.temperature(d.max))
+	}
+
+	return fmt.Sprintf("\x02Forecast (\x02met.no\x02):\x02 %s \x02=>\x02 %s",
+		p, strings.Join(parts, " ")), nil
+}
+
+// lookup finds the place and its forecast, it returns a nil place if there's
+// no such place.
+func (m metno) lookup(ctx context.Context, search string) (*place, []metnoEntry, error) {
+	p, err := geocode(ctx, m.cfg, search)
+	if p == nil || err != nil {
+		return nil, nil, err
+	}
+
+	vals := url.Values{
+		"lat": {p.Lat},
+		"lon": {p.Lon},
+	}
+	req, err := http.NewRequest(http.MethodGet,
+		m.cfg.BaseURL(metnoURL)+"/weatherapi/locationforecast/2.0/compact?"+vals.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var forecast struct {
+		Properties struct {
+			Timeseries []metnoEntry `json:"timeseries"`
+		} `json:"properties"`
+	}
+	if err := getJSON(ctx, m.cfg.Client, "met.no", req, &forecast); err != nil {
+		return nil, nil, err
+	}
+	if len(forecast.Properties.Timeseries) == 0 {
+		return nil, nil, errors.New("met.no returned no forecast")
+	}
+
+	return p, forecast.Properties.Timeseries, nil
+}
+
+func notFound(search string) string {
+	return fmt.Sprintf("\x02Weather:\x02 Unable to find %s", search)
+}
+
+// geocode finds a place with geonames, it returns a nil place if there's no
+// such place.
+func geocode(ctx context.Context, cfg ProviderConfig, search string) (*place, error) {
+	user := cfg.Keys.GeonamesID
+	if len(user) == 0 {
+		return nil, errors.New("cannot find places without geonames_id")
+	}
+
+	vals := url.Values{
+		"q":        {search},
+		"maxRows":  {"1"},
+		"orderby":  {"relevance"},
+		"style":    {"full"},
+		"username": {user},
+	}
+	req, err := http.NewRequest(http.MethodGet,
+		strings.TrimRight(cfg.Option("geonames_url", geonamesURL), "/")+"/searchJSON?"+vals.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Geonames []struct {
+			Name        string `json:"name"`
+			CountryName string `json:"countryName"`
+			Lat         string `json:"lat"`
+			Lng         string `json:"lng"`
+			Timezone    struct {
+				ID        string  `json:"timeZoneId"`
+				GMTOffset float64 `json:"gmtOffset"`
+			} `json:"timezone"`
+		} `json:"geonames"`
+	}
+	if err := getJSON(ctx, cfg.Client, "geonames", req, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Geonames) == 0 {
+		return nil, nil
+	}
+
+	g := result.Geonames[0]
+	loc, err := time.LoadLocation(g.Timezone.ID)
+	if len(g.Timezone.ID) == 0 || err != nil {
+		loc = time.FixedZone("", int(g.Timezone.GMTOffset*3600))
+	}
+
+	return &place{Name: g.Name, Country: g.CountryName, Lat: g.Lat, Lon: g.Lng, Location: loc}, nil
+}
+
+// symbolName turns a met.no symbol code like partlycloudy_day into words.
+func symbolName(symbol string) string {
+	if i := strings.IndexByte(symbol, '_'); i >= 0 {
+		symbol = symbol[:i]
+	}
+	if len(symbol) == 0 {
+		return "unknown"
+	}
+
+	for _, word := range []string{"light", "heavy", "partly", "fair", "clear", "cloudy",
+		"rain", "sleet", "snow", "showers", "andthunder"} {
+		symbol = strings.Replace(symbol, word, word+" ", 1)
+	}
+	symbol = strings.Replace(symbol, "andthunder", "and thunder", 1)
+	return strings.Join(strings.Fields(symbol), " ")
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// weatherKey is where a user's weather preferences are kept in the store.
+const weatherKey = "weather"
+
+// weatherPrefs are what a user saved with the weather command.
+type weatherPrefs struct {
+	Location string `json:"location,omitempty"`
+	Units    Units  `json:"units,omitempty"`
+}
+
+// Weather shows the weather, or a forecast, for a place or the location the
+// user saved:
+//
+//	weather [place...]
+//	weather forecast [days] [place...]
+//	weather set place...
+//	weather units metric|imperial
+func (q Queryer) Weather(w irc.Writer, ev *cmd.Event) error {
+	nick := ev.Nick()
+	network := ev.NetworkID
+	args := strings.Fields(ev.Args["query"])
+
+	var sub string
+	if len(args) != 0 {
+		sub = strings.ToLower(args[0])
+	}
+
+	// Without a store nobody has a saved location.
+	var user *data.StoredUser
+	if store := q.b.Store(); store != nil {
+		user = store.AuthedUser(network, ev.Sender)
+	}
+	var prefs weatherPrefs
+	if user != nil {
+		if _, err := user.GetJSON(weatherKey, &prefs); err != nil {
+			return err
+		}
+	}
+
+	switch sub {
+	case "set", "units":
+		if user == nil {
+			w.Notice(nick, "\x02Weather:\x02 Log in to save your location and units.")
+			return nil
+		}
+		return q.saveWeatherPrefs(w, ev, user.Username, sub, args[1:])
+	case "forecast":
+		args = args[1:]
+	}
+
+	days := 0
+	if sub == "forecast" {
+		days = defaultForecastDays
+		if len(args) != 0 {
+			if n, err := strconv.Atoi(args[0]); err == nil {
+				if n < 1 || n > maxForecastDays {
+					w.Noticef(nick, "\x02Weather:\x02 Forecasts are 1 to %d days.", maxForecastDays)
+					return nil
+				}
+				days, args = n, args[1:]
+			}
+		}
+	}
+
+	location := strings.Join(args, " ")
+	if len(location) == 0 {
+		location = prefs.Location
+	}
+	if len(location) == 0 {
+		w.Notice(nick, "\x02Weather:\x02 Where? Give a place or save one with: weather set place")
+		return nil
+	}
+
+	var channel string
+	if ev.IsTargetChan() {
+		channel = ev.Target()
+	}
+	units := prefs.Units
+	if len(units) == 0 {
+		units, _ = ParseUnits(settings.String(q.b, network, channel, "queryer", "units"))
+	}
+	if len(units) == 0 {
+		units = Metric
+	}
+
+	name := q.chosen(ev, KindWeather)
+	p, ok := q.provider(w, ev, KindWeather, name)
+	if !ok {
+		return nil
+	}
+	wp, ok := p.(WeatherProvider)
+	if !ok {
+		// A plain provider can still answer the simple case.
+		if days != 0 || units != Metric {
+			w.Noticef(nick, "\x02Weather:\x02 %s can only give the current weather in metric.", name)
+			return nil
+		}
+		return q.answer(w, ev, "weather", name, location, 0, p, func(ctx context.Context) (string, error) {
+			return p.Query(ctx, location)
+		})
+	}
+
+	if days != 0 {
+		key := fmt.Sprintf("%s %d %s", units, days, location)
+		return q.answer(w, ev, "forecast", name, key, 0, p, func(ctx context.Context) (string, error) {
+			return wp.Forecast(ctx, location, units, days)
+		})
+	}
+	return q.answer(w, ev, "weather", name, string(units)+" "+location, 0, p, func(ctx context.Context) (string, error) {
+		return wp.Current(ctx, location, units)
+	})
+}
+
+// saveWeatherPrefs changes the user's location or units. The saved prefs are
+// read and written back under the store's lock so two changes at once don't
+// undo each other.
+func (q Queryer) saveWeatherPrefs(w irc.Writer, ev *cmd.Event, username, sub string, args []string) error {
+	nick := ev.Nick()
+
+	var change func(prefs *weatherPrefs)
+	var saved string
+	switch sub {
+	case "set":
+		if len(args) == 0 {
+			w.Notice(nick, "\x02Weather:\x02 Usage: weather set place")
+			return nil
+		}
+		location := strings.Join(args, " ")
+		change = func(prefs *weatherPrefs) { prefs.Location = location }
+		saved = "location is " + location
+	case "units":
+		var units Units
+		var ok bool
+		if len(args) != 0 {
+			units, ok = ParseUnits(args[0])
+		}
+		if !ok {
+			w.Notice(nick, "\x02Weather:\x02 Usage: weather units metric|imperial")
+			return nil
+		}
+		change = func(prefs *weatherPrefs) { prefs.Units = units }
+		saved = "units are " + string(units)
+	}
+
+	err := ext.UpdateUser(q.b, username, func(u *data.StoredUser) error {
+		var prefs weatherPrefs
+		if _, err := u.GetJSON(weatherKey, &prefs); err != nil {
+			return err
+		}
+		change(&prefs)
+		return u.PutJSON(weatherKey, prefs)
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Noticef(nick, "\x02Weather:\x02 Your %s.", saved)
+	return nil
+}
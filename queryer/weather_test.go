@@ -0,0 +1,218 @@
+package queryer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aarondl/query"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+)
+
+const fakeForecast = `{"properties":{"timeseries":[
+	{"time":"2026-10-19T06:00:00Z","data":{
+		"instant":{"details":{"air_temperature":5.2,"wind_speed":3.4}},
+		"next_1_hours":{"summary":{"symbol_code":"lightrain"}},
+		"next_6_hours":{"summary":{"symbol_code":"rain"}}}},
+	{"time":"2026-10-19T12:00:00Z","data":{
+		"instant":{"details":{"air_temperature":12}},
+		"next_6_hours":{"summary":{"symbol_code":"partlycloudy_day"}}}},
+	{"time":"2026-10-19T18:00:00Z","data":{
+		"instant":{"details":{"air_temperature":8}},
+		"next_6_hours":{"summary":{"symbol_code":"cloudy"}}}},
+	{"time":"2026-10-20T12:00:00Z","data":{
+		"instant":{"details":{"air_temperature":-3}},
+		"next_6_hours":{"summary":{"symbol_code":"heavysnowshowersandthunder_day"}}}},
+	{"time":"2026-10-21T12:00:00Z","data":{
+		"instant":{"details":{"air_temperature":0}},
+		"next_6_hours":{"summary":{"symbol_code":"clearsky_day"}}}}
+]}}`
+
+// fakeMetno serves geonames and met.no from one server, only Oslo exists.
+func fakeMetno(t *testing.T) metno {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/searchJSON":
+			if user := r.URL.Query().Get("username"); user != "geo" {
+				t.Errorf("want the geonames user, got %q", user)
+			}
+			if !strings.EqualFold(r.URL.Query().Get("q"), "oslo") {
+				io.WriteString(w, `{"geonames":[]}`)
+				return
+			}
+			io.WriteString(w, `{"geonames":[{"name":"Oslo","countryName":"Norway",
+				"lat":"59.9","lng":"10.7","timezone":{"timeZoneId":"UTC"}}]}`)
+		case "/weatherapi/locationforecast/2.0/compact":
+			if lat, lon := r.URL.Query().Get("lat"), r.URL.Query().Get("lon"); lat != "59.9" || lon != "10.7" {
+				t.Errorf("want Oslo's coordinates, got %s,%s", lat, lon)
+			}
+			io.WriteString(w, fakeForecast)
+		default:
+			t.Errorf("unexpected request for %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return newMetno(ProviderConfig{
+		Keys:    &query.Config{GeonamesID: "geo"},
+		Client:  srv.Client(),
+		Options: map[string]string{"base_url": srv.URL, "geonames_url": srv.URL},
+	}).(metno)
+}
+
+func TestMetnoCurrent(t *testing.T) {
+	t.Parallel()
+
+	m := fakeMetno(t)
+	tests := []struct {
+		units Units
+		want  string
+	}{
+		{Metric, "\x02Weather (\x02met.no\x02):\x02 Oslo, Norway \x02=>\x02 light rain, 5 °C, wind 3 m/s"},
+		{Imperial, "\x02Weather (\x02met.no\x02):\x02 Oslo, Norway \x02=>\x02 light rain, 41 °F, wind 8 mph"},
+	}
+
+	for _, test := range tests {
+		out, err := m.Current(context.Background(), "oslo", test.units)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if out != test.want {
+			t.Errorf("%s: want %q, got %q", test.units, test.want, out)
+		}
+	}
+}
+
+func TestMetnoForecast(t *testing.T) {
+	t.Parallel()
+
+	m := fakeMetno(t)
+	out, err := m.Forecast(context.Background(), "oslo", Metric, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\x02Forecast (\x02met.no\x02):\x02 Oslo, Norway \x02=>\x02 " +
+		"\x02Mon:\x02 partly cloudy 5 to 12 °C \x02Tue:\x02 heavy snow showers and thunder -3 to -3 °C"
+	if out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+}
+
+func TestMetnoNotFound(t *testing.T) {
+	t.Parallel()
+
+	m := fakeMetno(t)
+	out, err := m.Query(context.Background(), "atlantis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := notFound("atlantis"); out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	m.cfg.Keys = &query.Config{}
+	if _, err = m.Query(context.Background(), "oslo"); err == nil {
+		t.Error("want an error without geonames_id")
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]Units{
+		"metric": Metric, "C": Metric, "m": Metric,
+		"Imperial": Imperial, "f": Imperial, "fahrenheit": Imperial,
+		"kelvin": "",
+	}
+	for in, want := range tests {
+		got, ok := ParseUnits(in)
+		if got != want || ok != (len(want) != 0) {
+			t.Errorf("%s: want %q, got %q %v", in, want, got, ok)
+		}
+	}
+}
+
+func TestWeatherWithoutStore(t *testing.T) {
+	b := newStorelessBot(t, "")
+	q := Queryer{b: b}
+
+	var out bytes.Buffer
+	ev := &cmd.Event{
+		Event: irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG,
+			"nick!user@host", "#chan", ".weather"),
+		Args: map[string]string{},
+	}
+	if err := q.Weather(irc.Helper{Writer: &out}, ev); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Where?") {
+		t.Errorf("want to be asked where without a saved location, got %q", out.String())
+	}
+}
+
+func TestWeatherPrefsKeepEachOther(t *testing.T) {
+	b := newTestBot(t, "")
+	q := Queryer{b: b}
+
+	store := b.Store()
+	user, err := data.NewStoredUser("acct", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.SaveUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.AuthUserPerma("test", "nick!user@host", "acct", "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	weather := func(query string) error {
+		ev := &cmd.Event{
+			Event: irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG,
+				"nick!user@host", "#chan", ".weather "+query),
+			Args: map[string]string{"query": query},
+		}
+		return q.Weather(irc.Helper{Writer: io.Discard}, ev)
+	}
+
+	// Each change reads what's saved as it writes, so neither is lost.
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, query := range []string{"set oslo", "units imperial"} {
+		wg.Add(1)
+		go func(query string) {
+			defer wg.Done()
+			errs <- weather(query)
+		}(query)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user, err = store.FindUser("acct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prefs weatherPrefs
+	if _, err = user.GetJSON(weatherKey, &prefs); err != nil {
+		t.Fatal(err)
+	}
+	if prefs.Location != "oslo" || prefs.Units != Imperial {
+		t.Errorf("want both the location and units saved, got %+v", prefs)
+	}
+}
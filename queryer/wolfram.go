@@ -0,0 +1,84 @@
+package queryer
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const wolframURL = "https://api.wolframalpha.com"
+
+// wolfram asks wolfram alpha.
+type wolfram struct {
+	cfg ProviderConfig
+}
+
+func newWolfram(cfg ProviderConfig) Provider {
+	return wolfram{cfg: cfg}
+}
+
+func (wa wolfram) Query(ctx context.Context, search string) (string, error) {
+	appID := wa.cfg.Keys.WolframID
+	if len(appID) == 0 {
+		return "", errors.New("cannot use wolfram without wolfram_id")
+	}
+
+	vals := url.Values{
+		"format": {"plaintext"},
+		"input":  {search},
+		"appid":  {appID},
+	}
+	req, err := http.NewRequest(http.MethodGet, wa.cfg.BaseURL(wolframURL)+"/v2/query?"+vals.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := do(ctx, wa.cfg.Client, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError{name: "wolfram", status: resp.StatusCode}
+	}
+
+	var result struct {
+		Success     bool    `xml:"success,attr"`
+		ParseTiming float64 `xml:"parsetiming,attr"`
+		Pods        []struct {
+			PlainTexts []string `xml:"subpod>plaintext"`
+		} `xml:"pod"`
+		DidYouMeans []string `xml:"didyoumeans>didyoumean"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&result); err != nil {
+		return "", err
+	}
+
+	text := func(pod int) string {
+		if pod >= len(result.Pods) || len(result.Pods[pod].PlainTexts) == 0 {
+			return ""
+		}
+		return result.Pods[pod].PlainTexts[0]
+	}
+
+	switch {
+	case !result.Success && len(result.DidYouMeans) != 0:
+		return fmt.Sprintf("\x02Wolfram (\x02%.2fms\x02):\x02 Did you mean: %s",
+			result.ParseTiming, result.DidYouMeans[0]), nil
+	case !result.Success || len(text(0)) == 0:
+		return fmt.Sprintf("\x02Wolfram (\x02%.2fms\x02):\x02 No results found.",
+			result.ParseTiming), nil
+	case len(text(1)) == 0:
+		// No primary result so link to the full page instead.
+		return fmt.Sprintf("\x02Wolfram (\x02%.2fms\x02):\x02 %s \x02=>\x02 https://www.wolframalpha.com/input/?i=%s",
+			result.ParseTiming, text(0), url.QueryEscape(search)), nil
+	}
+
+	return fmt.Sprintf("\x02Wolfram (\x02%.2fms\x02):\x02 %s \x02=>\x02 %s",
+		result.ParseTiming, text(0), text(1)), nil
+}
@@ -0,0 +1,187 @@
+package queryer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	youtubeAPI = "https://www.googleapis.com"
+	// maxYoutubeLinks is how many links are expanded from a single line.
+	maxYoutubeLinks = 3
+)
+
+var (
+	rgxYoutube = regexp.MustCompile(
+		`https?://(?:www\.|m\.)?(youtube\.com|youtu\.be)/\S+`)
+	rgxISODuration = regexp.MustCompile(
+		`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+)
+
+// video is the information shown for a youtube link.
+type video struct {
+	Title    string
+	Channel  string
+	Duration time.Duration
+	Live     bool
+	Views    int64
+}
+
+func (v video) String() string {
+	length := v.Duration.String()
+	if v.Live {
+		length = "live"
+	}
+
+	return fmt.Sprintf("\x02YouTube (\x02%s\x02):\x02 %s \x02Channel:\x02 %s \x02Views:\x02 %s",
+		length, v.Title, v.Channel, thousands(v.Views))
+}
+
+// youtube looks up the videos linked in channels, the query is a video id.
+type youtube struct {
+	cfg ProviderConfig
+}
+
+func newYoutube(cfg ProviderConfig) Provider {
+	return youtube{cfg: cfg}
+}
+
+// Query returns the line shown for the video, or nothing if there's no such
+// video.
+func (y youtube) Query(ctx context.Context, id string) (string, error) {
+	v, err := y.lookup(ctx, id)
+	if err != nil || v == nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// videoIDs finds the ids of the youtube videos linked in msg.
+func videoIDs(msg string) []string {
+	var ids []string
+	for _, link := range rgxYoutube.FindAllStringSubmatch(msg, -1) {
+		uri, err := url.Parse(link[0])
+		if err != nil {
+			continue
+		}
+
+		var id string
+		switch {
+		case link[1] == "youtu.be":
+			id = strings.TrimPrefix(uri.Path, "/")
+		case strings.HasPrefix(uri.Path, "/shorts/"):
+			id = strings.TrimPrefix(uri.Path, "/shorts/")
+		default:
+			id = uri.Query().Get("v")
+		}
+
+		if len(id) == 0 {
+			continue
+		}
+
+		dupe := false
+		for _, have := range ids {
+			dupe = dupe || have == id
+		}
+		if !dupe {
+			ids = append(ids, id)
+		}
+		if len(ids) == maxYoutubeLinks {
+			break
+		}
+	}
+
+	return ids
+}
+
+// lookup fetches a video from the youtube api, it returns a nil video if
+// there's no such video.
+func (y youtube) lookup(ctx context.Context, id string) (*video, error) {
+	key := y.cfg.Keys.GoogleYoutubeKey
+	if len(key) == 0 {
+		return nil, errors.New("no youtube api key configured")
+	}
+
+	vals := url.Values{
+		"part": {"snippet,contentDetails,statistics"},
+		"id":   {id},
+		"key":  {key},
+	}
+	req, err := http.NewRequest(http.MethodGet, y.cfg.BaseURL(youtubeAPI)+"/youtube/v3/videos?"+vals.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Items []struct {
+			Snippet struct {
+				Title                string `json:"title"`
+				ChannelTitle         string `json:"channelTitle"`
+				LiveBroadcastContent string `json:"liveBroadcastContent"`
+			} `json:"snippet"`
+			ContentDetails struct {
+				Duration string `json:"duration"`
+			} `json:"contentDetails"`
+			Statistics struct {
+				ViewCount string `json:"viewCount"`
+			} `json:"statistics"`
+		} `json:"items"`
+	}
+	if err := getJSON(ctx, y.cfg.Client, "youtube", req, &list); err != nil {
+		return nil, err
+	}
+
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	item := list.Items[0]
+	v := &video{
+		Title:    sanitize(item.Snippet.Title),
+		Channel:  sanitize(item.Snippet.ChannelTitle),
+		Duration: parseISODuration(item.ContentDetails.Duration),
+		Live:     item.Snippet.LiveBroadcastContent == "live",
+	}
+	v.Views, _ = strconv.ParseInt(item.Statistics.ViewCount, 10, 64)
+
+	return v, nil
+}
+
+// parseISODuration parses the ISO 8601 durations youtube uses (PT1H2M3S).
+func parseISODuration(s string) time.Duration {
+	parts := rgxISODuration.FindStringSubmatch(s)
+	if parts == nil {
+		return 0
+	}
+
+	var dur time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		n, _ := strconv.Atoi(parts[i+1])
+		dur += time.Duration(n) * unit
+	}
+	return dur
+}
+
+// thousands formats n with commas between every three digits.
+func thousands(n int64) string {
+	if n < 0 {
+		return "-" + thousands(-n)
+	}
+	s := strconv.FormatInt(n, 10)
+
+	var b strings.Builder
+	for i, r := range s {
+		if i != 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
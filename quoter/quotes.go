@@ -6,12 +6,16 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/aarondl/quotes"
 	"github.com/aarondl/ultimateq/bot"
 	"github.com/aarondl/ultimateq/config"
 	"github.com/aarondl/ultimateq/dispatch/cmd"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
+	"github.com/aarondl/uq/settings"
 )
 
 const (
@@ -19,16 +23,24 @@ const (
 )
 
 func init() {
-	bot.RegisterExtension("quoter", new(Quoter))
+	ext.RegisterExtension("quoter", new(Quoter))
+	settings.Define("quoter", settings.Option{
+		Name:      "url",
+		ConfigKey: "quoteweb_url",
+		Desc:      "The url given out by the quoteweb command.",
+	})
 }
 
 // Quoter extension
 type Quoter struct {
-	WebListen    string
-	WebServerURL *url.URL
-	WebAuth      string
+	WebListen string
+	WebAuth   string
+
+	b   *bot.Bot
+	db  *quotes.QuoteDB
+	web *webPage
 
-	db *quotes.QuoteDB
+	mut sync.RWMutex
 
 	quoteID     uint64
 	quotesID    uint64
@@ -49,41 +61,27 @@ func (q *Quoter) Cmd(_ string, _ irc.Writer, _ *cmd.Event) error {
 
 // Init the extension
 func (q *Quoter) Init(b *bot.Bot) error {
-	var uri string
-	b.ReadConfig(func(cfg *config.Config) {
-		q.WebListen, _ = cfg.ExtGlobal().ConfigVal("", "", "quoteweb_listen")
-		uri, _ = cfg.ExtGlobal().ConfigVal("", "", "quoteweb_url")
-		q.WebAuth, _ = cfg.ExtGlobal().ConfigVal("", "", "quoteweb_auth")
-	})
-
-	if len(uri) != 0 {
-		var err error
-		q.WebServerURL, err = url.Parse(uri)
-		if err != nil {
-			return fmt.Errorf("failed to parse quoteweb_url", err)
-		}
+	q.b = b
 
-		if len(q.WebAuth) != 0 {
-			splits := strings.SplitN(q.WebAuth, ":", 2)
-			if len(splits) != 2 {
-				return fmt.Errorf("failed to split quoteweb_auth into two parts")
-			}
-
-			q.WebServerURL.User = url.UserPassword(splits[0], splits[1])
-		}
+	qdb, err := quotes.OpenDB("quotes.sqlite3", "")
+	if err != nil {
+		return err
 	}
+	q.db, q.web = qdb, newWebPage(qdb)
 
-	qdb, err := quotes.OpenDB("quotes.sqlite3", q.WebAuth)
-	if err != nil {
+	if err = q.loadConfig(b); err != nil {
+		qdb.Close()
 		return err
 	}
 
-	q.db = qdb
-	if len(q.WebListen) != 0 {
-		qdb.StartServer(q.WebListen)
+	// fail undoes the setup when a command can't be registered.
+	fail := func(err error) error {
+		q.web.stop()
+		qdb.Close()
+		return err
 	}
 
-	q.quoteID, err = b.RegisterCmd("", "", cmd.New(
+	q.quoteID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"quote",
 		"quote",
 		"Retrieves a quote. Randomly selects a quote if no id is provided.",
@@ -91,9 +89,9 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		cmd.Privmsg, cmd.AnyScope, "[id]",
 	))
 	if err != nil {
-		return nil
+		return fail(err)
 	}
-	q.quotesID, err = b.RegisterCmd("", "", cmd.New(
+	q.quotesID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"quote",
 		"quotes",
 		"Shows the number of quotes in the database.",
@@ -101,9 +99,9 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		cmd.Privmsg, cmd.AnyScope,
 	))
 	if err != nil {
-		return nil
+		return fail(err)
 	}
-	q.infoID, err = b.RegisterCmd("", "", cmd.New(
+	q.infoID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"quote",
 		"info",
 		"Gets the details for a specific quote.",
@@ -111,9 +109,9 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		cmd.Privmsg, cmd.AnyScope, "id",
 	))
 	if err != nil {
-		return nil
+		return fail(err)
 	}
-	q.addQuoteID, err = b.RegisterCmd("", "", cmd.New(
+	q.addQuoteID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"quote",
 		"addquote",
 		"Adds a quote to the database.",
@@ -121,9 +119,9 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		cmd.Privmsg, cmd.Public, "quote...",
 	))
 	if err != nil {
-		return nil
+		return fail(err)
 	}
-	q.delQuoteID, err = b.RegisterCmd("", "", cmd.NewAuthed(
+	q.delQuoteID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
 		"quote",
 		"delquote",
 		"Removes a quote from the database.",
@@ -131,9 +129,9 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		cmd.Privmsg, cmd.AnyScope, 0, "Q", "id",
 	))
 	if err != nil {
-		return nil
+		return fail(err)
 	}
-	q.editQuoteID, err = b.RegisterCmd("", "", cmd.NewAuthed(
+	q.editQuoteID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
 		"quote",
 		"editquote",
 		"Edits an existing quote.",
@@ -141,9 +139,9 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		cmd.Privmsg, cmd.AnyScope, 0, "Q", "id", "quote...",
 	))
 	if err != nil {
-		return nil
+		return fail(err)
 	}
-	q.quoteWebID, err = b.RegisterCmd("", "", cmd.New(
+	q.quoteWebID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"quote",
 		"quoteweb",
 		"Shows the address for the quote webserver.",
@@ -151,9 +149,9 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		cmd.Privmsg, cmd.AnyScope,
 	))
 	if err != nil {
-		return nil
+		return fail(err)
 	}
-	q.upvoteID, err = b.RegisterCmd("", "", cmd.New(
+	q.upvoteID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"quote",
 		"up",
 		"Upvotes a quote",
@@ -162,9 +160,9 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		"id",
 	))
 	if err != nil {
-		return nil
+		return fail(err)
 	}
-	q.downvoteID, err = b.RegisterCmd("", "", cmd.New(
+	q.downvoteID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"quote",
 		"down",
 		"Downvotes a quote",
@@ -173,9 +171,9 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		"id",
 	))
 	if err != nil {
-		return nil
+		return fail(err)
 	}
-	q.unvoteID, err = b.RegisterCmd("", "", cmd.New(
+	q.unvoteID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"quote",
 		"unvote",
 		"Unvotes a quote",
@@ -184,25 +182,81 @@ func (q *Quoter) Init(b *bot.Bot) error {
 		"id",
 	))
 	if err != nil {
-		return nil
+		return fail(err)
+	}
+
+	return nil
+}
+
+// Rehash applies changes to the quoteweb settings.
+func (q *Quoter) Rehash(b *bot.Bot) error {
+	return q.loadConfig(b)
+}
+
+// loadConfig reads the quoteweb settings and (re)binds the web server.
+func (q *Quoter) loadConfig(b *bot.Bot) error {
+	var listen, auth string
+	b.ReadConfig(func(cfg *config.Config) {
+		listen, _ = cfg.ExtGlobal().ConfigVal("", "", "quoteweb_listen")
+		auth, _ = cfg.ExtGlobal().ConfigVal("", "", "quoteweb_auth")
+	})
+
+	if len(auth) != 0 && !strings.Contains(auth, ":") {
+		return fmt.Errorf("failed to split quoteweb_auth into two parts")
+	}
+	if _, err := url.Parse(settings.String(b, "", "", "quoter", "url")); err != nil {
+		return fmt.Errorf("failed to parse quoteweb_url: %v", err)
+	}
+
+	if err := q.web.serve(listen, auth); err != nil {
+		return fmt.Errorf("failed to start quote web server: %v", err)
 	}
 
+	q.mut.Lock()
+	q.WebListen, q.WebAuth = listen, auth
+	q.mut.Unlock()
+
 	return nil
 }
 
+// serverURL is the url of the quote web server for the channel with the
+// credentials filled in, nil if there's none.
+func (q *Quoter) serverURL(network, channel string) (*url.URL, error) {
+	uri := settings.String(q.b, network, channel, "quoter", "url")
+	if len(uri) == 0 {
+		return nil, nil
+	}
+
+	serverURL, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mut.RLock()
+	auth := q.WebAuth
+	q.mut.RUnlock()
+
+	if splits := strings.SplitN(auth, ":", 2); len(splits) == 2 {
+		serverURL.User = url.UserPassword(splits[0], splits[1])
+	}
+	return serverURL, nil
+}
+
 // Deinit the extension
 func (q *Quoter) Deinit(b *bot.Bot) error {
 	defer q.db.Close()
-
-	b.UnregisterCmd(q.quotesID)
-	b.UnregisterCmd(q.infoID)
-	b.UnregisterCmd(q.addQuoteID)
-	b.UnregisterCmd(q.delQuoteID)
-	b.UnregisterCmd(q.editQuoteID)
-	b.UnregisterCmd(q.quoteWebID)
-	b.UnregisterCmd(q.upvoteID)
-	b.UnregisterCmd(q.downvoteID)
-	b.UnregisterCmd(q.unvoteID)
+	defer q.web.stop()
+
+	ext.UnregisterCmd(b, q.quoteID)
+	ext.UnregisterCmd(b, q.quotesID)
+	ext.UnregisterCmd(b, q.infoID)
+	ext.UnregisterCmd(b, q.addQuoteID)
+	ext.UnregisterCmd(b, q.delQuoteID)
+	ext.UnregisterCmd(b, q.editQuoteID)
+	ext.UnregisterCmd(b, q.quoteWebID)
+	ext.UnregisterCmd(b, q.upvoteID)
+	ext.UnregisterCmd(b, q.downvoteID)
+	ext.UnregisterCmd(b, q.unvoteID)
 
 	return nil
 }
@@ -299,8 +353,9 @@ func (q *Quoter) Quote(w irc.Writer, ev *cmd.Event) error {
 	if len(quote.Quote) == 0 {
 		w.Notify(ev.Event, nick, "\x02Quote:\x02 Does not exist.")
 	} else {
-		w.Notifyf(ev.Event, nick, "\x02Quote (\x02#%d|%+d\x02):\x02 %s",
-			quote.ID, quote.Upvotes-quote.Downvotes, quote.Quote)
+		ircmsg.Notify(q.b, w, ev.Event, nick, fmt.Sprintf(
+			"\x02Quote (\x02#%d|%+d\x02):\x02 %s",
+			quote.ID, quote.Upvotes-quote.Downvotes, quote.Quote))
 	}
 	return nil
 }
@@ -346,11 +401,20 @@ func (q *Quoter) Info(w irc.Writer, ev *cmd.Event) error {
 
 // Quoteweb provides a server to see the quotes
 func (q *Quoter) Quoteweb(w irc.Writer, ev *cmd.Event) error {
-	if q.WebServerURL == nil {
+	var channel string
+	if ev.IsTargetChan() {
+		channel = ev.Target()
+	}
+
+	serverURL, err := q.serverURL(ev.NetworkID, channel)
+	if err != nil {
+		return err
+	}
+	if serverURL == nil {
 		w.Notify(ev.Event, ev.Nick(), "\x02Quote:\x02 No quote server running")
 		return nil
 	}
-	w.Notify(ev.Event, ev.Nick(), "\x02Quote:\x02 "+q.WebServerURL.String())
+	w.Notify(ev.Event, ev.Nick(), "\x02Quote:\x02 "+serverURL.String())
 	return nil
 }
 
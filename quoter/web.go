@@ -0,0 +1,171 @@
+package quoter
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/quotes"
+	"github.com/aarondl/uq/webserver"
+)
+
+// webPage serves the quotes as a web page. The quotes package has a server of
+// its own but it can't be stopped, moved or given a listener, so the page is
+// served here on a server that can be rebound and have its auth changed at
+// will.
+type webPage struct {
+	db *quotes.QuoteDB
+
+	mut  sync.RWMutex
+	user string
+	pass string
+
+	web *webserver.Server
+}
+
+func newWebPage(db *quotes.QuoteDB) *webPage {
+	p := &webPage{db: db}
+	p.web = webserver.New(p)
+	return p
+}
+
+// serve starts listening on listen if it's changed, an empty listen stops the
+// server. auth is in user:pass form and can be empty to allow anyone in.
+func (p *webPage) serve(listen, auth string) error {
+	p.mut.Lock()
+	p.user, p.pass = "", ""
+	if splits := strings.SplitN(auth, ":", 2); len(splits) == 2 {
+		p.user, p.pass = splits[0], splits[1]
+	}
+	p.mut.Unlock()
+
+	return p.web.Serve(listen)
+}
+
+// stop the server if it's running.
+func (p *webPage) stop() error {
+	return p.web.Stop()
+}
+
+// ServeHTTP checks the credentials and lists the quotes. all=true shows the
+// ones voted down too and votesort=true puts the best voted first.
+func (p *webPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mut.RLock()
+	user, pass := p.user, p.pass
+	p.mut.RUnlock()
+
+	if len(user) != 0 {
+		u, pw, ok := r.BasicAuth()
+		if !ok || !equal(u, user) || !equal(pw, pass) {
+			w.Header().Set("WWW-Authenticate", "Basic realm=Quotes")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	all := query.Get("all") == "true"
+	list, err := p.db.GetAll(!all)
+	if err != nil {
+		http.Error(w, "failed to get the quotes", http.StatusInternalServerError)
+		return
+	}
+	if query.Get("votesort") == "true" {
+		sort.SliceStable(list, func(i, j int) bool {
+			iv, jv := list[i].Upvotes-list[i].Downvotes, list[j].Upvotes-list[j].Downvotes
+			return iv > jv || (iv == jv && list[i].ID > list[j].ID)
+		})
+	}
+
+	allQuery, sortQuery := withParam(query, "all"), withParam(query, "votesort")
+	data := struct {
+		Quotes   []quotes.Quote
+		AllHref  string
+		SortHref string
+	}{list, "/?" + allQuery, "/?" + sortQuery}
+
+	var buf bytes.Buffer
+	if err = pageTmpl.Execute(&buf, data); err != nil {
+		http.Error(w, "failed to show the quotes", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// withParam encodes query with param set to true.
+func withParam(query url.Values, param string) string {
+	vals := make(url.Values, len(query)+1)
+	for k, v := range query {
+		vals[k] = v
+	}
+	vals[param] = []string{"true"}
+	return vals.Encode()
+}
+
+// quoteLines splits a quote of several irc lines, like "<a> hi <b> hey", into
+// one line for each speaker.
+var quoteLines = regexp.MustCompile(`<[^>]+>[^<]+`)
+
+func splitQuote(quote string) []string {
+	if lines := quoteLines.FindAllString(quote, -1); lines != nil {
+		return lines
+	}
+	return []string{quote}
+}
+
+var pageTmpl = template.Must(template.New("quotes").Funcs(template.FuncMap{
+	"date":  func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"votes": func(q quotes.Quote) int { return q.Upvotes - q.Downvotes },
+	"lines": splitQuote,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Quotes</title>
+<style>
+body { font-family: sans-serif; color: #aaafb6; background-color: #5f6b7b; }
+a { color: #294977; }
+.container { width: 80%; margin: 50px auto; }
+table { width: 100%; border-collapse: collapse; background-color: rgba(0,0,0,0.3); }
+thead td { font-weight: bold; background-color: rgba(255,255,255,0.1); }
+td { vertical-align: top; padding: 0 6px; border-bottom: solid 1px rgba(0,0,0,0.1); }
+.footer { margin-top: 20px; text-align: center; }
+</style>
+</head>
+<body>
+<div class="container">
+{{- if .Quotes}}
+<h1>Quotes (<a href="{{.AllHref}}">show all</a>) (<a href="{{.SortHref}}">votesort</a>)</h1>
+<table>
+<thead><tr><td>ID</td><td>Votes</td><td>Quote</td><td>Author</td><td>Date</td><td>Up</td><td>Down</td></tr></thead>
+<tbody>
+{{- range .Quotes}}
+<tr><td>{{.ID}}</td><td>{{votes .}}</td><td>{{range $i, $l := lines .Quote}}{{if $i}}<br>{{end}}{{$l}}{{end}}</td><td>{{.Author}}</td><td>{{date .Date}}</td><td>{{.Upvotes}}</td><td>{{.Downvotes}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<div class="footer">{{len .Quotes}} quotes.</div>
+{{- else}}
+<p>There are no quotes yet (<a href="{{.AllHref}}">show all</a>).</p>
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,114 @@
+package quoter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/quotes"
+)
+
+func newTestPage(t *testing.T) *webPage {
+	t.Helper()
+
+	db, err := quotes.OpenDB(filepath.Join(t.TempDir(), "quotes.sqlite3"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, quote := range []string{"best", "second", "<a> hi & <b> bye"} {
+		if _, err := db.AddQuote("author", quote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Upvote(1, "voter"); err != nil {
+		t.Fatal(err)
+	}
+
+	return newWebPage(db)
+}
+
+func get(t *testing.T, p *webPage, target, user, pass string) (int, string) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if len(user) != 0 {
+		r.SetBasicAuth(user, pass)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, string(body)
+}
+
+func TestWebPage(t *testing.T) {
+	t.Parallel()
+
+	p := newTestPage(t)
+
+	code, body := get(t, p, "/", "", "")
+	if code != http.StatusOK {
+		t.Fatalf("want 200, got %d: %s", code, body)
+	}
+	if !strings.Contains(body, "&lt;a&gt; hi &amp; <br>&lt;b&gt; bye") {
+		t.Errorf("want the quote escaped with a line for each speaker, got %s", body)
+	}
+	if !strings.Contains(body, "3 quotes.") {
+		t.Errorf("want the number of quotes, got %s", body)
+	}
+	if second, best := strings.Index(body, "second"), strings.Index(body, "best"); best < second {
+		t.Error("want the newest quotes first without votesort")
+	}
+
+	_, body = get(t, p, "/?votesort=true", "", "")
+	if second, best := strings.Index(body, "second"), strings.Index(body, "best"); best > second {
+		t.Error("want the best voted quote first with votesort")
+	}
+	if !strings.Contains(body, `href="/?all=true&amp;votesort=true"`) {
+		t.Errorf("want the show all link to keep votesort, got %s", body)
+	}
+
+	if code, _ = get(t, p, "/other", "", ""); code != http.StatusNotFound {
+		t.Errorf("want 404 for other paths, got %d", code)
+	}
+}
+
+func TestWebPageAuth(t *testing.T) {
+	t.Parallel()
+
+	p := newTestPage(t)
+	if err := p.serve("", "user:pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, pass string
+		want       int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"user", "wrong", http.StatusUnauthorized},
+		{"other", "pass", http.StatusUnauthorized},
+		{"user", "pass", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		if code, _ := get(t, p, "/", test.user, test.pass); code != test.want {
+			t.Errorf("%s:%s: want %d, got %d", test.user, test.pass, test.want, code)
+		}
+	}
+
+	if err := p.serve("", ""); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := get(t, p, "/", "", ""); code != http.StatusOK {
+		t.Errorf("want anyone let in without auth, got %d", code)
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aarondl/ultimateq/bot"
 	"github.com/aarondl/ultimateq/dispatch/cmd"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
 	"github.com/bradj/remindme"
 )
 
@@ -17,13 +20,22 @@ const (
 )
 
 func init() {
-	bot.RegisterExtension("remindme", &Reminder{})
+	ext.RegisterExtension("remindme", &Reminder{})
 }
 
 // Reminder extension
 type Reminder struct {
+	// db can't be stopped once it's waiting for reminders, so it's made once
+	// and kept across reloads along with the reminders still pending.
 	db *remindme.DB
 
+	mut sync.Mutex
+	// b is who expired reminders are sent through, nil while unloaded.
+	b *bot.Bot
+	// pending are the reminders that expired while unloaded, they're sent
+	// on the next Init.
+	pending []remindme.Reminder
+
 	cmdRemindme uint64
 }
 
@@ -36,9 +48,23 @@ func (r *Reminder) Cmd(_ string, _ irc.Writer, _ *cmd.Event) error {
 func (r *Reminder) Init(b *bot.Bot) error {
 	var err error
 
-	r.db = remindme.New()
+	r.mut.Lock()
+	r.b = b
+	pending := r.pending
+	r.pending = nil
+	r.mut.Unlock()
+
+	for _, rem := range pending {
+		r.deliver(b, rem)
+	}
+
+	if r.db == nil {
+		r.db = remindme.New()
+		go r.db.WaitForReminders()
+		go r.Listener()
+	}
 
-	r.cmdRemindme, err = b.RegisterCmd("", "", cmd.New(
+	r.cmdRemindme, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"remindme",
 		"remindme",
 		"Sets a reminder that is associated with your current nick.",
@@ -47,33 +73,60 @@ func (r *Reminder) Init(b *bot.Bot) error {
 	))
 
 	if err != nil {
-		return nil
+		// Keep reminders that expire from here on until it's loaded.
+		r.mut.Lock()
+		r.b = nil
+		r.mut.Unlock()
+		return err
 	}
 
-	go r.db.WaitForReminders()
-	go r.Listener(b)
-
 	return nil
 }
 
 // Listener listens for expired reminders
-func (r *Reminder) Listener(b *bot.Bot) {
+func (r *Reminder) Listener() {
 	for rem := range r.db.ExpiredReminders {
-		fmt.Println(rem)
-		w := b.NetworkWriter(rem.Network)
+		r.mut.Lock()
+		b := r.b
+		if b == nil {
+			// Unloaded, keep it until there's a bot to send it through.
+			r.pending = append(r.pending, rem)
+		}
+		r.mut.Unlock()
 
-		if len(rem.Channel) == 0 {
-			w.Noticef(rem.Author, "\x02Remindme:\x02 %v", rem.Body)
-			continue
+		if b != nil {
+			r.deliver(b, rem)
 		}
+	}
+}
+
+// deliver sends an expired reminder to the channel it was set in, or to its
+// author when it was set in private.
+func (r *Reminder) deliver(b *bot.Bot, rem remindme.Reminder) {
+	w := b.NetworkWriter(rem.Network)
+	if w == nil {
+		b.Logger.Error("remindme: dropped reminder for unknown network",
+			"network", rem.Network, "author", rem.Author)
+		return
+	}
 
-		w.Privmsgf(rem.Channel, "\x02Remindme (\x02%s\x02):\x02 %s", rem.Author, rem.Body)
+	if len(rem.Channel) == 0 {
+		ircmsg.Notice(b, w, rem.Network, rem.Author,
+			"\x02Remindme:\x02 "+rem.Body)
+		return
 	}
+
+	ircmsg.Privmsg(b, w, rem.Network, rem.Channel,
+		fmt.Sprintf("\x02Remindme (\x02%s\x02):\x02 %s", rem.Author, rem.Body))
 }
 
 // Deinit the extension
 func (r *Reminder) Deinit(b *bot.Bot) error {
-	b.UnregisterCmd(r.cmdRemindme)
+	ext.UnregisterCmd(b, r.cmdRemindme)
+
+	r.mut.Lock()
+	r.b = nil
+	r.mut.Unlock()
 
 	return nil
 }
@@ -102,8 +155,6 @@ func (r *Reminder) Remindme(w irc.Writer, ev *cmd.Event) error {
 		channel = ev.Event.Target()
 	}
 
-	fmt.Println("channel", ev.Event.Target(), ev.Event.IsTargetChan())
-
 	r.db.Add(remindme.Reminder{
 		Author:  nick,
 		Body:    message,
@@ -2,53 +2,123 @@ package runnable
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
 	"github.com/aarondl/ultimateq/dispatch/cmd"
 	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
+)
+
+const (
+	sandboxGOOS   = "nacl"
+	sandboxGOARCH = "amd64p32"
+
+	// maxBinAge is how long a cached binary is kept after it was last run.
+	maxBinAge = 7 * 24 * time.Hour
+	// maxBinBytes is how big the binary cache can get before the least
+	// recently run binaries are removed.
+	maxBinBytes = 256 << 20
 )
 
 func init() {
-	bot.RegisterExtension("runnable", &Runnable{})
+	ext.RegisterExtension("runnable", &Runnable{})
 }
 
 // Runnable extension
 type Runnable struct {
+	b *bot.Bot
+
 	goID  uint64
 	gopID uint64
+
+	// cacheDir holds the compiled binaries keyed by the hash of their
+	// source as well as the GOCACHE and module cache used for sandbox builds.
+	cacheDir string
+	// goVersion is the version of the go command that builds the binaries,
+	// a new toolchain must not run binaries cached by an old one.
+	goVersion string
+	// cancel stops the build cache warm up if it's still going at Deinit.
+	cancel context.CancelFunc
 }
 
 // Init the extension
 func (r *Runnable) Init(b *bot.Bot) error {
-	b.RegisterCmd("", "", cmd.New(
+	r.b = b
+
+	b.ReadConfig(func(cfg *config.Config) {
+		r.cacheDir, _ = cfg.ExtGlobal().ConfigVal("", "", "runnable_cache")
+	})
+	if len(r.cacheDir) == 0 {
+		r.cacheDir = filepath.Join(os.TempDir(), "uq-runnable")
+	}
+
+	for _, dir := range []string{r.binDir(), r.goCacheDir(), r.modCacheDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create runnable cache: %v", err)
+		}
+	}
+
+	if err := pruneBins(r.binDir(), time.Now()); err != nil {
+		b.Logger.Error("runnable: failed to prune binary cache", "err", err)
+	}
+
+	r.goVersion = runtime.Version()
+	if out, err := exec.Command("go", "env", "GOVERSION").Output(); err == nil {
+		r.goVersion = strings.TrimSpace(string(out))
+	} else {
+		b.Logger.Error("runnable: failed to get go version", "err", err)
+	}
+
+	var err error
+	r.goID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"runnable",
 		"go",
 		"Runs a snippet of sandboxed go code.",
 		r,
 		cmd.Privmsg, cmd.AnyScope, "code...",
 	))
-	b.RegisterCmd("", "", cmd.New(
+	if err != nil {
+		return err
+	}
+	r.gopID, err = ext.RegisterCmd(b, "", "", cmd.New(
 		"runnable",
 		"gop",
 		"Runs a snippet of sandboxed go code inside fmt.Println().",
 		r,
 		cmd.Privmsg, cmd.AnyScope, "code...",
 	))
+	if err != nil {
+		return err
+	}
+
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+	go r.warmCache(ctx)
 
 	return nil
 }
 
 // Deinit the extension
 func (r Runnable) Deinit(b *bot.Bot) error {
-	b.UnregisterCmd(r.goID)
-	b.UnregisterCmd(r.gopID)
+	if r.cancel != nil {
+		r.cancel()
+	}
+	ext.UnregisterCmd(b, r.goID)
+	ext.UnregisterCmd(b, r.gopID)
 	return nil
 }
 
@@ -58,29 +128,109 @@ func (Runnable) Cmd(_ string, _ irc.Writer, _ *cmd.Event) error {
 }
 
 // Go runs code in main.
-func (Runnable) Go(w irc.Writer, ev *cmd.Event) error {
-	return sandboxGo(w, ev, "package main\n\nfunc main() {\n%s\n}")
+func (r Runnable) Go(w irc.Writer, ev *cmd.Event) error {
+	return r.sandboxGo(w, ev, "package main\n\nfunc main() {\n%s\n}")
 }
 
 // Gop runs code in main inside a fmt.Println()
-func (Runnable) Gop(w irc.Writer, ev *cmd.Event) error {
-	return sandboxGo(w, ev, "package main\n\nfunc main() {\nfmt.Println(%s)\n}")
+func (r Runnable) Gop(w irc.Writer, ev *cmd.Event) error {
+	return r.sandboxGo(w, ev, "package main\n\nfunc main() {\nfmt.Println(%s)\n}")
+}
+
+func (r Runnable) binDir() string      { return filepath.Join(r.cacheDir, "bin") }
+func (r Runnable) goCacheDir() string  { return filepath.Join(r.cacheDir, "gocache") }
+func (r Runnable) modCacheDir() string { return filepath.Join(r.cacheDir, "mod") }
+
+// buildEnv is the environment for every go command run on behalf of the
+// sandbox, it keeps the build and module caches around between runs.
+func (r Runnable) buildEnv() []string {
+	return append(os.Environ(),
+		"GOOS="+sandboxGOOS,
+		"GOARCH="+sandboxGOARCH,
+		"GOCACHE="+r.goCacheDir(),
+		"GOMODCACHE="+r.modCacheDir(),
+	)
+}
+
+// warmStamp is the file in the cache that records which toolchain and
+// target the build cache was last warmed for.
+func (r Runnable) warmStamp() string { return filepath.Join(r.cacheDir, "warm") }
+
+// warmKey is what the warm stamp holds once the build cache is warm.
+func (r Runnable) warmKey() string {
+	return fmt.Sprintf("%s %s/%s\n", r.goVersion, sandboxGOOS, sandboxGOARCH)
+}
+
+// warmCache builds the standard library into the build cache so the first
+// snippet to import something common doesn't pay for compiling it. It only
+// happens once per cache and toolchain, reloading the extension must not
+// start another full build every time.
+func (r Runnable) warmCache(ctx context.Context) {
+	if stamp, err := os.ReadFile(r.warmStamp()); err == nil && string(stamp) == r.warmKey() {
+		return
+	}
+
+	list, err := exec.CommandContext(ctx, "go", "tool", "dist", "list").Output()
+	if err != nil {
+		if ctx.Err() == nil {
+			r.b.Logger.Error("runnable: failed to list go targets", "err", err)
+		}
+		return
+	}
+
+	// A toolchain without the target can't build anything for the sandbox,
+	// say so once and remember it rather than failing on every load.
+	if supportsTarget(list, sandboxGOOS, sandboxGOARCH) {
+		warm := exec.CommandContext(ctx, "go", "build", "std")
+		warm.Env = r.buildEnv()
+		if out, err := warm.CombinedOutput(); err != nil {
+			if ctx.Err() == nil {
+				r.b.Logger.Error("runnable: failed to warm build cache",
+					"err", err, "out", string(out))
+			}
+			return
+		}
+	} else {
+		r.b.Logger.Error("runnable: go can't build for the sandbox",
+			"go", r.goVersion, "target", sandboxGOOS+"/"+sandboxGOARCH)
+	}
+
+	if err := os.WriteFile(r.warmStamp(), []byte(r.warmKey()), 0644); err != nil {
+		r.b.Logger.Error("runnable: failed to write warm stamp", "err", err)
+	}
+}
+
+// supportsTarget checks the output of go tool dist list for goos/goarch.
+func supportsTarget(list []byte, goos, goarch string) bool {
+	target := goos + "/" + goarch
+	for _, line := range strings.Split(string(list), "\n") {
+		if strings.TrimSpace(line) == target {
+			return true
+		}
+	}
+	return false
 }
 
-func sandboxGo(w irc.Writer, ev *cmd.Event, basecode string) error {
+// binaryFor returns the path in the cache that a binary built from src
+// should live at.
+func (r Runnable) binaryFor(src []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s/%s\n", r.goVersion, sandboxGOOS, sandboxGOARCH)
+	h.Write(src)
+	return filepath.Join(r.binDir(), hex.EncodeToString(h.Sum(nil)))
+}
+
+func (r Runnable) sandboxGo(w irc.Writer, ev *cmd.Event, basecode string) error {
 	var err error
 	var f *os.File
 
 	code := ev.Args["code"]
 	nick := ev.Nick()
-	targ := ev.Target()
 
 	tmp := os.TempDir()
 	frand := rand.Uint32()
 	srcfile := filepath.Join(tmp, fmt.Sprintf("%d.go", frand))
-	exefile := filepath.Join(tmp, fmt.Sprintf("%d", frand))
 	defer os.Remove(srcfile)
-	defer os.Remove(exefile)
 
 	f, err = os.Create(srcfile)
 	if err != nil {
@@ -102,7 +252,8 @@ func sandboxGo(w irc.Writer, ev *cmd.Event, basecode string) error {
 	putStdErr := func(msg string, buf *bytes.Buffer, e error) {
 		errMsg := strings.Replace(e.Error(), "\n", "; ", -1)
 		outmsg := bytes.Replace(buf.Bytes(), []byte{'\n'}, []byte{';', ' '}, -1)
-		w.Notifyf(ev.Event, nick, "\x02go:\x02 %s: %v; %s", msg, errMsg, outmsg)
+		ircmsg.NotifyN(r.b, w, ev.Event, nick,
+			fmt.Sprintf("\x02go:\x02 %s: %v; %s", msg, errMsg, outmsg), 2)
 	}
 
 	goimps := exec.Command("goimports", "-w", srcfile)
@@ -113,16 +264,44 @@ func sandboxGo(w irc.Writer, ev *cmd.Event, basecode string) error {
 	}
 	stderr.Reset()
 
-	build := exec.Command("go", "build", "-o", exefile, srcfile)
-	build.Env = os.Environ()
-	build.Env = append(build.Env, "GOOS=nacl")
-	build.Env = append(build.Env, "GOARCH=amd64p32")
-	build.Stderr = stderr
-	if err = build.Run(); err != nil {
-		putStdErr("Failed to compile", stderr, err)
-		return nil
+	src, err := os.ReadFile(srcfile)
+	if err != nil {
+		return err
+	}
+
+	// Identical snippets (after goimports) share a binary, only build when
+	// it's not already been built before.
+	exefile := r.binaryFor(src)
+	_, err = os.Stat(exefile)
+	switch {
+	case os.IsNotExist(err):
+		// Build beside the final location and rename into place so a
+		// concurrent run can never execute a half written binary.
+		tmpexe := fmt.Sprintf("%s.%d", exefile, frand)
+		defer os.Remove(tmpexe)
+
+		build := exec.Command("go", "build", "-o", tmpexe, srcfile)
+		build.Env = r.buildEnv()
+		build.Stderr = stderr
+		if err = build.Run(); err != nil {
+			putStdErr("Failed to compile", stderr, err)
+			return nil
+		}
+		stderr.Reset()
+
+		if err = os.Rename(tmpexe, exefile); err != nil {
+			return err
+		}
+		if err = pruneBins(r.binDir(), time.Now()); err != nil {
+			r.b.Logger.Error("runnable: failed to prune binary cache", "err", err)
+		}
+	case err != nil:
+		return err
+	default:
+		// The modification time is when it was last run, for pruning.
+		now := time.Now()
+		os.Chtimes(exefile, now, now)
 	}
-	stderr.Reset()
 
 	run := exec.Command("sel_ldr_x86_64", exefile)
 	run.Stderr = stderr
@@ -153,12 +332,54 @@ func sandboxGo(w irc.Writer, ev *cmd.Event, basecode string) error {
 
 	outbytes := bytes.Replace(stdout.Bytes(), []byte{1}, []byte{}, -1)
 	out := fmt.Sprintf("\x02go:\x02 %s", outbytes)
-	// ircmaxlen - maxhostsize - PRIVMSG - targetsize - spacing - colons
-	maxlen := 2 * (510 - 62 - 7 - len(targ) - 3 - 2)
-	if len(out) > maxlen {
-		out = out[:maxlen-3]
-		out += "..."
+	ircmsg.NotifyN(r.b, w, ev.Event, nick, out, 2)
+	return nil
+}
+
+// pruneBins removes cached binaries that haven't been run in maxBinAge and
+// then the least recently run ones until the cache fits in maxBinBytes.
+func pruneBins(dir string, now time.Time) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
 	}
-	w.Notifyf(ev.Event, nick, out)
+
+	var bins []os.FileInfo
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		if now.Sub(info.ModTime()) > maxBinAge {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		// Binaries still being built have a random suffix, leave them to
+		// the build unless it died and left them behind.
+		if strings.ContainsRune(entry.Name(), '.') {
+			continue
+		}
+
+		bins = append(bins, info)
+		total += info.Size()
+	}
+
+	sort.Slice(bins, func(i, j int) bool {
+		return bins[i].ModTime().Before(bins[j].ModTime())
+	})
+	for _, info := range bins {
+		if total <= maxBinBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= info.Size()
+	}
+
 	return nil
 }
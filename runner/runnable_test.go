@@ -0,0 +1,133 @@
+package runnable
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeBin makes a cached binary of size bytes that was last run at when.
+func writeBin(t *testing.T, dir, name string, size int64, when time.Time) {
+	t.Helper()
+	filename := filepath.Join(dir, name)
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(filename, when, when); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(dir, name string) bool {
+	_, err := os.Stat(filepath.Join(dir, name))
+	return err == nil
+}
+
+func TestPruneBinsByAge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeBin(t, dir, "old", 10, now.Add(-maxBinAge-time.Hour))
+	writeBin(t, dir, "new", 10, now.Add(-time.Hour))
+	writeBin(t, dir, "new.123", 10, now)
+	writeBin(t, dir, "dead.456", 10, now.Add(-maxBinAge-time.Hour))
+
+	if err := pruneBins(dir, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{
+		"old": false, "new": true, "new.123": true, "dead.456": false,
+	} {
+		if got := exists(dir, name); got != want {
+			t.Errorf("%s: want exists %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestPruneBinsBySize(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	third := int64(maxBinBytes / 3)
+
+	writeBin(t, dir, "a", third, now.Add(-4*time.Hour))
+	writeBin(t, dir, "b", third, now.Add(-3*time.Hour))
+	writeBin(t, dir, "c", third, now.Add(-2*time.Hour))
+	writeBin(t, dir, "d", third, now.Add(-time.Hour))
+
+	if err := pruneBins(dir, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{
+		"a": false, "b": true, "c": true, "d": true,
+	} {
+		if got := exists(dir, name); got != want {
+			t.Errorf("%s: want exists %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestBinaryFor(t *testing.T) {
+	r := Runnable{cacheDir: "cache", goVersion: "go1.20"}
+	src := []byte("package main")
+
+	bin := r.binaryFor(src)
+	if dir := filepath.Dir(bin); dir != r.binDir() {
+		t.Errorf("want the binary in %s, got %s", r.binDir(), dir)
+	}
+	if again := r.binaryFor(src); again != bin {
+		t.Errorf("want the same binary for the same source, got %s and %s", bin, again)
+	}
+	if other := r.binaryFor([]byte("package other")); other == bin {
+		t.Error("want a different binary for different source")
+	}
+
+	r.goVersion = "go1.21"
+	if upgraded := r.binaryFor(src); upgraded == bin {
+		t.Error("want a different binary for a different go version")
+	}
+}
+
+func TestSupportsTarget(t *testing.T) {
+	list := []byte("darwin/arm64\nlinux/amd64\nwasip1/wasm\n")
+
+	if !supportsTarget(list, "linux", "amd64") {
+		t.Error("want linux/amd64 to be supported")
+	}
+	if supportsTarget(list, "nacl", "amd64p32") {
+		t.Error("want nacl/amd64p32 to be unsupported")
+	}
+	if supportsTarget(list, "linux", "amd") {
+		t.Error("want only whole targets to match")
+	}
+}
+
+func TestWarmCacheOnce(t *testing.T) {
+	dir := t.TempDir()
+	r := Runnable{cacheDir: dir, goVersion: "go1.20"}
+
+	// A stamp for this toolchain means there's nothing to do, the go
+	// command must not even be looked for. If it were the failure would be
+	// logged through the nil bot.
+	if err := os.WriteFile(r.warmStamp(), []byte(r.warmKey()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", "")
+	r.warmCache(context.Background())
+
+	old := r.warmKey()
+	r.goVersion = "go1.21"
+	if r.warmKey() == old {
+		t.Error("want a new toolchain to need warming again")
+	}
+}
@@ -0,0 +1,112 @@
+// Package seen remembers the last thing each nick did on a network, so
+// people can ask when someone was last around and what they said.
+package seen
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	// sqlite3
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The things a nick can last be seen doing.
+const (
+	ActionPrivmsg = "privmsg"
+	ActionJoin    = "join"
+	ActionPart    = "part"
+	ActionQuit    = "quit"
+	// ActionNick is changing nick to Other.
+	ActionNick = "nick"
+	// ActionRenamed is changing nick from Other.
+	ActionRenamed = "renamed"
+)
+
+const (
+	sqlCreateTable = `CREATE TABLE IF NOT EXISTS seen (` +
+		`network TEXT NOT NULL,` +
+		`nick TEXT NOT NULL,` +
+		`name TEXT NOT NULL,` +
+		`host TEXT NOT NULL,` +
+		`action TEXT NOT NULL,` +
+		`channel TEXT NOT NULL DEFAULT '',` +
+		`message TEXT NOT NULL DEFAULT '',` +
+		`other TEXT NOT NULL DEFAULT '',` +
+		`at INTEGER NOT NULL,` +
+		`PRIMARY KEY (network, nick));`
+
+	sqlPut = `INSERT OR REPLACE INTO seen (network, nick, name, host, action, channel, message, other, at) ` +
+		`VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	sqlGet = `SELECT network, name, host, action, channel, message, other, at FROM seen ` +
+		`WHERE network = ? AND nick = ?;`
+)
+
+// ErrNotFound is returned for nicks that haven't been seen.
+var ErrNotFound = errors.New("seen: nick not seen")
+
+// Sighting is the last thing a nick was seen doing.
+type Sighting struct {
+	Network string
+	Nick    string
+	// Host is the nick's full nick!user@host.
+	Host    string
+	Action  string
+	Channel string
+	// Message is what they said, or their part or quit message.
+	Message string
+	// Other is the nick they changed to or from.
+	Other string
+	At    time.Time
+}
+
+// DB stores the sightings.
+type DB struct {
+	db *sql.DB
+}
+
+// OpenDB opens the database at the location requested.
+func OpenDB(filename string) (*DB, error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite only allows one writer, one connection avoids busy errors.
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec(sqlCreateTable); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DB{db: db}, nil
+}
+
+// Close the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Put a sighting, replacing the nick's last one.
+func (d *DB) Put(s Sighting) error {
+	_, err := d.db.Exec(sqlPut, s.Network, strings.ToLower(s.Nick), s.Nick, s.Host,
+		s.Action, s.Channel, s.Message, s.Other, s.At.Unix())
+	return err
+}
+
+// Get the last sighting of nick on network.
+func (d *DB) Get(network, nick string) (Sighting, error) {
+	var s Sighting
+	var at int64
+	err := d.db.QueryRow(sqlGet, network, strings.ToLower(nick)).Scan(&s.Network,
+		&s.Nick, &s.Host, &s.Action, &s.Channel, &s.Message, &s.Other, &at)
+	if err == sql.ErrNoRows {
+		return Sighting{}, ErrNotFound
+	} else if err != nil {
+		return Sighting{}, err
+	}
+
+	s.At = time.Unix(at, 0)
+	return s, nil
+}
@@ -0,0 +1,78 @@
+package seen
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := OpenDB(filepath.Join(t.TempDir(), "seen.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPutGet(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	at := time.Unix(1500000000, 0)
+
+	want := Sighting{
+		Network: "net",
+		Nick:    "Nick",
+		Host:    "Nick!user@host",
+		Action:  ActionPart,
+		Channel: "#chan",
+		Message: "bye",
+		Other:   "other",
+		At:      at,
+	}
+	if err := db.Put(want); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, nick := range []string{"Nick", "nick", "NICK"} {
+		got, err := db.Get("net", nick)
+		if err != nil {
+			t.Fatalf("%s: %v", nick, err)
+		}
+		if got != want {
+			t.Errorf("%s: want %+v, got %+v", nick, want, got)
+		}
+	}
+
+	if _, err := db.Get("other", "nick"); err != ErrNotFound {
+		t.Errorf("want nicks kept apart by network, got %v", err)
+	}
+	if _, err := db.Get("net", "nobody"); err != ErrNotFound {
+		t.Errorf("want ErrNotFound for a nick never seen, got %v", err)
+	}
+}
+
+func TestPutReplaces(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	at := time.Unix(1500000000, 0)
+
+	if err := db.Put(Sighting{Network: "net", Nick: "nick", Action: ActionJoin, Channel: "#chan", At: at}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(Sighting{Network: "net", Nick: "NiCK", Action: ActionQuit, At: at.Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.Get("net", "nick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Action != ActionQuit || got.Nick != "NiCK" || len(got.Channel) != 0 || !got.At.Equal(at.Add(time.Minute)) {
+		t.Errorf("want only the latest sighting with the nick as last written, got %+v", got)
+	}
+}
@@ -0,0 +1,294 @@
+package seen
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
+	"github.com/aarondl/uq/settings"
+)
+
+const (
+	defaultDB = "seen.sqlite3"
+	// maxHops is how many nick changes are followed to find what someone is
+	// called now.
+	maxHops = 10
+)
+
+// events are the ones a sighting is recorded for.
+var events = []string{irc.PRIVMSG, irc.JOIN, irc.PART, irc.QUIT, irc.NICK}
+
+func init() {
+	ext.RegisterExtension("seen", &Seen{})
+	settings.Define("seen", settings.Option{
+		Name:    "messages",
+		Type:    settings.BoolType,
+		Default: "true",
+		Desc:    "Remember what people last said in the channel, off only remembers that they talked.",
+	}, settings.Option{
+		Name:    "hosts",
+		Type:    settings.BoolType,
+		Default: "false",
+		Desc:    "Show the user@host of who was seen, off by default so hosts aren't given out.",
+	})
+}
+
+// Seen extension
+type Seen struct {
+	b  *bot.Bot
+	db *DB
+
+	handlerIDs []uint64
+	seenID     uint64
+}
+
+// Init the extension
+func (s *Seen) Init(b *bot.Bot) error {
+	s.b = b
+
+	filename := defaultDB
+	b.ReadConfig(func(cfg *config.Config) {
+		if val, ok := cfg.ExtGlobal().ConfigVal("", "", "seen_db"); ok {
+			filename = val
+		}
+	})
+
+	db, err := OpenDB(filename)
+	if err != nil {
+		return err
+	}
+	s.db = db
+
+	s.seenID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"seen",
+		"seen",
+		"Says when a nick was last seen on the network and what they were doing.",
+		s,
+		cmd.Privmsg, cmd.AnyScope, "nick",
+	))
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	for _, event := range events {
+		s.handlerIDs = append(s.handlerIDs, ext.Register(b, "", "", event, s))
+	}
+
+	return nil
+}
+
+// Deinit the extension
+func (s *Seen) Deinit(b *bot.Bot) error {
+	for _, id := range s.handlerIDs {
+		ext.Unregister(b, id)
+	}
+	ext.UnregisterCmd(b, s.seenID)
+
+	return s.db.Close()
+}
+
+// Cmd lets reflection hook up the commands, instead of doing it here.
+func (s *Seen) Cmd(_ string, _ irc.Writer, _ *cmd.Event) error {
+	return nil
+}
+
+// Handle records what people do.
+func (s *Seen) Handle(w irc.Writer, ev *irc.Event) {
+	if state := s.b.State(ev.NetworkID); state != nil && strings.EqualFold(ev.Nick(), state.Self().Nick()) {
+		return
+	}
+
+	sighting := Sighting{
+		Network: ev.NetworkID,
+		Nick:    ev.Nick(),
+		Host:    ev.Sender,
+		At:      time.Now(),
+	}
+
+	switch ev.Name {
+	case irc.PRIVMSG:
+		if len(ev.Args) < 2 || !ev.IsTargetChan() {
+			return
+		}
+		sighting.Action, sighting.Channel = ActionPrivmsg, ev.Target()
+		if settings.Bool(s.b, ev.NetworkID, ev.Target(), "seen", "messages") {
+			sighting.Message = message(ev)
+		}
+	case irc.JOIN:
+		sighting.Action, sighting.Channel = ActionJoin, ev.Target()
+	case irc.PART:
+		sighting.Action, sighting.Channel = ActionPart, ev.Target()
+		if len(ev.Args) > 1 {
+			sighting.Message = ev.Args[1]
+		}
+	case irc.QUIT:
+		sighting.Action = ActionQuit
+		if len(ev.Args) > 0 {
+			sighting.Message = ev.Args[0]
+		}
+	case irc.NICK:
+		if len(ev.Args) == 0 {
+			return
+		}
+		sighting.Action, sighting.Other = ActionNick, ev.Args[0]
+
+		renamed := sighting
+		renamed.Nick, renamed.Action, renamed.Other = ev.Args[0], ActionRenamed, ev.Nick()
+		renamed.Host = ev.Args[0] + strings.TrimPrefix(ev.Sender, ev.Nick())
+		s.put(renamed)
+	default:
+		return
+	}
+
+	s.put(sighting)
+}
+
+func (s *Seen) put(sighting Sighting) {
+	if err := s.db.Put(sighting); err != nil {
+		s.b.Logger.Error("failed to save sighting", "network", sighting.Network,
+			"nick", sighting.Nick, "err", err)
+	}
+}
+
+// Seen says when a nick was last seen.
+func (s *Seen) Seen(w irc.Writer, ev *cmd.Event) error {
+	nick, target := ev.Nick(), ev.Args["nick"]
+	if strings.EqualFold(nick, target) {
+		w.Notifyf(ev.Event, nick, "\x02Seen:\x02 Looking for yourself, %s?", nick)
+		return nil
+	}
+
+	last, err := s.db.Get(ev.NetworkID, target)
+	if err == ErrNotFound {
+		w.Notifyf(ev.Event, nick, "\x02Seen:\x02 I haven't seen %s.", target)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var channel string
+	if ev.IsTargetChan() {
+		channel = ev.Target()
+	}
+
+	now := time.Now()
+	who := last.Nick
+	if settings.Bool(s.b, ev.NetworkID, channel, "seen", "hosts") {
+		who += " (" + ircmsg.UserHost(last.Host) + ")"
+	}
+	msg := fmt.Sprintf("\x02Seen:\x02 %s was last seen %s ago %s.",
+		who, ircmsg.Ago(now.Sub(last.At)), doing(last, s.shown(ev, last)))
+
+	current := last
+	if later, ok := s.follow(last); ok {
+		current = later
+		if later.Action == ActionRenamed {
+			msg += fmt.Sprintf(" They're now known as %s.", later.Nick)
+		} else {
+			msg += fmt.Sprintf(" They're now known as %s, who was last seen %s ago %s.",
+				later.Nick, ircmsg.Ago(now.Sub(later.At)), doing(later, s.shown(ev, later)))
+		}
+	}
+
+	if state := s.b.State(ev.NetworkID); state != nil && current.Action != ActionQuit {
+		if _, ok := state.User(current.Nick); ok {
+			msg += " They're here now."
+		}
+	}
+
+	return ircmsg.Notify(s.b, w, ev.Event, nick, msg)
+}
+
+// follow the nick changes after a sighting to what the nick is now.
+func (s *Seen) follow(sighting Sighting) (Sighting, bool) {
+	current := sighting
+	for i := 0; i < maxHops && current.Action == ActionNick; i++ {
+		next, err := s.db.Get(current.Network, current.Other)
+		if err != nil {
+			if err != ErrNotFound {
+				s.b.Logger.Error("failed to follow nick change", "network", current.Network,
+					"nick", current.Other, "err", err)
+			}
+			break
+		}
+		if next.At.Before(current.At) {
+			break
+		}
+		current = next
+	}
+
+	return current, !strings.EqualFold(current.Nick, sighting.Nick)
+}
+
+// shown is whether the channel a sighting was in can be told to whoever
+// asked: it's asked in that channel or they're on it too. Secret and private
+// channels would be leaked otherwise.
+func (s *Seen) shown(ev *cmd.Event, sighting Sighting) bool {
+	if len(sighting.Channel) == 0 {
+		return true
+	}
+	if ev.IsTargetChan() && strings.EqualFold(ev.Target(), sighting.Channel) {
+		return true
+	}
+	state := s.b.State(ev.NetworkID)
+	return state != nil && state.IsOn(ev.Nick(), sighting.Channel)
+}
+
+// doing describes what a sighting was of, the channel and what was said are
+// left out unless shown.
+func doing(s Sighting, shown bool) string {
+	switch s.Action {
+	case ActionPrivmsg:
+		if !shown {
+			return "talking in a channel"
+		}
+		if len(s.Message) == 0 {
+			return "talking in " + s.Channel
+		}
+		return fmt.Sprintf("in %s, saying: %s\x0f", s.Channel, s.Message)
+	case ActionJoin:
+		if !shown {
+			return "joining a channel"
+		}
+		return "joining " + s.Channel
+	case ActionPart:
+		if !shown {
+			return "leaving a channel"
+		}
+		return "leaving " + s.Channel + reason(s.Message)
+	case ActionQuit:
+		return "quitting" + reason(s.Message)
+	case ActionNick:
+		return "changing nick to " + s.Other
+	case ActionRenamed:
+		return "changing nick from " + s.Other
+	default:
+		return s.Action
+	}
+}
+
+func reason(msg string) string {
+	if len(msg) == 0 {
+		return ""
+	}
+	return " (" + msg + "\x0f)"
+}
+
+// message is what was said, actions are shown like irc clients do and other
+// ctcps aren't kept.
+func message(ev *irc.Event) string {
+	if !ev.IsCTCP() {
+		return ev.Message()
+	}
+	if tag, data := ev.UnpackCTCP(); tag == "ACTION" {
+		return "* " + ev.Nick() + " " + data
+	}
+	return ""
+}
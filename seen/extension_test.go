@@ -0,0 +1,212 @@
+package seen
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/internal/testbot"
+)
+
+// newTestSeen makes a Seen with its own database on a bot that's on #chan
+// with asker, who isn't on #secret.
+func newTestSeen(t *testing.T) *Seen {
+	t.Helper()
+
+	b := testbot.NewStoreless(t, fmt.Sprintf(`seen_db = %q`, filepath.Join(t.TempDir(), "bot.sqlite3")))
+
+	ni := irc.NewNetworkInfo()
+	state := b.State("test")
+	for _, ev := range []*irc.Event{
+		irc.NewEvent("test", ni, irc.RPL_WELCOME, "irc.test.net", "uq", "Welcome uq!uq@uq.host"),
+		irc.NewEvent("test", ni, irc.JOIN, "uq!uq@uq.host", "#chan"),
+		irc.NewEvent("test", ni, irc.JOIN, "uq!uq@uq.host", "#secret"),
+		irc.NewEvent("test", ni, irc.JOIN, "asker!a@a.host", "#chan"),
+	} {
+		state.Update(ev)
+	}
+
+	return &Seen{b: b, db: newTestDB(t)}
+}
+
+func put(t *testing.T, s *Seen, sightings ...Sighting) {
+	t.Helper()
+	for _, sighting := range sightings {
+		if sighting.Network == "" {
+			sighting.Network = "test"
+		}
+		if err := s.db.Put(sighting); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	s := newTestSeen(t)
+	at := time.Unix(1500000000, 0)
+
+	put(t, s,
+		Sighting{Nick: "a", Action: ActionNick, Other: "b", At: at},
+		Sighting{Nick: "b", Action: ActionNick, Other: "c", At: at.Add(time.Minute)},
+		Sighting{Nick: "c", Action: ActionPrivmsg, Channel: "#chan", At: at.Add(2 * time.Minute)},
+	)
+
+	a, _ := s.db.Get("test", "a")
+	if got, ok := s.follow(a); !ok || got.Nick != "c" || got.Action != ActionPrivmsg {
+		t.Errorf("want a followed through b to c, got %+v %v", got, ok)
+	}
+
+	c, _ := s.db.Get("test", "c")
+	if got, ok := s.follow(c); ok || got.Nick != "c" {
+		t.Errorf("want nothing to follow from c, got %+v %v", got, ok)
+	}
+
+	// b's sighting is from before a became b, so it was someone else.
+	put(t, s, Sighting{Nick: "b", Action: ActionNick, Other: "d", At: at.Add(-time.Minute)})
+	if got, ok := s.follow(a); ok || got.Nick != "a" {
+		t.Errorf("want an older sighting not followed, got %+v %v", got, ok)
+	}
+
+	// Changing to a nick that was never seen stops there.
+	put(t, s, Sighting{Nick: "e", Action: ActionNick, Other: "never", At: at})
+	e, _ := s.db.Get("test", "e")
+	if got, ok := s.follow(e); ok || got.Nick != "e" {
+		t.Errorf("want e kept when the new nick wasn't seen, got %+v %v", got, ok)
+	}
+}
+
+func TestFollowMaxHops(t *testing.T) {
+	s := newTestSeen(t)
+	at := time.Unix(1500000000, 0)
+
+	for i := 0; i < maxHops+3; i++ {
+		put(t, s, Sighting{Nick: fmt.Sprint("n", i), Action: ActionNick,
+			Other: fmt.Sprint("n", i+1), At: at.Add(time.Duration(i) * time.Second)})
+	}
+
+	first, _ := s.db.Get("test", "n0")
+	if got, ok := s.follow(first); !ok || got.Nick != fmt.Sprint("n", maxHops) {
+		t.Errorf("want the chain followed %d hops, got %+v %v", maxHops, got, ok)
+	}
+}
+
+func TestFollowLoop(t *testing.T) {
+	s := newTestSeen(t)
+	at := time.Unix(1500000000, 0)
+
+	// Nick changes back and forth inside the same second can't be ordered.
+	put(t, s,
+		Sighting{Nick: "a", Action: ActionNick, Other: "b", At: at},
+		Sighting{Nick: "b", Action: ActionNick, Other: "a", At: at},
+	)
+
+	done := make(chan Sighting)
+	a, _ := s.db.Get("test", "a")
+	go func() {
+		got, _ := s.follow(a)
+		done <- got
+	}()
+
+	select {
+	case got := <-done:
+		if got.Nick != "a" && got.Nick != "b" {
+			t.Errorf("want the loop to end on a or b, got %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("following a loop never ended")
+	}
+}
+
+func cmdEvent(sender, target string, args map[string]string) *cmd.Event {
+	ev := irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG, sender, target, "")
+	return &cmd.Event{Event: ev, Args: args}
+}
+
+func TestShown(t *testing.T) {
+	s := newTestSeen(t)
+
+	tests := []struct {
+		name    string
+		target  string
+		channel string
+		want    bool
+	}{
+		{"no channel", "uq", "", true},
+		{"asked there", "#secret", "#SECRET", true},
+		{"on it", "uq", "#chan", true},
+		{"on it elsewhere", "#other", "#chan", true},
+		{"not on it", "#chan", "#secret", false},
+		{"not on it in private", "uq", "#secret", false},
+	}
+
+	for _, test := range tests {
+		ev := cmdEvent("asker!a@a.host", test.target, nil)
+		if got := s.shown(ev, Sighting{Channel: test.channel}); got != test.want {
+			t.Errorf("%s: want %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestSeen(t *testing.T) {
+	s := newTestSeen(t)
+	now := time.Now()
+
+	put(t, s,
+		Sighting{Nick: "talker", Host: "talker!t@t.host", Action: ActionPrivmsg,
+			Channel: "#secret", Message: "psst", At: now.Add(-time.Hour)},
+		Sighting{Nick: "old", Action: ActionNick, Other: "asker", At: now.Add(-time.Minute)},
+		Sighting{Nick: "asker", Action: ActionRenamed, Other: "old", At: now.Add(-time.Minute)},
+	)
+
+	tests := []struct {
+		target string
+		nick   string
+		want   string
+	}{
+		{"uq", "talker", "talker was last seen 1h ago talking in a channel."},
+		{"#secret", "talker", "talker was last seen 1h ago in #secret, saying: psst\x0f."},
+		{"uq", "nobody", "I haven't seen nobody."},
+		{"uq", "Asker", "Looking for yourself, asker?"},
+		{"uq", "old", "old was last seen 1m ago changing nick to asker. They're now known as asker. They're here now."},
+	}
+
+	for _, test := range tests {
+		var lines testbot.Lines
+		ev := cmdEvent("asker!a@a.host", test.target, map[string]string{"nick": test.nick})
+		if err := s.Seen(irc.Helper{Writer: &lines}, ev); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.nick, err)
+			continue
+		}
+		if len(lines) != 1 || !strings.HasSuffix(lines[0], "\x02Seen:\x02 "+test.want) {
+			t.Errorf("%s in %s: want %q, got %q", test.nick, test.target, test.want, lines)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	s := newTestSeen(t)
+	ni := irc.NewNetworkInfo()
+
+	s.Handle(nil, irc.NewEvent("test", ni, irc.NICK, "before!u@host", "after"))
+	s.Handle(nil, irc.NewEvent("test", ni, irc.PRIVMSG, "uq!uq@uq.host", "#chan", "ignored"))
+	s.Handle(nil, irc.NewEvent("test", ni, irc.PRIVMSG, "someone!u@host", "uq", "private"))
+
+	before, err := s.db.Get("test", "before")
+	if err != nil || before.Action != ActionNick || before.Other != "after" {
+		t.Errorf("want before changing nick to after, got %+v %v", before, err)
+	}
+	after, err := s.db.Get("test", "after")
+	if err != nil || after.Action != ActionRenamed || after.Other != "before" || after.Host != "after!u@host" {
+		t.Errorf("want after renamed from before with its own host, got %+v %v", after, err)
+	}
+	if _, err = s.db.Get("test", "uq"); err != ErrNotFound {
+		t.Errorf("want the bot itself not recorded, got %v", err)
+	}
+	if _, err = s.db.Get("test", "someone"); err != ErrNotFound {
+		t.Errorf("want private messages not recorded, got %v", err)
+	}
+}
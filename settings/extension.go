@@ -0,0 +1,255 @@
+package settings
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/dispatch"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
+)
+
+// SetFlag is the flag a user needs in a channel to change its settings.
+const SetFlag = "s"
+
+func init() {
+	ext.RegisterExtension("settings", &Settings{})
+}
+
+// Settings extension
+type Settings struct {
+	b *bot.Bot
+
+	setID     uint64
+	unsetID   uint64
+	enableID  uint64
+	disableID uint64
+}
+
+// Init the extension
+func (s *Settings) Init(b *bot.Bot) error {
+	s.b = b
+
+	var err error
+	s.setID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"settings",
+		"set",
+		"Shows or changes a setting for a channel, key is in ext.name form. "+
+			"Lists all settings if no key is given.",
+		s,
+		cmd.Privmsg, cmd.AnyScope, 0, "", "#chan", "[key]", "value...",
+	))
+	if err != nil {
+		return err
+	}
+	s.unsetID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"settings",
+		"unset",
+		"Removes a channel's setting so the configured value is used again.",
+		s,
+		cmd.Privmsg, cmd.AnyScope, 0, "", "#chan", "key",
+	))
+	if err != nil {
+		return err
+	}
+	s.disableID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"settings",
+		"disable",
+		"Disables an extension, or one of it's commands as ext.cmd, in a "+
+			"channel: disable key [in #chan]. Lists what's disabled if no key is given.",
+		s,
+		cmd.Privmsg, cmd.AnyScope, 0, "", "[key]", "where...",
+	))
+	if err != nil {
+		return err
+	}
+	s.enableID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"settings",
+		"enable",
+		"Enables something disabled in a channel: enable key [in #chan].",
+		s,
+		cmd.Privmsg, cmd.AnyScope, 0, "", "key", "where...",
+	))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Deinit the extension
+func (s *Settings) Deinit(b *bot.Bot) error {
+	ext.UnregisterCmd(b, s.setID)
+	ext.UnregisterCmd(b, s.unsetID)
+	ext.UnregisterCmd(b, s.enableID)
+	ext.UnregisterCmd(b, s.disableID)
+	return nil
+}
+
+// Cmd lets reflection hook up the commands, instead of doing it here.
+func (s *Settings) Cmd(_ string, _ irc.Writer, _ *cmd.Event) error {
+	return nil
+}
+
+// Set shows or changes a setting.
+func (s *Settings) Set(w irc.Writer, ev *cmd.Event) error {
+	nick := ev.Nick()
+	network, channel := ev.NetworkID, ev.Args["chan"]
+	key, value := ev.Args["key"], ev.Args["value"]
+
+	if len(key) == 0 {
+		var vals []string
+		for _, key := range Options() {
+			extension, name, _ := splitKey(key)
+			vals = append(vals, key+"="+Get(s.b, network, channel, extension, name))
+		}
+		ircmsg.Notify(s.b, w, ev.Event, nick,
+			fmt.Sprintf("\x02Settings (\x02%s\x02):\x02 %s", channel, strings.Join(vals, " ")))
+		return nil
+	}
+
+	extension, name, ok := splitKey(strings.ToLower(key))
+	if !ok {
+		w.Notice(nick, "\x02Settings:\x02 Keys look like ext.name")
+		return nil
+	}
+	o, ok := Lookup(extension, name)
+	if !ok {
+		w.Noticef(nick, "\x02Settings:\x02 No such setting: %s.%s", extension, name)
+		return nil
+	}
+
+	if len(value) == 0 {
+		val, from := Source(s.b, network, channel, extension, name)
+		w.Noticef(nick, "\x02Settings (\x02%s\x02):\x02 %s.%s = %q (%v, from %s) %s",
+			channel, extension, name, val, o.Type, from, o.Description())
+		return nil
+	}
+
+	if !ev.StoredUser.HasFlags(network, channel, SetFlag) {
+		return dispatch.MakeChannelFlagsError(SetFlag)
+	}
+
+	if err := Set(s.b, network, channel, extension, name, value); err != nil {
+		w.Noticef(nick, "\x02Settings:\x02 %v", err)
+		return nil
+	}
+
+	w.Noticef(nick, "\x02Settings (\x02%s\x02):\x02 %s.%s = %q",
+		channel, extension, name, value)
+	return nil
+}
+
+// Unset removes a channel's override for a setting.
+func (s *Settings) Unset(w irc.Writer, ev *cmd.Event) error {
+	nick := ev.Nick()
+	network, channel := ev.NetworkID, ev.Args["chan"]
+
+	extension, name, ok := splitKey(strings.ToLower(ev.Args["key"]))
+	if !ok {
+		w.Notice(nick, "\x02Settings:\x02 Keys look like ext.name")
+		return nil
+	}
+
+	if !ev.StoredUser.HasFlags(network, channel, SetFlag) {
+		return dispatch.MakeChannelFlagsError(SetFlag)
+	}
+
+	if err := Unset(s.b, network, channel, extension, name); err != nil {
+		w.Noticef(nick, "\x02Settings:\x02 %v", err)
+		return nil
+	}
+
+	val, from := Source(s.b, network, channel, extension, name)
+	w.Noticef(nick, "\x02Settings (\x02%s\x02):\x02 %s.%s = %q (from %s)",
+		channel, extension, name, val, from)
+	return nil
+}
+
+// Disable an extension or command in a channel.
+func (s *Settings) Disable(w irc.Writer, ev *cmd.Event) error {
+	return s.toggle(w, ev, true)
+}
+
+// Enable an extension or command in a channel.
+func (s *Settings) Enable(w irc.Writer, ev *cmd.Event) error {
+	return s.toggle(w, ev, false)
+}
+
+func (s *Settings) toggle(w irc.Writer, ev *cmd.Event, disable bool) error {
+	nick := ev.Nick()
+	network := ev.NetworkID
+	key := strings.ToLower(ev.Args["key"])
+
+	channel, ok := toggleChannel(ev)
+	if !ok {
+		w.Notice(nick, "\x02Settings:\x02 Which channel? Use: key in #chan")
+		return nil
+	}
+
+	if len(key) == 0 {
+		disabled := ext.Disabled(s.b, network, channel)
+		if len(disabled) == 0 {
+			w.Noticef(nick, "\x02Settings (\x02%s\x02):\x02 Nothing is disabled.", channel)
+			return nil
+		}
+		ircmsg.Notify(s.b, w, ev.Event, nick,
+			fmt.Sprintf("\x02Settings (\x02%s\x02):\x02 Disabled: %s", channel, strings.Join(disabled, ", ")))
+		return nil
+	}
+
+	if !ev.StoredUser.HasFlags(network, channel, SetFlag) {
+		return dispatch.MakeChannelFlagsError(SetFlag)
+	}
+
+	var err error
+	if disable {
+		switch {
+		case key == "settings" || key == "settings.enable":
+			w.Notice(nick, "\x02Settings:\x02 That would make it impossible to enable anything again.")
+			return nil
+		case !ext.Known(key):
+			w.Noticef(nick, "\x02Settings:\x02 No extension or command named: %s", key)
+			return nil
+		}
+		err = ext.Disable(s.b, network, channel, key)
+	} else {
+		err = ext.Enable(s.b, network, channel, key)
+	}
+
+	if err != nil {
+		w.Noticef(nick, "\x02Settings:\x02 %v", err)
+		return nil
+	}
+
+	state := "enabled"
+	if disable {
+		state = "disabled"
+	}
+	w.Noticef(nick, "\x02Settings (\x02%s\x02):\x02 %s %s.", channel, key, state)
+	return nil
+}
+
+// toggleChannel finds the channel in "[in] #chan", defaulting to the channel
+// the command was used in.
+func toggleChannel(ev *cmd.Event) (string, bool) {
+	where := strings.Fields(ev.Args["where"])
+	if len(where) != 0 && strings.EqualFold(where[0], "in") {
+		where = where[1:]
+	}
+
+	if len(where) != 0 {
+		if !ev.NetworkInfo.IsChannel(where[0]) {
+			return "", false
+		}
+		return where[0], true
+	}
+
+	if ev.IsTargetChan() {
+		return ev.Target(), true
+	}
+	return "", false
+}
@@ -0,0 +1,313 @@
+// Package settings holds typed options for uq's extensions. Every option has
+// a default, can be set for everything, a network, or a network's channel in
+// the ultimateq config, and can be overridden for a single channel with the
+// set command which stores the value in the bot's store.
+//
+// The value used for a channel is the first one found of: the channel's
+// stored value, the config's value for that network's channel, the network,
+// the channel on any network, the global config and finally the default.
+package settings
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/uq/ext"
+)
+
+// storeKey is the key in a StoredChannel's JSONStorer the values are kept in.
+const storeKey = "settings"
+
+// Type is the type of an option's value.
+type Type int
+
+// The types an option can have.
+const (
+	StringType Type = iota
+	BoolType
+	IntType
+	DurationType
+)
+
+func (t Type) String() string {
+	switch t {
+	case BoolType:
+		return "bool"
+	case IntType:
+		return "int"
+	case DurationType:
+		return "duration"
+	default:
+		return "string"
+	}
+}
+
+// Option describes a single setting.
+type Option struct {
+	Name string
+	Type Type
+	// Default is used when the option isn't set anywhere.
+	Default string
+	// ConfigKey is the key looked up in the ultimateq config, it defaults to
+	// ext_name.
+	ConfigKey string
+	Desc      string
+	// Describe is used instead of Desc when it's set, for descriptions that
+	// aren't known yet when the option is defined.
+	Describe func() string
+}
+
+// Description of the option, from Describe if it's set.
+func (o Option) Description() string {
+	if o.Describe != nil {
+		return o.Describe()
+	}
+	return o.Desc
+}
+
+var (
+	mut     sync.RWMutex
+	schemas = make(map[string]map[string]Option)
+)
+
+// Define the options for an extension. Like ext.RegisterExtension this
+// should be called in init() and panics on bad or duplicate options.
+func Define(extension string, opts ...Option) {
+	mut.Lock()
+	defer mut.Unlock()
+
+	schema, ok := schemas[extension]
+	if !ok {
+		schema = make(map[string]Option)
+		schemas[extension] = schema
+	}
+
+	for _, o := range opts {
+		if _, ok := schema[o.Name]; ok {
+			panic(fmt.Sprintf("settings: %s.%s defined twice", extension, o.Name))
+		}
+		if len(o.Default) != 0 {
+			if err := o.validate(o.Default); err != nil {
+				panic(fmt.Sprintf("settings: %s.%s has a bad default: %v",
+					extension, o.Name, err))
+			}
+		}
+		if len(o.ConfigKey) == 0 {
+			o.ConfigKey = extension + "_" + o.Name
+		}
+		schema[o.Name] = o
+	}
+}
+
+// Lookup an option by extension and name.
+func Lookup(extension, name string) (Option, bool) {
+	mut.RLock()
+	defer mut.RUnlock()
+
+	o, ok := schemas[extension][name]
+	return o, ok
+}
+
+// Options returns every defined option as ext.name keys, sorted.
+func Options() []string {
+	mut.RLock()
+	defer mut.RUnlock()
+
+	var keys []string
+	for extension, schema := range schemas {
+		for name := range schema {
+			keys = append(keys, extension+"."+name)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Get the raw value of an option for a channel. Network and channel may be
+// empty to get less specific values.
+func Get(b *bot.Bot, network, channel, extension, name string) string {
+	val, _ := Source(b, network, channel, extension, name)
+	return val
+}
+
+// Source is like Get but also says where the value came from.
+func Source(b *bot.Bot, network, channel, extension, name string) (val, from string) {
+	o, ok := Lookup(extension, name)
+	if !ok {
+		return "", "undefined"
+	}
+
+	if len(network) != 0 && len(channel) != 0 {
+		if val, ok := stored(b, network, channel, extension, name); ok {
+			return val, "channel"
+		}
+	}
+
+	if val, ok := configVal(b, network, channel, o.ConfigKey); ok {
+		return val, "config"
+	}
+
+	return o.Default, "default"
+}
+
+// Config looks a key up in the config alone, falling back the same way
+// options do. It's for values channels mustn't be able to change with set.
+func Config(b *bot.Bot, network, channel, key string) string {
+	val, _ := configVal(b, network, channel, key)
+	return val
+}
+
+// String gets an option's value as a string.
+func String(b *bot.Bot, network, channel, extension, name string) string {
+	return Get(b, network, channel, extension, name)
+}
+
+// Bool gets an option's value as a bool.
+func Bool(b *bot.Bot, network, channel, extension, name string) bool {
+	val, err := strconv.ParseBool(typed(b, network, channel, extension, name))
+	return err == nil && val
+}
+
+// Int gets an option's value as an int.
+func Int(b *bot.Bot, network, channel, extension, name string) int {
+	val, _ := strconv.Atoi(typed(b, network, channel, extension, name))
+	return val
+}
+
+// Duration gets an option's value as a time.Duration.
+func Duration(b *bot.Bot, network, channel, extension, name string) time.Duration {
+	val, _ := time.ParseDuration(typed(b, network, channel, extension, name))
+	return val
+}
+
+// typed gets a value and falls back to the default if it doesn't parse,
+// this can happen when an option's type changes after it was stored.
+func typed(b *bot.Bot, network, channel, extension, name string) string {
+	o, _ := Lookup(extension, name)
+	val := Get(b, network, channel, extension, name)
+	if o.validate(val) != nil {
+		return o.Default
+	}
+	return val
+}
+
+// Set an option for a channel, the value is checked against the option's
+// type before it's stored.
+func Set(b *bot.Bot, network, channel, extension, name, value string) error {
+	o, ok := Lookup(extension, name)
+	if !ok {
+		return fmt.Errorf("no such setting: %s.%s", extension, name)
+	}
+	if err := o.validate(value); err != nil {
+		return err
+	}
+
+	return update(b, network, channel, func(vals map[string]string) {
+		vals[extension+"."+name] = value
+	})
+}
+
+// Unset removes a channel's override for an option.
+func Unset(b *bot.Bot, network, channel, extension, name string) error {
+	if _, ok := Lookup(extension, name); !ok {
+		return fmt.Errorf("no such setting: %s.%s", extension, name)
+	}
+
+	return update(b, network, channel, func(vals map[string]string) {
+		delete(vals, extension+"."+name)
+	})
+}
+
+func (o Option) validate(value string) error {
+	var err error
+	switch o.Type {
+	case BoolType:
+		_, err = strconv.ParseBool(value)
+	case IntType:
+		_, err = strconv.Atoi(value)
+	case DurationType:
+		_, err = time.ParseDuration(value)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s must be a %v", o.Name, o.Type)
+	}
+	return nil
+}
+
+func stored(b *bot.Bot, network, channel, extension, name string) (string, bool) {
+	store := b.Store()
+	if store == nil {
+		return "", false
+	}
+
+	ch, err := store.FindChannel(network, channel)
+	if err != nil || ch == nil {
+		return "", false
+	}
+
+	var vals map[string]string
+	if ok, err := ch.GetJSON(storeKey, &vals); !ok || err != nil {
+		return "", false
+	}
+
+	val, ok := vals[extension+"."+name]
+	return val, ok
+}
+
+func update(b *bot.Bot, network, channel string, fn func(map[string]string)) error {
+	return ext.UpdateChannel(b, network, channel, func(ch *data.StoredChannel) error {
+		vals := make(map[string]string)
+		if _, err := ch.GetJSON(storeKey, &vals); err != nil {
+			return err
+		}
+
+		fn(vals)
+		return ch.PutJSON(storeKey, vals)
+	})
+}
+
+// configVal looks a key up in the config. ultimateq's ConfigVal doesn't fall
+// back from a network's channel to the network so that's done here.
+func configVal(b *bot.Bot, network, channel, key string) (val string, found bool) {
+	b.ReadConfig(func(cfg *config.Config) {
+		extCfg := cfg.ExtGlobal()
+
+		global, ok := extCfg.ConfigVal("", "", key)
+		for _, where := range [][2]string{
+			{network, channel},
+			{network, ""},
+			{"", channel},
+		} {
+			if len(where[0]) == 0 && len(where[1]) == 0 {
+				continue
+			}
+			// ConfigVal returns the global value when there's nothing more
+			// specific so only a different value means it was overridden.
+			if v, vok := extCfg.ConfigVal(where[0], where[1], key); vok && (!ok || v != global) {
+				val, found = v, true
+				return
+			}
+		}
+
+		val, found = global, ok
+	})
+
+	return val, found
+}
+
+// splitKey splits ext.name into it's parts.
+func splitKey(key string) (extension, name string, ok bool) {
+	dot := strings.IndexByte(key, '.')
+	if dot <= 0 || dot == len(key)-1 {
+		return "", "", false
+	}
+	return key[:dot], key[dot+1:], true
+}
@@ -0,0 +1,246 @@
+package settings
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aarondl/uq/internal/testbot"
+)
+
+func init() {
+	Define("test",
+		Option{Name: "str", Default: "default", Desc: "A string."},
+		Option{Name: "on", Type: BoolType, Default: "false"},
+		Option{Name: "count", Type: IntType, Default: "3"},
+		Option{Name: "wait", Type: DurationType, Default: "1m"},
+		Option{Name: "other", ConfigKey: "other_key"},
+		Option{Name: "desc", Desc: "unused", Describe: func() string { return "described" }},
+	)
+}
+
+func TestDefine(t *testing.T) {
+	t.Parallel()
+
+	o, ok := Lookup("test", "str")
+	if !ok || o.ConfigKey != "test_str" {
+		t.Errorf("want the config key to default to ext_name, got %q %v", o.ConfigKey, ok)
+	}
+	if o, _ = Lookup("test", "other"); o.ConfigKey != "other_key" {
+		t.Errorf("want the given config key kept, got %q", o.ConfigKey)
+	}
+	if _, ok = Lookup("test", "nope"); ok {
+		t.Error("want no option that wasn't defined")
+	}
+
+	if o, _ = Lookup("test", "desc"); o.Description() != "described" {
+		t.Errorf("want Describe to win over Desc, got %q", o.Description())
+	}
+	if o, _ = Lookup("test", "str"); o.Description() != "A string." {
+		t.Errorf("want Desc without Describe, got %q", o.Description())
+	}
+
+	found := false
+	for _, key := range Options() {
+		found = found || key == "test.count"
+	}
+	if !found {
+		t.Errorf("want test.count in the options, got %v", Options())
+	}
+
+	panics := func(name string, fn func()) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s: want a panic", name)
+			}
+		}()
+		fn()
+	}
+	panics("twice", func() { Define("test", Option{Name: "str"}) })
+	panics("bad default", func() { Define("testbad", Option{Name: "n", Type: IntType, Default: "x"}) })
+}
+
+func TestGetSetUnset(t *testing.T) {
+	b := testbot.New(t, "")
+
+	if val, from := Source(b, "test", "#chan", "test", "str"); val != "default" || from != "default" {
+		t.Errorf("want the default, got %q from %s", val, from)
+	}
+	if val, from := Source(b, "test", "#chan", "test", "nope"); val != "" || from != "undefined" {
+		t.Errorf("want nothing for an undefined option, got %q from %s", val, from)
+	}
+
+	if err := Set(b, "test", "#chan", "test", "str", "stored"); err != nil {
+		t.Fatal(err)
+	}
+	if val, from := Source(b, "test", "#chan", "test", "str"); val != "stored" || from != "channel" {
+		t.Errorf("want the stored value, got %q from %s", val, from)
+	}
+	if got := String(b, "test", "#other", "test", "str"); got != "default" {
+		t.Errorf("want other channels untouched, got %q", got)
+	}
+	if got := String(b, "other", "#chan", "test", "str"); got != "default" {
+		t.Errorf("want the same channel on other networks untouched, got %q", got)
+	}
+
+	if err := Set(b, "test", "#chan", "test", "nope", "x"); err == nil {
+		t.Error("want an error setting an undefined option")
+	}
+	if err := Set(b, "test", "#chan", "test", "count", "many"); err == nil {
+		t.Error("want an error setting an int to a word")
+	}
+	if got := Int(b, "test", "#chan", "test", "count"); got != 3 {
+		t.Errorf("want the bad value not stored, got %d", got)
+	}
+
+	if err := Unset(b, "test", "#chan", "test", "str"); err != nil {
+		t.Fatal(err)
+	}
+	if val, from := Source(b, "test", "#chan", "test", "str"); val != "default" || from != "default" {
+		t.Errorf("want the default once unset, got %q from %s", val, from)
+	}
+	if err := Unset(b, "test", "#chan", "test", "nope"); err == nil {
+		t.Error("want an error unsetting an undefined option")
+	}
+}
+
+func TestTyped(t *testing.T) {
+	b := testbot.New(t, "")
+
+	if Bool(b, "test", "#chan", "test", "on") {
+		t.Error("want the default false")
+	}
+	if got := Int(b, "test", "#chan", "test", "count"); got != 3 {
+		t.Errorf("want the default 3, got %d", got)
+	}
+	if got := Duration(b, "test", "#chan", "test", "wait"); got != time.Minute {
+		t.Errorf("want the default 1m, got %v", got)
+	}
+
+	for name, value := range map[string]string{"on": "true", "count": "7", "wait": "90s"} {
+		if err := Set(b, "test", "#chan", "test", name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !Bool(b, "test", "#chan", "test", "on") {
+		t.Error("want on once set")
+	}
+	if got := Int(b, "test", "#chan", "test", "count"); got != 7 {
+		t.Errorf("want 7, got %d", got)
+	}
+	if got := Duration(b, "test", "#chan", "test", "wait"); got != 90*time.Second {
+		t.Errorf("want 90s, got %v", got)
+	}
+
+	// A value that doesn't parse, like one stored before the option's type
+	// changed, falls back to the default.
+	b = testbot.New(t, `test_count = "lots"`)
+	if got := Int(b, "test", "#chan", "test", "count"); got != 3 {
+		t.Errorf("want the default for a bad value, got %d", got)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	b := testbot.New(t, `test_str = "global"
+other_key = "global"
+[ext.config.channels."#any"]
+	test_str = "any network"
+[ext.config.networks.test]
+	test_str = "network"
+[ext.config.networks.test.channels."#chan"]
+	test_str = "network channel"`)
+
+	tests := []struct {
+		network, channel string
+		want             string
+	}{
+		{"test", "#chan", "network channel"},
+		{"test", "#other", "network"},
+		{"test", "#any", "network"},
+		{"other", "#any", "any network"},
+		{"other", "#chan", "global"},
+		{"", "", "global"},
+	}
+
+	for _, test := range tests {
+		val, from := Source(b, test.network, test.channel, "test", "str")
+		if val != test.want || from != "config" {
+			t.Errorf("%s %s: want %q from config, got %q from %s",
+				test.network, test.channel, test.want, val, from)
+		}
+	}
+
+	if got := String(b, "test", "#chan", "test", "other"); got != "global" {
+		t.Errorf("want the option's own config key used, got %q", got)
+	}
+
+	if err := Set(b, "test", "#chan", "test", "str", "stored"); err != nil {
+		t.Fatal(err)
+	}
+	if got := String(b, "test", "#chan", "test", "str"); got != "stored" {
+		t.Errorf("want the stored value to win over the config, got %q", got)
+	}
+	if got := String(b, "test", "", "test", "str"); got != "network" {
+		t.Errorf("want no stored value without a channel, got %q", got)
+	}
+}
+
+func TestConfigVal(t *testing.T) {
+	b := testbot.New(t, `[ext.config.networks.test]
+	test_str = "network"`)
+
+	if val, ok := configVal(b, "test", "#chan", "test_str"); !ok || val != "network" {
+		t.Errorf("want the network's value for its channels, got %q %v", val, ok)
+	}
+	if val, ok := configVal(b, "other", "#chan", "test_str"); ok {
+		t.Errorf("want nothing set for other networks, got %q", val)
+	}
+
+	b = testbot.New(t, `test_str = "same"
+[ext.config.networks.test]
+	test_str = "same"`)
+	if val, ok := configVal(b, "test", "#chan", "test_str"); !ok || val != "same" {
+		t.Errorf("want a network value equal to the global found, got %q %v", val, ok)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	b := testbot.New(t, `test_str = "global"
+[ext.config.networks.test.channels."#chan"]
+	test_str = "network channel"`)
+
+	if err := Set(b, "test", "#chan", "test", "str", "stored"); err != nil {
+		t.Fatal(err)
+	}
+	if got := Config(b, "test", "#chan", "test_str"); got != "network channel" {
+		t.Errorf("want the config's value over the stored one, got %q", got)
+	}
+	if got := Config(b, "test", "#other", "test_str"); got != "global" {
+		t.Errorf("want the global value for other channels, got %q", got)
+	}
+	if got := Config(b, "test", "#chan", "missing"); len(got) != 0 {
+		t.Errorf("want nothing for a missing key, got %q", got)
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		key, extension, name string
+		ok                   bool
+	}{
+		{"ext.name", "ext", "name", true},
+		{"ext.name.more", "ext", "name.more", true},
+		{"ext", "", "", false},
+		{".name", "", "", false},
+		{"ext.", "", "", false},
+	}
+
+	for _, test := range tests {
+		extension, name, ok := splitKey(test.key)
+		if extension != test.extension || name != test.name || ok != test.ok {
+			t.Errorf("%s: want %q %q %v, got %q %q %v", test.key,
+				test.extension, test.name, test.ok, extension, name, ok)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Package shortener is a url shortener hosted by the bot. Links are kept in
+// an sqlite database and served by a small redirect server that counts the
+// clicks on each one.
+package shortener
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/aarondl/uq/internal/randid"
+	// sqlite3
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	slugLength = 6
+	// slugTries is how many random slugs are tried before giving up, a clash
+	// is unlikely unless the database is enormous.
+	slugTries = 5
+)
+
+const (
+	sqlCreateTable = `CREATE TABLE IF NOT EXISTS links (` +
+		`slug TEXT PRIMARY KEY,` +
+		`url TEXT NOT NULL,` +
+		`author TEXT NOT NULL,` +
+		`created INTEGER NOT NULL,` +
+		`expires INTEGER NOT NULL DEFAULT 0,` +
+		`clicks INTEGER NOT NULL DEFAULT 0);`
+	sqlURLIndex     = `CREATE INDEX IF NOT EXISTS linksurl ON links (url);`
+	sqlCreatedIndex = `CREATE INDEX IF NOT EXISTS linkscreated ON links (created);`
+
+	sqlAdd      = `INSERT OR IGNORE INTO links (slug, url, author, created, expires) VALUES (?, ?, ?, ?, ?);`
+	sqlFindURL  = `SELECT slug, url, author, created, expires, clicks FROM links WHERE url = ? AND expires = 0 LIMIT 1;`
+	sqlGet      = `SELECT slug, url, author, created, expires, clicks FROM links WHERE slug = ?;`
+	sqlClick    = `UPDATE links SET clicks = clicks + 1 WHERE slug = ? AND (expires = 0 OR expires > ?);`
+	sqlList     = `SELECT slug, url, author, created, expires, clicks FROM links ORDER BY created DESC LIMIT ?;`
+	sqlDel      = `DELETE FROM links WHERE slug = ?;`
+	sqlPurge    = `DELETE FROM links WHERE expires != 0 AND expires <= ?;`
+	sqlGetCount = `SELECT COUNT(*) FROM links;`
+)
+
+// ErrNotFound is returned for slugs that don't exist or have expired.
+var ErrNotFound = errors.New("shortener: no such link")
+
+// Link is a shortened link.
+type Link struct {
+	Slug    string
+	URL     string
+	Author  string
+	Created time.Time
+	// Expires is zero for links that never expire.
+	Expires time.Time
+	Clicks  int
+}
+
+// Expired checks if the link has expired by now.
+func (l Link) Expired(now time.Time) bool {
+	return !l.Expires.IsZero() && !now.Before(l.Expires)
+}
+
+// DB stores the links.
+type DB struct {
+	db *sql.DB
+}
+
+// OpenDB opens the database at the location requested.
+func OpenDB(filename string) (*DB, error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite only allows one writer, one connection avoids busy errors.
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{sqlCreateTable, sqlURLIndex, sqlCreatedIndex} {
+		if _, err = db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &DB{db: db}, nil
+}
+
+// Close the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Shorten a url. Links that never expire are shared, shortening the same url
+// twice gives back the first link. A ttl of 0 never expires.
+func (d *DB) Shorten(long, author string, ttl time.Duration) (Link, error) {
+	u, err := url.Parse(long)
+	if err != nil {
+		return Link{}, fmt.Errorf("shortener: bad url: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return Link{}, errors.New("shortener: only http and https links can be shortened")
+	}
+	long = u.String()
+
+	if ttl == 0 {
+		link, err := scan(d.db.QueryRow(sqlFindURL, long))
+		if err == nil {
+			return link, nil
+		} else if err != ErrNotFound {
+			return Link{}, err
+		}
+	}
+
+	now := time.Now()
+	link := Link{URL: long, Author: author, Created: now}
+	var expires int64
+	if ttl > 0 {
+		link.Expires = now.Add(ttl)
+		expires = link.Expires.Unix()
+	}
+
+	for i := 0; i < slugTries; i++ {
+		if link.Slug, err = newSlug(); err != nil {
+			return Link{}, err
+		}
+
+		res, err := d.db.Exec(sqlAdd, link.Slug, link.URL, link.Author, now.Unix(), expires)
+		if err != nil {
+			return Link{}, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return Link{}, err
+		} else if n == 1 {
+			return link, nil
+		}
+	}
+
+	return Link{}, errors.New("shortener: failed to find a free slug")
+}
+
+// Resolve a slug to its link, counting a click.
+func (d *DB) Resolve(slug string) (Link, error) {
+	res, err := d.db.Exec(sqlClick, slug, time.Now().Unix())
+	if err != nil {
+		return Link{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return Link{}, err
+	} else if n == 0 {
+		return Link{}, ErrNotFound
+	}
+
+	return d.Get(slug)
+}
+
+// Get a link without counting a click, expired links are still returned.
+func (d *DB) Get(slug string) (Link, error) {
+	return scan(d.db.QueryRow(sqlGet, slug))
+}
+
+// List the newest links.
+func (d *DB) List(n int) ([]Link, error) {
+	rows, err := d.db.Query(sqlList, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		link, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// Delete a link.
+func (d *DB) Delete(slug string) error {
+	res, err := d.db.Exec(sqlDel, slug)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Purge deletes the expired links, returning how many there were.
+func (d *DB) Purge() (int64, error) {
+	res, err := d.db.Exec(sqlPurge, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Count the links.
+func (d *DB) Count() (int, error) {
+	var n int
+	err := d.db.QueryRow(sqlGetCount).Scan(&n)
+	return n, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scan(s scanner) (Link, error) {
+	var link Link
+	var created, expires int64
+	err := s.Scan(&link.Slug, &link.URL, &link.Author, &created, &expires, &link.Clicks)
+	if err == sql.ErrNoRows {
+		return Link{}, ErrNotFound
+	} else if err != nil {
+		return Link{}, err
+	}
+
+	link.Created = time.Unix(created, 0)
+	if expires != 0 {
+		link.Expires = time.Unix(expires, 0)
+	}
+	return link, nil
+}
+
+// newSlug makes the random slugs for new links.
+var newSlug = func() (string, error) {
+	return randid.New(slugLength)
+}
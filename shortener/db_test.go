@@ -0,0 +1,164 @@
+package shortener
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := OpenDB(filepath.Join(t.TempDir(), "shorten.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// slugs makes newSlug hand out the given slugs in turn, the last one forever.
+func slugs(t *testing.T, want ...string) {
+	t.Helper()
+
+	old := newSlug
+	t.Cleanup(func() { newSlug = old })
+	newSlug = func() (string, error) {
+		slug := want[0]
+		if len(want) > 1 {
+			want = want[1:]
+		}
+		return slug, nil
+	}
+}
+
+func TestShorten(t *testing.T) {
+	db := newTestDB(t)
+
+	link, err := db.Shorten("https://example.com/a", "nick!user@host", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(link.Slug) != slugLength || !link.Expires.IsZero() {
+		t.Errorf("want a %d letter slug that never expires, got %+v", slugLength, link)
+	}
+
+	got, err := db.Get(link.Slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != "https://example.com/a" || got.Author != "nick!user@host" || got.Clicks != 0 {
+		t.Errorf("want the link back, got %+v", got)
+	}
+
+	again, err := db.Shorten("https://example.com/a", "other", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Slug != link.Slug {
+		t.Errorf("want the same url to share a link, got %s and %s", link.Slug, again.Slug)
+	}
+
+	expiring, err := db.Shorten("https://example.com/a", "other", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiring.Slug == link.Slug || expiring.Expires.IsZero() {
+		t.Errorf("want a link of its own when it expires, got %+v", expiring)
+	}
+
+	for _, bad := range []string{"ftp://example.com", "example.com", "https://", "javascript:alert(1)"} {
+		if _, err := db.Shorten(bad, "nick", 0); err == nil {
+			t.Errorf("%s: want an error", bad)
+		}
+	}
+}
+
+func TestShortenSlugClash(t *testing.T) {
+	db := newTestDB(t)
+	slugs(t, "aaaaaa", "aaaaaa", "bbbbbb")
+
+	first, err := db.Shorten("https://example.com/1", "nick", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.Shorten("https://example.com/2", "nick", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Slug != "aaaaaa" || second.Slug != "bbbbbb" {
+		t.Errorf("want a taken slug to be tried again, got %s and %s", first.Slug, second.Slug)
+	}
+	if link, err := db.Get("aaaaaa"); err != nil || link.URL != "https://example.com/1" {
+		t.Errorf("want the first link kept, got %+v %v", link, err)
+	}
+
+	slugs(t, "aaaaaa")
+	if _, err := db.Shorten("https://example.com/3", "nick", 0); err == nil {
+		t.Error("want an error when every slug tried is taken")
+	}
+}
+
+func TestResolveDeletePurge(t *testing.T) {
+	db := newTestDB(t)
+
+	link, err := db.Shorten("https://example.com", "nick", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = db.Resolve(link.Slug); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := db.Get(link.Slug); got.Clicks != 2 {
+		t.Errorf("want 2 clicks, got %d", got.Clicks)
+	}
+
+	past := time.Now().Add(-time.Hour).Unix()
+	if _, err = db.db.Exec(sqlAdd, "old", "https://example.com/old", "nick", past, past); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Resolve("old"); err != ErrNotFound {
+		t.Errorf("want expired links not found, got %v", err)
+	}
+	if got, err := db.Get("old"); err != nil || !got.Expired(time.Now()) {
+		t.Errorf("want Get to return the expired link, got %+v %v", got, err)
+	}
+
+	if n, err := db.Purge(); err != nil || n != 1 {
+		t.Errorf("want the expired link purged, got %d %v", n, err)
+	}
+	if n, err := db.Count(); err != nil || n != 1 {
+		t.Errorf("want 1 link left, got %d %v", n, err)
+	}
+
+	if err = db.Delete(link.Slug); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Delete(link.Slug); err != ErrNotFound {
+		t.Errorf("want ErrNotFound deleting twice, got %v", err)
+	}
+	if _, err = db.Resolve(link.Slug); err != ErrNotFound {
+		t.Errorf("want deleted links not found, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	db := newTestDB(t)
+
+	for i, u := range []string{"https://a.test", "https://b.test", "https://c.test"} {
+		created := time.Now().Add(time.Duration(i) * time.Minute).Unix()
+		if _, err := db.db.Exec(sqlAdd, string(rune('a'+i)), u, "nick", created, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links, err := db.List(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[0].Slug != "c" || links[1].Slug != "b" {
+		t.Errorf("want the newest two links, got %+v", links)
+	}
+}
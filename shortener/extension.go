@@ -0,0 +1,330 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/dispatch"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/admin"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
+	"github.com/aarondl/uq/queryer"
+	"github.com/aarondl/uq/webserver"
+)
+
+const (
+	defaultDB   = "shorten.sqlite3"
+	defaultList = 5
+	maxList     = 20
+	maxURLShown = 200
+	dateFormat  = "2006-01-02 15:04 MST"
+)
+
+var (
+	activeMut sync.RWMutex
+	// active is the loaded extension, the queryer provider uses its db.
+	active *Shortener
+)
+
+func init() {
+	ext.RegisterExtension("shortener", &Shortener{})
+	queryer.RegisterProvider(queryer.KindShorten, "uq", newProvider)
+}
+
+// Shortener extension
+type Shortener struct {
+	b   *bot.Bot
+	db  *DB
+	web *webserver.Server
+
+	mut     sync.RWMutex
+	baseURL string
+
+	listID uint64
+	delID  uint64
+}
+
+// Init the extension
+func (s *Shortener) Init(b *bot.Bot) error {
+	s.b = b
+
+	filename := defaultDB
+	b.ReadConfig(func(cfg *config.Config) {
+		if val, ok := cfg.ExtGlobal().ConfigVal("", "", "shorten_db"); ok {
+			filename = val
+		}
+	})
+
+	db, err := OpenDB(filename)
+	if err != nil {
+		return err
+	}
+	s.db = db
+	s.web = webserver.New(Handler(db))
+
+	if err = s.loadConfig(b); err != nil {
+		db.Close()
+		return err
+	}
+	s.purge()
+
+	// fail undoes the setup when a command can't be registered.
+	fail := func(err error) error {
+		s.web.Stop()
+		db.Close()
+		return err
+	}
+
+	s.listID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"shortener",
+		"shortlinks",
+		"Lists the newest short links with their clicks. Owner only.",
+		s,
+		cmd.Privmsg, cmd.AnyScope, 0, admin.OwnerFlag, "[count]",
+	))
+	if err != nil {
+		return fail(err)
+	}
+	s.delID, err = ext.RegisterCmd(b, "", "", cmd.NewAuthed(
+		"shortener",
+		"delshort",
+		"Deletes a short link. Owner only.",
+		s,
+		cmd.Privmsg, cmd.AnyScope, 0, admin.OwnerFlag, "slug",
+	))
+	if err != nil {
+		ext.UnregisterCmd(b, s.listID)
+		return fail(err)
+	}
+
+	activeMut.Lock()
+	active = s
+	activeMut.Unlock()
+
+	return nil
+}
+
+// Deinit the extension
+func (s *Shortener) Deinit(b *bot.Bot) error {
+	activeMut.Lock()
+	if active == s {
+		active = nil
+	}
+	activeMut.Unlock()
+
+	defer s.db.Close()
+	defer s.web.Stop()
+
+	ext.UnregisterCmd(b, s.listID)
+	ext.UnregisterCmd(b, s.delID)
+
+	return nil
+}
+
+// Rehash moves the redirect server and clears out expired links.
+func (s *Shortener) Rehash(b *bot.Bot) error {
+	if err := s.loadConfig(b); err != nil {
+		return err
+	}
+	s.purge()
+	return nil
+}
+
+// loadConfig reads shorten_listen, the address of the redirect server, and
+// shorten_url, the address people use to reach it.
+func (s *Shortener) loadConfig(b *bot.Bot) error {
+	var listen, base string
+	b.ReadConfig(func(cfg *config.Config) {
+		listen, _ = cfg.ExtGlobal().ConfigVal("", "", "shorten_listen")
+		base, _ = cfg.ExtGlobal().ConfigVal("", "", "shorten_url")
+	})
+
+	if len(base) != 0 {
+		u, err := url.Parse(base)
+		if err != nil || len(u.Host) == 0 {
+			return fmt.Errorf("failed to parse shorten_url: %s", base)
+		}
+	}
+
+	if err := s.web.Serve(listen); err != nil {
+		return fmt.Errorf("failed to start shortener server: %v", err)
+	}
+
+	s.mut.Lock()
+	s.baseURL = strings.TrimRight(base, "/")
+	s.mut.Unlock()
+
+	return nil
+}
+
+func (s *Shortener) purge() {
+	n, err := s.db.Purge()
+	if err != nil {
+		s.b.Logger.Error("failed to purge expired short links", "err", err)
+	} else if n != 0 {
+		s.b.Logger.Info("purged expired short links", "count", n)
+	}
+}
+
+// link makes the short url for a slug.
+func (s *Shortener) link(slug string) (string, error) {
+	s.mut.RLock()
+	base := s.baseURL
+	s.mut.RUnlock()
+
+	if len(base) == 0 {
+		return "", errors.New("shorten_url is not set in the config")
+	}
+	return base + "/" + slug, nil
+}
+
+// Cmd lets reflection hook up the commands, instead of doing it here.
+func (s *Shortener) Cmd(_ string, _ irc.Writer, _ *cmd.Event) error {
+	return nil
+}
+
+// Shortlinks lists the newest links.
+func (s *Shortener) Shortlinks(w irc.Writer, ev *cmd.Event) error {
+	if !admin.IsOwner(ev.StoredUser) {
+		return dispatch.MakeGlobalFlagsError(admin.OwnerFlag)
+	}
+	nick := ev.Nick()
+
+	count := defaultList
+	if arg := ev.Args["count"]; len(arg) != 0 {
+		var err error
+		if count, err = strconv.Atoi(arg); err != nil || count <= 0 {
+			w.Notice(nick, "\x02Shortener:\x02 Count must be a positive number.")
+			return nil
+		}
+		if count > maxList {
+			count = maxList
+		}
+	}
+
+	total, err := s.db.Count()
+	if err != nil {
+		return err
+	}
+	links, err := s.db.List(count)
+	if err != nil {
+		return err
+	}
+
+	w.Noticef(nick, "\x02Shortener:\x02 %d links, the newest %d:", total, len(links))
+	now := time.Now()
+	for _, l := range links {
+		expires := "never expires"
+		if l.Expired(now) {
+			expires = "expired"
+		} else if !l.Expires.IsZero() {
+			expires = "expires " + l.Expires.Format(dateFormat)
+		}
+		long := l.URL
+		if lines, cut := ircmsg.Truncate(long, maxURLShown, 1, "..."); cut {
+			long = lines[0]
+		}
+		w.Noticef(nick, "\x02%s\x02 %s (%d clicks, by %s, %s)",
+			l.Slug, long, l.Clicks, irc.Nick(l.Author), expires)
+	}
+
+	return nil
+}
+
+// Delshort deletes a link.
+func (s *Shortener) Delshort(w irc.Writer, ev *cmd.Event) error {
+	if !admin.IsOwner(ev.StoredUser) {
+		return dispatch.MakeGlobalFlagsError(admin.OwnerFlag)
+	}
+	nick, slug := ev.Nick(), ev.Args["slug"]
+
+	err := s.db.Delete(slug)
+	switch {
+	case err == ErrNotFound:
+		w.Noticef(nick, "\x02Shortener:\x02 No link %s.", slug)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	s.b.Logger.Info("deleted short link", "slug", slug, "by", ev.Sender)
+	w.Noticef(nick, "\x02Shortener:\x02 Deleted %s.", slug)
+	return nil
+}
+
+// provider lets the shorten command use the loaded extension.
+type provider struct{}
+
+func newProvider(queryer.ProviderConfig) queryer.Provider {
+	return provider{}
+}
+
+// Uncached since every call makes a link and shortening is free.
+func (provider) Uncached() bool {
+	return true
+}
+
+// Query shortens "url [expiry]".
+func (provider) Query(ctx context.Context, query string) (string, error) {
+	activeMut.RLock()
+	s := active
+	activeMut.RUnlock()
+	if s == nil {
+		return "", errors.New("the shortener extension is not loaded")
+	}
+
+	args := strings.Fields(query)
+	if len(args) == 0 || len(args) > 2 {
+		return "", errors.New("usage: shorten url [expiry]")
+	}
+
+	var ttl time.Duration
+	if len(args) == 2 {
+		var err error
+		if ttl, err = parseExpiry(args[1]); err != nil {
+			return "", err
+		}
+	}
+
+	link, err := s.db.Shorten(args[0], queryer.Requester(ctx), ttl)
+	if err != nil {
+		return "", err
+	}
+	short, err := s.link(link.Slug)
+	if err != nil {
+		return "", err
+	}
+
+	if link.Expires.IsZero() {
+		return "\x02Shorten:\x02 " + short, nil
+	}
+	return fmt.Sprintf("\x02Shorten:\x02 %s (expires %s)", short, link.Expires.Format(dateFormat)), nil
+}
+
+// parseExpiry parses a duration that can also be in days, like 7d.
+func parseExpiry(s string) (time.Duration, error) {
+	var ttl time.Duration
+	var err error
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		var n int
+		n, err = strconv.Atoi(days)
+		ttl = time.Duration(n) * 24 * time.Hour
+	} else {
+		ttl, err = time.ParseDuration(s)
+	}
+
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("bad expiry %q, use something like 30m, 12h or 7d", s)
+	}
+	return ttl, nil
+}
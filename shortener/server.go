@@ -0,0 +1,55 @@
+package shortener
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handler redirects /<slug> to the link's url, counting the click.
+func Handler(db *DB) http.Handler {
+	return redirector{db: db}
+}
+
+type redirector struct {
+	db *DB
+}
+
+func (rd redirector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	slug := strings.TrimPrefix(r.URL.Path, "/")
+	if len(slug) == 0 || strings.Contains(slug, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var link Link
+	var err error
+	if r.Method == http.MethodHead {
+		// Only count the clicks that go somewhere.
+		link, err = rd.db.Get(slug)
+		if err == nil && link.Expired(time.Now()) {
+			err = ErrNotFound
+		}
+	} else {
+		link, err = rd.db.Resolve(slug)
+	}
+
+	switch {
+	case err == ErrNotFound:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Caching the redirect would hide clicks.
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, link.URL, http.StatusFound)
+}
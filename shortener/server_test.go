@@ -0,0 +1,58 @@
+package shortener
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	db := newTestDB(t)
+	link, err := db.Shorten("https://example.com/page", "nick", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour).Unix()
+	if _, err = db.db.Exec(sqlAdd, "old", "https://example.com/old", "nick", past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/" + link.Slug, http.StatusFound},
+		{http.MethodHead, "/" + link.Slug, http.StatusFound},
+		{http.MethodGet, "/nope", http.StatusNotFound},
+		{http.MethodGet, "/old", http.StatusNotFound},
+		{http.MethodHead, "/old", http.StatusNotFound},
+		{http.MethodGet, "/", http.StatusNotFound},
+		{http.MethodGet, "/" + link.Slug + "/more", http.StatusNotFound},
+		{http.MethodPost, "/" + link.Slug, http.StatusMethodNotAllowed},
+	}
+
+	handler := Handler(db)
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.want {
+			t.Errorf("%s %s: want %d, got %d", test.method, test.path, test.want, w.Code)
+			continue
+		}
+		if w.Code != http.StatusFound {
+			continue
+		}
+		if loc := w.Header().Get("Location"); loc != link.URL {
+			t.Errorf("%s %s: want a redirect to %s, got %s", test.method, test.path, link.URL, loc)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("%s %s: want the redirect uncached, got %q", test.method, test.path, cc)
+		}
+	}
+
+	if got, _ := db.Get(link.Slug); got.Clicks != 1 {
+		t.Errorf("want only the GET counted as a click, got %d", got.Clicks)
+	}
+}
@@ -0,0 +1,154 @@
+// Package tell keeps memos for people who aren't around and gives them out
+// when they next talk or join.
+package tell
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/aarondl/uq/ircmsg"
+	// sqlite3
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	sqlCreateTable = `CREATE TABLE IF NOT EXISTS memos (` +
+		`id INTEGER PRIMARY KEY AUTOINCREMENT,` +
+		`network TEXT NOT NULL,` +
+		`recipient TEXT NOT NULL,` +
+		`account TEXT NOT NULL DEFAULT '',` +
+		`sender TEXT NOT NULL,` +
+		`sender_host TEXT NOT NULL,` +
+		`sender_account TEXT NOT NULL DEFAULT '',` +
+		`message TEXT NOT NULL,` +
+		`created INTEGER NOT NULL);`
+	sqlRecipientIndex = `CREATE INDEX IF NOT EXISTS memosrecipient ON memos (network, recipient);`
+	sqlAccountIndex   = `CREATE INDEX IF NOT EXISTS memosaccount ON memos (network, account);`
+	sqlSenderIndex    = `CREATE INDEX IF NOT EXISTS memossender ON memos (network, sender_host);`
+
+	// whereFor matches the memos left for a nick, and the memos left for the
+	// account someone is authed as. Memos for an account don't match the nick
+	// so that whoever takes the nick can't read them.
+	whereFor = `WHERE network = ? AND ((account = '' AND recipient = ?) OR (account != '' AND account = ?))`
+	// whereFrom matches the memos from a user@host, or from the account
+	// they're authed as. Nicks aren't used since they're changed at will.
+	whereFrom = `WHERE network = ? AND (sender_host = ? OR (sender_account != '' AND sender_account = ?))`
+	columns   = `id, network, recipient, account, sender, sender_account, message, created`
+
+	sqlAdd = `INSERT INTO memos (network, recipient, account, sender, sender_host, sender_account, message, created) ` +
+		`VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+	sqlFor       = `SELECT ` + columns + ` FROM memos ` + whereFor + ` ORDER BY id LIMIT ?;`
+	sqlCountFor  = `SELECT COUNT(*) FROM memos ` + whereFor + `;`
+	sqlFrom      = `SELECT ` + columns + ` FROM memos ` + whereFrom + ` ORDER BY id LIMIT ?;`
+	sqlCountFrom = `SELECT COUNT(*) FROM memos ` + whereFrom + `;`
+	sqlDel       = `DELETE FROM memos WHERE id = ?;`
+)
+
+// Memo is a message waiting for someone.
+type Memo struct {
+	ID      int64
+	Network string
+	// Recipient is the nick it was left for.
+	Recipient string
+	// Account is the account the recipient was authed as when it was left,
+	// or the account named like them if they weren't around. Then it's only
+	// delivered to whoever is authed as it.
+	Account string
+	// Sender is the full nick!user@host of who left it.
+	Sender        string
+	SenderAccount string
+	Message       string
+	Created       time.Time
+}
+
+// DB stores the memos.
+type DB struct {
+	db *sql.DB
+}
+
+// OpenDB opens the database at the location requested.
+func OpenDB(filename string) (*DB, error) {
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite only allows one writer, one connection avoids busy errors.
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{sqlCreateTable, sqlRecipientIndex, sqlAccountIndex, sqlSenderIndex} {
+		if _, err = db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &DB{db: db}, nil
+}
+
+// Close the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Add a memo.
+func (d *DB) Add(m Memo) (int64, error) {
+	res, err := d.db.Exec(sqlAdd, m.Network, strings.ToLower(m.Recipient),
+		strings.ToLower(m.Account), m.Sender, strings.ToLower(ircmsg.UserHost(m.Sender)),
+		strings.ToLower(m.SenderAccount), m.Message, m.Created.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// For returns the oldest n memos waiting for a nick or account, and how many
+// there are in all. Memos left for an account aren't returned for the nick.
+func (d *DB) For(network, nick, account string, n int) ([]Memo, int, error) {
+	return d.list(sqlFor, sqlCountFor, network, nick, account, n)
+}
+
+// From returns the oldest n memos left by a user@host or account that are
+// still waiting, and how many there are in all.
+func (d *DB) From(network, userhost, account string, n int) ([]Memo, int, error) {
+	return d.list(sqlFrom, sqlCountFrom, network, userhost, account, n)
+}
+
+// Delete a memo once it's delivered.
+func (d *DB) Delete(id int64) error {
+	_, err := d.db.Exec(sqlDel, id)
+	return err
+}
+
+func (d *DB) list(query, count, network, who, account string, n int) ([]Memo, int, error) {
+	who, account = strings.ToLower(who), strings.ToLower(account)
+
+	var total int
+	if err := d.db.QueryRow(count, network, who, account).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if total == 0 || n <= 0 {
+		return nil, total, nil
+	}
+
+	rows, err := d.db.Query(query, network, who, account, n)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var memos []Memo
+	for rows.Next() {
+		var m Memo
+		var created int64
+		err = rows.Scan(&m.ID, &m.Network, &m.Recipient, &m.Account, &m.Sender,
+			&m.SenderAccount, &m.Message, &created)
+		if err != nil {
+			return nil, 0, err
+		}
+		m.Created = time.Unix(created, 0)
+		memos = append(memos, m)
+	}
+
+	return memos, total, rows.Err()
+}
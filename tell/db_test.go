@@ -0,0 +1,146 @@
+package tell
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := OpenDB(filepath.Join(t.TempDir(), "tell.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func add(t *testing.T, db *DB, memos ...Memo) {
+	t.Helper()
+	for _, m := range memos {
+		if len(m.Network) == 0 {
+			m.Network = "net"
+		}
+		if len(m.Sender) == 0 {
+			m.Sender = "sender!s@s.host"
+		}
+		if _, err := db.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func messages(memos []Memo) []string {
+	var msgs []string
+	for _, m := range memos {
+		msgs = append(msgs, m.Message)
+	}
+	return msgs
+}
+
+func TestFor(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	add(t, db,
+		Memo{Recipient: "Nick", Message: "to nick"},
+		Memo{Recipient: "nick", Account: "Acct", Message: "to acct"},
+		Memo{Recipient: "other", Account: "acct", Message: "to acct as other"},
+		Memo{Network: "elsewhere", Recipient: "nick", Message: "other network"},
+	)
+
+	tests := []struct {
+		name    string
+		nick    string
+		account string
+		want    []string
+	}{
+		{"bare nick", "NICK", "", []string{"to nick"}},
+		{"authed", "nick", "acct", []string{"to nick", "to acct", "to acct as other"}},
+		{"authed under another nick", "someone", "ACCT", []string{"to acct", "to acct as other"}},
+		{"other account", "nick", "else", []string{"to nick"}},
+		{"nobody", "nobody", "", nil},
+	}
+
+	for _, test := range tests {
+		memos, total, err := db.For("net", test.nick, test.account, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := messages(memos)
+		if total != len(test.want) || len(got) != len(test.want) {
+			t.Errorf("%s: want %q, got %q (%d)", test.name, test.want, got, total)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: want %q, got %q", test.name, test.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestForLimit(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	for _, msg := range []string{"1", "2", "3"} {
+		add(t, db, Memo{Recipient: "nick", Message: msg, Created: time.Now()})
+	}
+
+	memos, total, err := db.For("net", "nick", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages(memos); total != 3 || len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Errorf("want the oldest 2 of 3, got %q of %d", got, total)
+	}
+
+	if err = db.Delete(memos[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	memos, total, err = db.For("net", "nick", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(memos) != 0 {
+		t.Errorf("want only the count of the 2 left, got %d memos of %d", len(memos), total)
+	}
+}
+
+func TestFrom(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDB(t)
+	add(t, db,
+		Memo{Recipient: "a", Sender: "one!User@Host", Message: "by host"},
+		Memo{Recipient: "b", Sender: "two!user@host", Message: "by host as two"},
+		Memo{Recipient: "c", Sender: "three!x@elsewhere", SenderAccount: "Acct", Message: "by account"},
+		Memo{Recipient: "d", Sender: "four!y@other", Message: "someone else"},
+	)
+
+	tests := []struct {
+		name     string
+		userhost string
+		account  string
+		want     int
+	}{
+		{"host under any nick", "user@host", "", 2},
+		{"host and account", "USER@HOST", "acct", 3},
+		{"account from anywhere", "z@new", "acct", 1},
+		{"nobody", "z@new", "", 0},
+	}
+
+	for _, test := range tests {
+		_, total, err := db.From("net", test.userhost, test.account, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != test.want {
+			t.Errorf("%s: want %d memos, got %d", test.name, test.want, total)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package tell
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/config"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/ircmsg"
+	"github.com/aarondl/uq/settings"
+)
+
+const (
+	defaultDB = "tell.sqlite3"
+	// maxDeliver is how many memos are given out at once, the rest wait
+	// until the next time.
+	maxDeliver = 5
+	maxList    = 10
+	maxMessage = 400
+)
+
+func init() {
+	ext.RegisterExtension("tell", &Tell{})
+	settings.Define("tell", settings.Option{
+		Name:    "max_memos",
+		Type:    settings.IntType,
+		Default: "10",
+		Desc:    "How many memos one person can have waiting on a network, 0 is no limit.",
+	})
+}
+
+// Tell extension
+type Tell struct {
+	b  *bot.Bot
+	db *DB
+
+	// deliver stops two events from handing out the same memos.
+	deliver sync.Mutex
+
+	tellID    uint64
+	memosID   uint64
+	privmsgID uint64
+	joinID    uint64
+}
+
+// Init the extension
+func (t *Tell) Init(b *bot.Bot) error {
+	t.b = b
+
+	filename := defaultDB
+	b.ReadConfig(func(cfg *config.Config) {
+		if val, ok := cfg.ExtGlobal().ConfigVal("", "", "tell_db"); ok {
+			filename = val
+		}
+	})
+
+	db, err := OpenDB(filename)
+	if err != nil {
+		return err
+	}
+	t.db = db
+
+	t.tellID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"tell",
+		"tell",
+		"Leaves a memo for a nick, they get it when they next talk or join. "+
+			"If they're authed, or the nick is an account's, the memo is only given to that account under any nick.",
+		t,
+		cmd.Privmsg, cmd.AnyScope, "nick", "message...",
+	))
+	if err != nil {
+		db.Close()
+		return err
+	}
+	t.memosID, err = ext.RegisterCmd(b, "", "", cmd.New(
+		"tell",
+		"memos",
+		"Lists the memos you've left that haven't been delivered yet.",
+		t,
+		cmd.Privmsg, cmd.AnyScope,
+	))
+	if err != nil {
+		ext.UnregisterCmd(b, t.tellID)
+		db.Close()
+		return err
+	}
+
+	t.privmsgID = ext.Register(b, "", "", irc.PRIVMSG, t)
+	t.joinID = ext.Register(b, "", "", irc.JOIN, t)
+
+	return nil
+}
+
+// Deinit the extension
+func (t *Tell) Deinit(b *bot.Bot) error {
+	ext.Unregister(b, t.privmsgID)
+	ext.Unregister(b, t.joinID)
+	ext.UnregisterCmd(b, t.tellID)
+	ext.UnregisterCmd(b, t.memosID)
+
+	return t.db.Close()
+}
+
+// Cmd lets reflection hook up the commands, instead of doing it here.
+func (t *Tell) Cmd(_ string, _ irc.Writer, _ *cmd.Event) error {
+	return nil
+}
+
+// Tell leaves a memo for someone.
+func (t *Tell) Tell(w irc.Writer, ev *cmd.Event) error {
+	network, nick := ev.NetworkID, ev.Nick()
+	to, msg := ev.Args["nick"], ev.Args["message"]
+
+	switch {
+	case strings.EqualFold(nick, to):
+		w.Notice(nick, "\x02Tell:\x02 You can tell yourself that.")
+		return nil
+	case strings.ContainsAny(to, "!@*?,") || ev.NetworkInfo.IsChannel(to):
+		w.Noticef(nick, "\x02Tell:\x02 %s isn't a nick.", to)
+		return nil
+	case len(msg) > maxMessage:
+		w.Noticef(nick, "\x02Tell:\x02 Memos can be at most %d characters.", maxMessage)
+		return nil
+	}
+	if state := t.b.State(network); state != nil && strings.EqualFold(to, state.Self().Nick()) {
+		w.Notice(nick, "\x02Tell:\x02 I'm right here.")
+		return nil
+	}
+
+	senderAccount := t.account(network, ev.Sender)
+	if max := settings.Int(t.b, network, "", "tell", "max_memos"); max > 0 {
+		_, waiting, err := t.db.From(network, ircmsg.UserHost(ev.Sender), senderAccount, 0)
+		if err != nil {
+			return err
+		}
+		if waiting >= max {
+			w.Noticef(nick, "\x02Tell:\x02 You have %d memos waiting already, "+
+				"some have to be delivered before you can leave more.", waiting)
+			return nil
+		}
+	}
+
+	_, err := t.db.Add(Memo{
+		Network:       network,
+		Recipient:     to,
+		Account:       t.nickAccount(network, to),
+		Sender:        ev.Sender,
+		SenderAccount: senderAccount,
+		Message:       msg,
+		Created:       time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Notifyf(ev.Event, nick, "\x02Tell:\x02 I'll tell %s when they're next around.", to)
+	return nil
+}
+
+// Memos lists the memos someone has left that are still waiting.
+func (t *Tell) Memos(w irc.Writer, ev *cmd.Event) error {
+	network, nick := ev.NetworkID, ev.Nick()
+
+	memos, total, err := t.db.From(network, ircmsg.UserHost(ev.Sender), t.account(network, ev.Sender), maxList)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		w.Notice(nick, "\x02Tell:\x02 You have no memos waiting.")
+		return nil
+	}
+
+	if total > len(memos) {
+		w.Noticef(nick, "\x02Tell:\x02 %d memos waiting, the oldest %d:", total, len(memos))
+	} else {
+		w.Noticef(nick, "\x02Tell:\x02 %d memos waiting:", total)
+	}
+	now := time.Now()
+	for _, m := range memos {
+		ircmsg.Notice(t.b, w, network, nick, fmt.Sprintf("\x02%s\x02 (%s ago): %s",
+			m.Recipient, ircmsg.Ago(now.Sub(m.Created)), m.Message))
+	}
+	return nil
+}
+
+// Handle gives people their memos when they talk or join.
+func (t *Tell) Handle(w irc.Writer, ev *irc.Event) {
+	network, nick := ev.NetworkID, ev.Nick()
+	if state := t.b.State(network); state != nil && strings.EqualFold(nick, state.Self().Nick()) {
+		return
+	}
+
+	t.deliver.Lock()
+	defer t.deliver.Unlock()
+
+	memos, total, err := t.db.For(network, nick, t.account(network, ev.Sender), maxDeliver)
+	if err != nil {
+		t.b.Logger.Error("failed to look up memos", "network", network, "nick", nick, "err", err)
+		return
+	}
+
+	now := time.Now()
+	for _, m := range memos {
+		err = ircmsg.Notice(t.b, w, network, nick, fmt.Sprintf("\x02Tell:\x02 %s said %s ago: %s",
+			irc.Nick(m.Sender), ircmsg.Ago(now.Sub(m.Created)), m.Message))
+		if err != nil {
+			t.b.Logger.Error("failed to deliver memo", "network", network, "nick", nick, "err", err)
+			return
+		}
+		if err = t.db.Delete(m.ID); err != nil {
+			t.b.Logger.Error("failed to delete memo", "network", network, "id", m.ID, "err", err)
+			return
+		}
+	}
+
+	if left := total - len(memos); left > 0 {
+		w.Noticef(nick, "\x02Tell:\x02 %d more memos waiting, you'll get them next time you talk.", left)
+	}
+}
+
+// account is the username someone is authed as, if they are.
+func (t *Tell) account(network, host string) string {
+	if store := t.b.Store(); store != nil {
+		if user := store.AuthedUser(network, host); user != nil {
+			return user.Username
+		}
+	}
+	return ""
+}
+
+// nickAccount is the username whoever is using a nick is authed as, if
+// they're around and authed. Otherwise it's the account named like the nick
+// if there is one, so memos for people who aren't around still find them
+// under another nick.
+func (t *Tell) nickAccount(network, nick string) string {
+	if state := t.b.State(network); state != nil {
+		if user, ok := state.User(nick); ok {
+			if account := t.account(network, string(user.Host)); len(account) != 0 {
+				return account
+			}
+		}
+	}
+
+	store := t.b.Store()
+	if store == nil {
+		return ""
+	}
+	user, err := store.FindUser(nick)
+	if err != nil || user == nil {
+		return ""
+	}
+	return user.Username
+}
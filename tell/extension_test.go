@@ -0,0 +1,224 @@
+package tell
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aarondl/ultimateq/bot"
+	"github.com/aarondl/ultimateq/data"
+	"github.com/aarondl/ultimateq/dispatch/cmd"
+	"github.com/aarondl/ultimateq/irc"
+	"github.com/aarondl/uq/ext"
+	"github.com/aarondl/uq/internal/testbot"
+)
+
+// newTestBot makes a bot whose tell allows two memos from each person.
+func newTestBot(t *testing.T) *bot.Bot {
+	t.Helper()
+
+	b := testbot.New(t, fmt.Sprintf(`tell_db = %q
+tell_max_memos = "2"`, filepath.Join(t.TempDir(), "bot.sqlite3")))
+	testbot.Welcome(b, "test")
+	return b
+}
+
+func newTestTell(t *testing.T) *Tell {
+	t.Helper()
+	return &Tell{b: newTestBot(t), db: newTestDB(t)}
+}
+
+// auth logs host in as the account, making it first if needed.
+func auth(t *testing.T, b *bot.Bot, host, account string) {
+	t.Helper()
+
+	store := b.Store()
+	if user, _ := store.FindUser(account); user == nil {
+		user, err := data.NewStoredUser(account, "pass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = store.SaveUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.AuthUserPerma("test", host, account, "pass"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tell(t *testing.T, tl *Tell, sender, to string) string {
+	t.Helper()
+
+	var lines testbot.Lines
+	ev := &cmd.Event{
+		Event: irc.NewEvent("test", irc.NewNetworkInfo(), irc.PRIVMSG, sender, "uq", ""),
+		Args:  map[string]string{"nick": to, "message": "hi " + to},
+	}
+	if err := tl.Tell(irc.Helper{Writer: &lines}, ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("want one reply, got %q", lines)
+	}
+	return lines[0]
+}
+
+func TestTellMaxMemos(t *testing.T) {
+	tl := newTestTell(t)
+
+	const left = "I'll tell"
+	const full = "You have 2 memos waiting already"
+
+	tests := []struct {
+		sender, to string
+		want       string
+	}{
+		{"a!u@host", "x", left},
+		{"b!u@host", "y", left},
+		{"a!u@host", "z", full},
+		{"c!U@HOST", "z", full},
+		{"d!d@other", "z", left},
+	}
+
+	for _, test := range tests {
+		if got := tell(t, tl, test.sender, test.to); !strings.Contains(got, test.want) {
+			t.Errorf("%s to %s: want %q, got %q", test.sender, test.to, test.want, got)
+		}
+	}
+
+	// An account is capped across every host it's authed from.
+	auth(t, tl.b, "e!e@one", "acct")
+	auth(t, tl.b, "f!f@two", "acct")
+	tell(t, tl, "e!e@one", "x")
+	tell(t, tl, "e!e@one", "y")
+	if got := tell(t, tl, "f!f@two", "z"); !strings.Contains(got, full) {
+		t.Errorf("want the account's memos counted from another host, got %q", got)
+	}
+
+	_, waiting, err := tl.db.From("test", "d@other", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waiting != 1 {
+		t.Errorf("want refused memos not stored, got %d from d", waiting)
+	}
+}
+
+func TestTellAccount(t *testing.T) {
+	tl := newTestTell(t)
+	ni := irc.NewNetworkInfo()
+
+	// nick is around and authed, so the memo is for their account.
+	tl.b.State("test").Update(irc.NewEvent("test", ni, irc.JOIN, "nick!n@n.host", "#chan"))
+	auth(t, tl.b, "nick!n@n.host", "acct")
+	tell(t, tl, "sender!s@s.host", "nick")
+
+	handle := func(sender string) []string {
+		var lines testbot.Lines
+		tl.Handle(irc.Helper{Writer: &lines}, irc.NewEvent("test", ni, irc.PRIVMSG, sender, "#chan", "hello"))
+		return lines
+	}
+
+	if got := handle("nick!other@someone.else"); len(got) != 0 {
+		t.Errorf("want nothing given to whoever took the nick, got %q", got)
+	}
+
+	auth(t, tl.b, "renamed!n@n.host2", "acct")
+	got := handle("renamed!n@n.host2")
+	if len(got) != 1 || !strings.Contains(got[0], "sender said") || !strings.Contains(got[0], "hi nick") {
+		t.Errorf("want the memo given to the account under any nick, got %q", got)
+	}
+}
+
+func TestTellOfflineAccount(t *testing.T) {
+	tl := newTestTell(t)
+	ni := irc.NewNetworkInfo()
+
+	// acct isn't around but there's an account by that name.
+	auth(t, tl.b, "someone!a@a.host", "acct")
+	tl.b.Store().Logout("test", "someone!a@a.host")
+	tell(t, tl, "sender!s@s.host", "acct")
+	tell(t, tl, "sender!s@s.host", "nobody")
+
+	handle := func(sender string) []string {
+		var lines testbot.Lines
+		tl.Handle(irc.Helper{Writer: &lines}, irc.NewEvent("test", ni, irc.PRIVMSG, sender, "#chan", "hello"))
+		return lines
+	}
+
+	if got := handle("acct!x@impostor.host"); len(got) != 0 {
+		t.Errorf("want nothing given to an unauthed acct, got %q", got)
+	}
+	auth(t, tl.b, "other!a@a.host", "acct")
+	if got := handle("other!a@a.host"); len(got) != 1 || !strings.Contains(got[0], "hi acct") {
+		t.Errorf("want the memo given to the account under another nick, got %q", got)
+	}
+	if got := handle("nobody!n@n.host"); len(got) != 1 || !strings.Contains(got[0], "hi nobody") {
+		t.Errorf("want memos for nicks without an account left on the nick, got %q", got)
+	}
+}
+
+func TestDeliverBatching(t *testing.T) {
+	tl := newTestTell(t)
+	ni := irc.NewNetworkInfo()
+
+	for i := 0; i < maxDeliver+2; i++ {
+		add(t, tl.db, Memo{Network: "test", Recipient: "nick", Message: fmt.Sprint("memo ", i)})
+	}
+
+	handle := func() []string {
+		var lines testbot.Lines
+		tl.Handle(irc.Helper{Writer: &lines}, irc.NewEvent("test", ni, irc.JOIN, "nick!n@n.host", "#chan"))
+		return lines
+	}
+
+	got := handle()
+	if len(got) != maxDeliver+1 {
+		t.Fatalf("want %d memos and a note, got %q", maxDeliver, got)
+	}
+	if !strings.HasSuffix(got[0], "memo 0") || !strings.HasSuffix(got[maxDeliver-1], fmt.Sprint("memo ", maxDeliver-1)) {
+		t.Errorf("want the oldest first, got %q", got)
+	}
+	if !strings.Contains(got[maxDeliver], "2 more memos waiting") {
+		t.Errorf("want a note about the rest, got %q", got[maxDeliver])
+	}
+
+	if got = handle(); len(got) != 2 || !strings.HasSuffix(got[1], fmt.Sprint("memo ", maxDeliver+1)) {
+		t.Errorf("want the last 2 next time without a note, got %q", got)
+	}
+	if got = handle(); len(got) != 0 {
+		t.Errorf("want nothing once delivered, got %q", got)
+	}
+
+	var lines testbot.Lines
+	add(t, tl.db, Memo{Network: "test", Recipient: "uq", Message: "for the bot"})
+	tl.Handle(irc.Helper{Writer: &lines}, irc.NewEvent("test", ni, irc.JOIN, "uq!uq@uq.host", "#chan"))
+	if len(lines) != 0 {
+		t.Errorf("want the bot itself skipped, got %q", lines)
+	}
+}
+
+func TestInitCleansUp(t *testing.T) {
+	b := newTestBot(t)
+	if err := ext.Unload(b, "tell"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Something else having tell.memos makes registering it fail.
+	memos := cmd.New("tell", "memos", "taken", &Tell{}, cmd.Privmsg, cmd.AnyScope)
+	if _, err := b.RegisterCmd("", "", memos); err != nil {
+		t.Fatal(err)
+	}
+
+	tl := &Tell{}
+	if err := tl.Init(b); err == nil {
+		t.Fatal("want an error when memos can't be registered")
+	}
+
+	again := cmd.New("tell", "tell", "again", &Tell{}, cmd.Privmsg, cmd.AnyScope, "nick", "message...")
+	if _, err := b.RegisterCmd("", "", again); err != nil {
+		t.Errorf("want tell unregistered after the failed Init, got %v", err)
+	}
+}
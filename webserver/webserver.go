@@ -0,0 +1,88 @@
+// Package webserver runs the http servers of extensions whose listen address
+// can change on a rehash.
+package webserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+// Server serves a handler, it can be moved to another address without
+// dropping the requests in flight.
+type Server struct {
+	handler http.Handler
+
+	mut    sync.Mutex
+	server *http.Server
+	listen string
+}
+
+// New creates a server for handler, it doesn't listen until Serve is called.
+func New(handler http.Handler) *Server {
+	return &Server{handler: handler}
+}
+
+// Serve starts listening on listen if it's changed, an empty listen stops the
+// server.
+func (s *Server) Serve(listen string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if listen == s.listen {
+		return nil
+	}
+
+	if len(listen) == 0 {
+		s.listen = ""
+		return s.shutdown()
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+
+	if err := s.shutdown(); err != nil {
+		ln.Close()
+		return err
+	}
+
+	s.server = &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	s.listen = listen
+	go s.server.Serve(ln)
+
+	return nil
+}
+
+// Stop the server if it's running.
+func (s *Server) Stop() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.listen = ""
+	return s.shutdown()
+}
+
+// shutdown must be called with mut held.
+func (s *Server) shutdown() error {
+	if s.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	s.server = nil
+	return err
+}
@@ -0,0 +1,80 @@
+package webserver
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func get(addr string) (string, error) {
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestServerMoves(t *testing.T) {
+	s := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer s.Stop()
+
+	first, second := freeAddr(t), freeAddr(t)
+
+	if err := s.Serve(first); err != nil {
+		t.Fatal(err)
+	}
+	if body, err := get(first); err != nil || body != "hello" {
+		t.Fatalf("want hello from %s, got %q %v", first, body, err)
+	}
+	if err := s.Serve(first); err != nil {
+		t.Error("serving on the same address again should do nothing:", err)
+	}
+
+	if err := s.Serve(second); err != nil {
+		t.Fatal(err)
+	}
+	if body, err := get(second); err != nil || body != "hello" {
+		t.Errorf("want hello from %s, got %q %v", second, body, err)
+	}
+	if _, err := get(first); err == nil {
+		t.Errorf("%s should be closed after moving", first)
+	}
+
+	if err := s.Serve(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(second); err == nil {
+		t.Errorf("%s should be closed after serving on nothing", second)
+	}
+}
+
+func TestServerBadAddressKeepsServing(t *testing.T) {
+	s := New(http.NotFoundHandler())
+	defer s.Stop()
+
+	addr := freeAddr(t)
+	if err := s.Serve(addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve("not an address"); err == nil {
+		t.Error("want an error for a bad address")
+	}
+	if _, err := get(addr); err != nil {
+		t.Errorf("a failed move shouldn't stop the old listener: %v", err)
+	}
+}